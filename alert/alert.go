@@ -0,0 +1,275 @@
+// Package alert evaluates simple rules on the stats and loglines of a container and tells when they fire or resolve
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/fasibio/funk_agent/jsonpath"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// Status is the state an Alert changed to
+type Status string
+
+const (
+	// StatusFiring the condition of the rule is true
+	StatusFiring Status = "firing"
+	// StatusResolved the condition of a firing rule is false again
+	StatusResolved Status = "resolved"
+
+	defaultWindow = time.Minute
+)
+
+// Rule is one condition on the stats or the loglines of a container.
+// Stats rules look like {"name": "cpu", "stats": "cpu_usage_percent > 90", "for": 3},
+// log rules like {"name": "errors", "logs": "level=error", "count": 10, "window": "1m"}
+type Rule struct {
+	Name   string `json:"name"`
+	Stats  string `json:"stats,omitempty"`  // Stats is a condition like cpu_usage_percent > 90 on a field of the cumulated stats
+	For    int    `json:"for,omitempty"`    // For is the count of stats in a row the condition has to be true (default 1)
+	Logs   string `json:"logs,omitempty"`   // Logs are filterexpressions like funk.log.keep, one of them has to match
+	Count  int    `json:"count,omitempty"`  // Count fires the log rule if more loglines match within Window
+	Window string `json:"window,omitempty"` // Window is the duration to count the loglines like 1m or 30s (default 1m)
+}
+
+// Alert is a rule which has fired or resolved
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Status    Status    `json:"status"`
+	Condition string    `json:"condition"` // Condition is the stats or logs of the rule
+	Value     float64   `json:"value"`     // Value is the value of the stats field or the count of matching loglines
+	Threshold float64   `json:"threshold"`
+	Since     time.Time `json:"since"` // Since is the time the rule has fired
+	At        time.Time `json:"at"`
+}
+
+// LoadRules reads the rules of a json file with a list of rules
+func LoadRules(path string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(string(data))
+}
+
+// ParseRules reads the rules of a json list like the label funk.alert.rules
+func ParseRules(value string) ([]Rule, error) {
+	var res []Rule
+	if err := json.Unmarshal([]byte(value), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+var statsCondition = regexp.MustCompile(`^\s*([\w.-]+)\s*(>=|<=|==|!=|>|<)\s*(-?[\d.]+)\s*$`)
+
+// state is a compiled rule and what is known about it
+type state struct {
+	rule      Rule
+	field     string
+	operator  string
+	threshold float64
+	filter    []tracker.FilterExpression
+	window    time.Duration
+
+	firing  bool
+	since   time.Time
+	hits    int           // hits are the stats in a row matching the condition
+	matches []matchBucket // matches are the counts of the matching loglines per evaluation within the window
+	count   int           // count is the sum of the matches
+}
+
+// matchBucket is the count of the matching loglines of one evaluation, so a burst of lines does not keep a time for each line
+type matchBucket struct {
+	at    time.Time
+	count int
+}
+
+func compile(rule Rule) (*state, error) {
+	res := &state{rule: rule}
+	if rule.Name == "" {
+		return nil, errors.New("alert rule without name")
+	}
+	switch {
+	case rule.Stats != "" && rule.Logs != "":
+		return nil, fmt.Errorf("alert rule %v has stats and logs", rule.Name)
+	case rule.Stats != "":
+		parts := statsCondition.FindStringSubmatch(rule.Stats)
+		if parts == nil {
+			return nil, fmt.Errorf("alert rule %v has no valid stats condition like cpu_usage_percent > 90: %v", rule.Name, rule.Stats)
+		}
+		res.field, res.operator = parts[1], parts[2]
+		res.threshold, _ = strconv.ParseFloat(parts[3], 64)
+	case rule.Logs != "":
+		filter, err := tracker.ParseFilterExpressions(rule.Logs)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %v: %v", rule.Name, err)
+		}
+		res.filter = filter
+		res.threshold = float64(rule.Count)
+		res.window = defaultWindow
+		if rule.Window != "" {
+			if res.window, err = time.ParseDuration(rule.Window); err != nil {
+				return nil, fmt.Errorf("alert rule %v: %v", rule.Name, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("alert rule %v has no stats or logs", rule.Name)
+	}
+	return res, nil
+}
+
+func (s *state) condition() string {
+	if s.rule.Stats != "" {
+		return s.rule.Stats
+	}
+	return s.rule.Logs
+}
+
+func (s *state) compare(value float64) bool {
+	switch s.operator {
+	case ">":
+		return value > s.threshold
+	case ">=":
+		return value >= s.threshold
+	case "<":
+		return value < s.threshold
+	case "<=":
+		return value <= s.threshold
+	case "==":
+		return value == s.threshold
+	case "!=":
+		return value != s.threshold
+	}
+	return false
+}
+
+// update changes the firing state and returns the Alert if it has changed
+func (s *state) update(active bool, value float64, now time.Time) *Alert {
+	if active == s.firing {
+		return nil
+	}
+	s.firing = active
+	status := StatusResolved
+	if active {
+		s.since = now
+		status = StatusFiring
+	}
+	return &Alert{
+		Rule:      s.rule.Name,
+		Status:    status,
+		Condition: s.condition(),
+		Value:     value,
+		Threshold: s.threshold,
+		Since:     s.since,
+		At:        now,
+	}
+}
+
+// Evaluator keeps the state of the rules of one container
+type Evaluator struct {
+	states []*state
+}
+
+// NewEvaluator compiles the rules, it returns an error for the first invalid rule
+func NewEvaluator(rules []Rule) (*Evaluator, error) {
+	res := &Evaluator{}
+	for _, one := range rules {
+		s, err := compile(one)
+		if err != nil {
+			return nil, err
+		}
+		res.states = append(res.states, s)
+	}
+	return res, nil
+}
+
+// EvaluateStats checks the stats rules against the fields of the cumulated stats
+func (e *Evaluator) EvaluateStats(stats tracker.CumulateStats, now time.Time) []Alert {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	var res []Alert
+	for _, s := range e.states {
+		if s.rule.Stats == "" {
+			continue
+		}
+		raw, found := jsonpath.Get(fields, s.field)
+		value, isNumber := raw.(float64)
+		if !found || !isNumber || !s.compare(value) {
+			s.hits = 0
+		} else {
+			s.hits++
+		}
+		needed := s.rule.For
+		if needed < 1 {
+			needed = 1
+		}
+		if alert := s.update(s.hits >= needed, value, now); alert != nil {
+			res = append(res, *alert)
+		}
+	}
+	return res
+}
+
+// addMatches adds the count of matching loglines at now and removes the buckets out of the window
+func (s *state) addMatches(matched int, now time.Time) {
+	if matched > 0 {
+		if last := len(s.matches) - 1; last >= 0 && s.matches[last].at.Equal(now) {
+			s.matches[last].count += matched
+		} else {
+			s.matches = append(s.matches, matchBucket{at: now, count: matched})
+		}
+		s.count += matched
+	}
+	start := 0
+	for start < len(s.matches) && now.Sub(s.matches[start].at) >= s.window {
+		s.count -= s.matches[start].count
+		start++
+	}
+	s.matches = s.matches[start:]
+}
+
+// EvaluateLogs counts the loglines matching the log rules. It has to be called regularly (with no lines too) to resolve the rules
+func (e *Evaluator) EvaluateLogs(lines []string, now time.Time) []Alert {
+	var parsed []map[string]interface{}
+	var res []Alert
+	for _, s := range e.states {
+		if s.filter == nil {
+			continue
+		}
+		if parsed == nil {
+			parsed = make([]map[string]interface{}, 0, len(lines))
+			for _, line := range lines {
+				if values, err := tracker.DecodeLogline(line); err == nil {
+					parsed = append(parsed, values)
+				}
+			}
+		}
+		matched := 0
+		for _, values := range parsed {
+			for _, exp := range s.filter {
+				if exp.Matches(values) {
+					matched++
+					break
+				}
+			}
+		}
+		s.addMatches(matched, now)
+		if alert := s.update(s.count > s.rule.Count, float64(s.count), now); alert != nil {
+			res = append(res, *alert)
+		}
+	}
+	return res
+}
@@ -0,0 +1,139 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "stats rule", value: `[{"name": "cpu", "stats": "cpu_usage_percent > 90", "for": 3}]`},
+		{name: "log rule", value: `[{"name": "errors", "logs": "level=error", "count": 10, "window": "30s"}]`},
+		{name: "no json", value: `cpu > 90`, wantErr: true},
+		{name: "no name", value: `[{"stats": "cpu_usage_percent > 90"}]`, wantErr: true},
+		{name: "no condition", value: `[{"name": "cpu"}]`, wantErr: true},
+		{name: "stats and logs", value: `[{"name": "cpu", "stats": "cpu_usage_percent > 90", "logs": "level=error"}]`, wantErr: true},
+		{name: "invalid stats", value: `[{"name": "cpu", "stats": "cpu_usage_percent is high"}]`, wantErr: true},
+		{name: "invalid window", value: `[{"name": "errors", "logs": "level=error", "window": "often"}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.value)
+			if err == nil {
+				_, err = NewEvaluator(rules)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluator_EvaluateStats(t *testing.T) {
+	e, err := NewEvaluator([]Rule{
+		{Name: "cpu", Stats: "cpu_usage_percent > 90", For: 3},
+		{Name: "ram", Stats: "ram_usage_percent>=95"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		cpu, ram float64
+		want     []string
+	}{
+		{cpu: 95, ram: 10},
+		{cpu: 95, ram: 96, want: []string{"ram firing"}},
+		{cpu: 80, ram: 96},
+		{cpu: 95, ram: 96},
+		{cpu: 95, ram: 96},
+		{cpu: 95, ram: 50, want: []string{"cpu firing", "ram resolved"}},
+		{cpu: 95, ram: 50},
+		{cpu: 10, ram: 50, want: []string{"cpu resolved"}},
+	}
+	for i, step := range steps {
+		now := start.Add(time.Duration(i) * time.Minute)
+		alerts := e.EvaluateStats(tracker.CumulateStats{CPUUsagePercent: step.cpu, RamUsagePercent: step.ram}, now)
+		var got []string
+		for _, one := range alerts {
+			got = append(got, one.Rule+" "+string(one.Status))
+			if one.At != now {
+				t.Errorf("step %v: alert At = %v, want %v", i, one.At, now)
+			}
+		}
+		if len(got) != len(step.want) {
+			t.Fatalf("step %v: EvaluateStats() = %v, want %v", i, got, step.want)
+		}
+		for j := range got {
+			if got[j] != step.want[j] {
+				t.Errorf("step %v: EvaluateStats() = %v, want %v", i, got, step.want)
+			}
+		}
+		if i == 7 && alerts[0].Since != start.Add(5*time.Minute) {
+			t.Errorf("resolved alert Since = %v, want the time it has fired", alerts[0].Since)
+		}
+	}
+}
+
+func TestEvaluator_EvaluateLogs(t *testing.T) {
+	e, err := NewEvaluator([]Rule{{Name: "errors", Logs: "level=error", Count: 2, Window: "1m"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	errorLine := `{"level": "error", "msg": "failed"}`
+	infoLine := `{"level": "info", "msg": "ok"}`
+	steps := []struct {
+		after time.Duration
+		lines []string
+		want  Status
+		value float64
+	}{
+		{after: 0, lines: []string{errorLine, infoLine, errorLine}},
+		{after: 20 * time.Second, lines: []string{"no json", errorLine}, want: StatusFiring, value: 3},
+		{after: 30 * time.Second},
+		{after: 70 * time.Second, want: StatusResolved, value: 1},
+	}
+	for i, step := range steps {
+		alerts := e.EvaluateLogs(step.lines, start.Add(step.after))
+		if step.want == "" {
+			if len(alerts) != 0 {
+				t.Errorf("step %v: EvaluateLogs() = %+v, want no alert", i, alerts)
+			}
+			continue
+		}
+		if len(alerts) != 1 || alerts[0].Status != step.want || alerts[0].Value != step.value {
+			t.Errorf("step %v: EvaluateLogs() = %+v, want %v with value %v", i, alerts, step.want, step.value)
+		}
+	}
+}
+
+func TestEvaluator_EvaluateLogs_Burst(t *testing.T) {
+	e, err := NewEvaluator([]Rule{{Name: "errors", Logs: "level=error", Count: 5000, Window: "1m"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, 3000)
+	for i := range lines {
+		lines[i] = `{"level": "error"}`
+	}
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	e.EvaluateLogs(lines, start)
+	alerts := e.EvaluateLogs(lines, start.Add(10*time.Second))
+	if len(alerts) != 1 || alerts[0].Value != 6000 {
+		t.Errorf("EvaluateLogs() = %+v, want firing with value 6000", alerts)
+	}
+	if got := len(e.states[0].matches); got != 2 {
+		t.Errorf("EvaluateLogs() keeps %v buckets, want one per evaluation", got)
+	}
+	alerts = e.EvaluateLogs(nil, start.Add(65*time.Second))
+	if len(alerts) != 1 || alerts[0].Status != StatusResolved || alerts[0].Value != 3000 {
+		t.Errorf("EvaluateLogs() = %+v, want resolved with value 3000", alerts)
+	}
+}
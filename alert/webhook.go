@@ -0,0 +1,28 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// PostWebhook sends the payload as json to the url
+func PostWebhook(url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	res, err := webhookClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %v", res.Status)
+	}
+	return nil
+}
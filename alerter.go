@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fasibio/funk_agent/alert"
+	"github.com/fasibio/funk_agent/logger"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// Alerter evaluates the rules of ALERT_RULES_CONFIG and label funk.alert.rules for each container
+type Alerter struct {
+	rules      []alert.Rule
+	webhookURL string
+	evaluators map[string]*containerEvaluator
+	post       func(url string, payload interface{}) error
+}
+
+// containerEvaluator is the evaluator of one container and the label it is created of
+type containerEvaluator struct {
+	labelRules string
+	evaluator  *alert.Evaluator
+}
+
+// alertPayload is the body of the webhook
+type alertPayload struct {
+	alert.Alert
+	Attributes Attributes `json:"attr"`
+}
+
+// NewAlerter creates an Alerter with the global rules, webhookURL can be empty
+func NewAlerter(rules []alert.Rule, webhookURL string) (*Alerter, error) {
+	if _, err := alert.NewEvaluator(rules); err != nil {
+		return nil, err
+	}
+	return &Alerter{
+		rules:      rules,
+		webhookURL: webhookURL,
+		evaluators: make(map[string]*containerEvaluator),
+		post:       alert.PostWebhook,
+	}, nil
+}
+
+// evaluator returns the evaluator of the container, it is created again if label funk.alert.rules has changed
+func (a *Alerter) evaluator(v tracker.TrackElement) *alert.Evaluator {
+	container := v.GetContainer()
+	labelRules := container.Labels["funk.alert.rules"]
+	if current, exist := a.evaluators[container.ID]; exist && current.labelRules == labelRules {
+		return current.evaluator
+	}
+	rules := a.rules
+	if labelRules != "" {
+		containerRules, err := alert.ParseRules(labelRules)
+		if err == nil {
+			_, err = alert.NewEvaluator(containerRules)
+		}
+		if err != nil {
+			getLoggerWithContainerInformation(logger.Get(), container).Errorw("Error by label funk.alert.rules, use the global rules only: " + err.Error())
+		} else {
+			rules = append(append([]alert.Rule{}, a.rules...), containerRules...)
+		}
+	}
+	evaluator, _ := alert.NewEvaluator(rules)
+	a.evaluators[container.ID] = &containerEvaluator{labelRules: labelRules, evaluator: evaluator}
+	return evaluator
+}
+
+// Prune removes the evaluators of the containers which are not tracked anymore
+func (a *Alerter) Prune(tracked map[string]bool) {
+	if a == nil {
+		return
+	}
+	for id := range a.evaluators {
+		if !tracked[id] {
+			delete(a.evaluators, id)
+		}
+	}
+}
+
+// EvaluateStats checks the stats rules of the container
+func (a *Alerter) EvaluateStats(v tracker.TrackElement, stats tracker.CumulateStats, now time.Time) []alert.Alert {
+	if a == nil {
+		return nil
+	}
+	return a.evaluator(v).EvaluateStats(stats, now)
+}
+
+// EvaluateLogs checks the log rules of the container
+func (a *Alerter) EvaluateLogs(v tracker.TrackElement, lines []string, now time.Time) []alert.Alert {
+	if a == nil {
+		return nil
+	}
+	return a.evaluator(v).EvaluateLogs(lines, now)
+}
+
+// getAlertInfo returns the message of the alerts and calls the webhook for each of them
+func (w *Holder) getAlertInfo(v tracker.TrackElement, alerts []alert.Alert) *Message {
+	if len(alerts) == 0 {
+		return nil
+	}
+	stoutlog := getLoggerWithContainerInformation(logger.Get(), v.GetContainer())
+	attributes := getFilledMessageAttributes(w, v)
+	var data []string
+	for _, one := range alerts {
+		stoutlog.Infow("Alert "+string(one.Status), "rule", one.Rule, "condition", one.Condition, "value", one.Value)
+		b, err := json.Marshal(one)
+		if err != nil {
+			stoutlog.Warnw("Error by Marshal alert:"+err.Error(), "alert", one)
+			continue
+		}
+		data = append(data, string(b))
+		if w.Alerter.webhookURL != "" {
+			go func(payload alertPayload) {
+				if err := w.Alerter.post(w.Alerter.webhookURL, payload); err != nil {
+					stoutlog.Warnw("Error by call the alert webhook: " + err.Error())
+				}
+			}(alertPayload{Alert: one, Attributes: attributes})
+		}
+	}
+	return &Message{
+		Time:          time.Now(),
+		Type:          MessageTypeAlert,
+		Data:          data,
+		Attributes:    attributes,
+		SearchIndex:   v.SearchIndex() + "_alerts",
+		StaticContent: getStaticContent(v),
+	}
+}
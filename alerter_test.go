@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/alert"
+	"github.com/fasibio/funk_agent/tracker"
+	"github.com/gorilla/websocket"
+)
+
+func TestAlerter_labelRules(t *testing.T) {
+	a, err := NewAlerter([]alert.Rule{{Name: "global", Stats: "cpu_usage_percent > 90"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		label string
+		want  int
+	}{
+		{name: "no label", want: 0},
+		{name: "label adds rules", label: `[{"name": "restarts", "stats": "restart_count > 1"}]`, want: 1},
+		{name: "invalid label uses global rules", label: `[{"name": "restarts", "stats": "restart_count"}]`, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &TrackerMock{Con: types.Container{ID: "id", Names: []string{"mockContainer"}, Labels: map[string]string{"funk.alert.rules": tt.label}}}
+			stats := tracker.CumulateStats{ContainerState: &tracker.ContainerState{RestartCount: 2}}
+			if got := a.EvaluateStats(v, stats, time.Now()); len(got) != tt.want {
+				t.Errorf("EvaluateStats() = %v, want %v alerts", got, tt.want)
+			}
+		})
+	}
+	if _, err := NewAlerter([]alert.Rule{{Name: "invalid"}}, ""); err == nil {
+		t.Errorf("NewAlerter() with invalid rule has no error")
+	}
+}
+
+func TestAlerter_Prune(t *testing.T) {
+	a, err := NewAlerter(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Holder{Alerter: a, trackingContainers: map[string]tracker.TrackElement{
+		"kept": &TrackerMock{Con: types.Container{ID: "kept", Names: []string{"/kept"}}},
+	}}
+	for _, id := range []string{"kept", "removed"} {
+		a.EvaluateLogs(&TrackerMock{Con: types.Container{ID: id, Names: []string{"/" + id}}}, nil, time.Now())
+	}
+	a.Prune(w.trackedContainerIDs())
+	if _, exist := a.evaluators["removed"]; exist || len(a.evaluators) != 1 {
+		t.Errorf("Prune() keeps the evaluators %v", a.evaluators)
+	}
+	var none *Alerter
+	none.Prune(nil)
+}
+
+func TestHolder_SaveStatsInfo_alert(t *testing.T) {
+	a, err := NewAlerter([]alert.Rule{{Name: "unhealthy", Stats: "health_failing_streak >= 3"}}, "http://alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var posted []alertPayload
+	a.post = func(url string, payload interface{}) error {
+		posted = append(posted, payload.(alertPayload))
+		wg.Done()
+		return nil
+	}
+	var got []Message
+	w := &Holder{
+		Props:           Props{LogStats: StatsLogCumulated},
+		itSelfNamedHost: "test_unit",
+		Alerter:         a,
+		writeToServer: func(con *websocket.Conn, msg []Message) error {
+			got = msg
+			return nil
+		},
+	}
+	v := &TrackerMock{
+		Con: types.Container{ID: "id", Names: []string{"mockContainer"}},
+		Inspect: &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+			State: &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: "unhealthy", FailingStreak: 3}},
+		}},
+	}
+	wg.Add(1)
+	w.SaveStatsInfo(v)
+	wg.Wait()
+	if len(got) != 2 || got[1].Type != MessageTypeAlert || got[1].SearchIndex != "MockIndex_alerts" || len(got[1].Data) != 1 {
+		t.Fatalf("SaveStatsInfo() = %+v, want stats and one alert", got)
+	}
+	if len(posted) != 1 || posted[0].Status != alert.StatusFiring || posted[0].Attributes.Host != "test_unit" {
+		t.Errorf("webhook got %+v, want the firing alert with attributes", posted)
+	}
+
+	w.SaveStatsInfo(v)
+	if len(got) != 1 {
+		t.Errorf("SaveStatsInfo() = %+v, want stats only while the alert is still firing", got)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logger"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// StartWatchingCRILogs looks each intervall for the containers inside the kubernetes log directory (/var/log/pods).
+// configFile (can be empty) is read again each intervall, so changed labels are used without restart.
+// Will stock the process forever start it in own go routine
+func StartWatchingCRILogs(root, configFile string, trackingContainer chan []types.Container, intervall *time.Ticker) {
+	for {
+		if config, err := loadCRIConfig(configFile); err != nil {
+			logger.Get().Errorw("Error by LoadCRIConfig: " + err.Error())
+		} else if res, err := tracker.DiscoverCRIContainers(root, config); err != nil {
+			logger.Get().Errorw("Error by DiscoverCRIContainers: " + err.Error())
+		} else {
+			trackingContainer <- res
+		}
+		<-intervall.C
+	}
+}
+
+func loadCRIConfig(configFile string) ([]tracker.CRIConfig, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	return tracker.LoadCRIConfig(configFile)
+}
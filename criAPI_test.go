@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestStartWatchingCRILogs(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "default_web_6f1e2b54", "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tracking := make(chan []types.Container)
+	go StartWatchingCRILogs(root, "", tracking, time.NewTicker(time.Hour))
+	res := <-tracking
+	if len(res) != 1 || res[0].ID != "default_web_6f1e2b54/app" {
+		t.Errorf("want the container default_web_6f1e2b54/app got %v", res)
+	}
+}
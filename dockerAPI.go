@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
@@ -16,15 +17,83 @@ type DockerClient interface {
 	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
 }
 
-func getTrackingContainer(ctx context.Context, cli DockerClient) ([]types.Container, error) {
+const (
+	kubernetesAnnotationPrefix = "annotation."
+	funkLabelPrefix            = "funk."
+	// kubernetesSandboxIDLabel is the label of the containers of a pod with the id of its pause container
+	kubernetesSandboxIDLabel = "io.kubernetes.sandbox.id"
+)
+
+// isKubernetesSandbox returns true for the pause containers holding the namespaces of a pod
+func isKubernetesSandbox(container types.Container) bool {
+	return container.Labels["io.kubernetes.docker.type"] == "podsandbox" || container.Labels["io.kubernetes.container.name"] == "POD"
+}
+
+// withKubernetesAnnotations copies the funk.* pod annotations to the container labels.
+// dockershim and cri-dockerd add the pod annotations as labels with prefix annotation. to the sandbox (pause container) of the pod,
+// it is found in sandboxes by the label io.kubernetes.sandbox.id. Annotation labels at the container itself win over the ones of the sandbox.
+// Annotations like [containername].funk.log.logs are only used for this container and win over funk.log.logs
+// Labels set at the container itself are not overwritten
+func withKubernetesAnnotations(container types.Container, sandboxes map[string]types.Container) types.Container {
+	annotations := make(map[string]string)
+	if sandbox, exist := sandboxes[container.Labels[kubernetesSandboxIDLabel]]; exist {
+		for key, value := range sandbox.Labels {
+			if strings.HasPrefix(key, kubernetesAnnotationPrefix) {
+				annotations[key] = value
+			}
+		}
+	}
+	labels := make(map[string]string)
+	for key, value := range container.Labels {
+		labels[key] = value
+		if strings.HasPrefix(key, kubernetesAnnotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	containerPrefix := kubernetesAnnotationPrefix + container.Labels["io.kubernetes.container.name"] + "."
+	for key, value := range annotations {
+		if strings.HasPrefix(key, kubernetesAnnotationPrefix+funkLabelPrefix) {
+			funkKey := strings.TrimPrefix(key, kubernetesAnnotationPrefix)
+			if _, exist := container.Labels[funkKey]; !exist {
+				if _, containerSpecific := annotations[containerPrefix+funkKey]; !containerSpecific {
+					labels[funkKey] = value
+				}
+			}
+		}
+		if strings.HasPrefix(key, containerPrefix+funkLabelPrefix) {
+			funkKey := strings.TrimPrefix(key, containerPrefix)
+			if _, exist := container.Labels[funkKey]; !exist {
+				labels[funkKey] = value
+			}
+		}
+	}
+	container.Labels = labels
+	return container
+}
+
+func getTrackingContainer(ctx context.Context, cli DockerClient, kubernetesMode bool) ([]types.Container, error) {
 	c, err := cli.ContainerList(ctx, types.ContainerListOptions{All: false})
 
 	if err != nil {
 		return nil, err
 	}
 
+	sandboxes := make(map[string]types.Container)
+	if kubernetesMode {
+		for _, one := range c {
+			if isKubernetesSandbox(one) {
+				sandboxes[one.ID] = one
+			}
+		}
+	}
 	var res []types.Container
 	for _, one := range c {
+		if kubernetesMode {
+			if isKubernetesSandbox(one) {
+				continue
+			}
+			one = withKubernetesAnnotations(one, sandboxes)
+		}
 		if one.Labels["funk.log"] == "false" {
 			continue
 		} else {
@@ -35,14 +104,14 @@ func getTrackingContainer(ctx context.Context, cli DockerClient) ([]types.Contai
 }
 
 // StartListeningForContainer start the dockercontainerwatcher in an own goroutine. It will returns the docker client and metainfos
-func StartListeningForContainer(ctx context.Context, trackingContainer chan []types.Container) (*client.Client, *types.Info, error) {
+func StartListeningForContainer(ctx context.Context, trackingContainer chan []types.Container, kubernetesMode bool) (*client.Client, *types.Info, error) {
 
 	cli, err := client.NewEnvClient()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	res, err := getTrackingContainer(ctx, cli)
+	res, err := getTrackingContainer(ctx, cli, kubernetesMode)
 	if err != nil {
 		logger.Get().Errorw("Error by getTrackingContainer: " + err.Error())
 	} else {
@@ -60,14 +129,14 @@ func StartListeningForContainer(ctx context.Context, trackingContainer chan []ty
 		}
 	}()
 
-	go readMessages(ctx, cli, msg, trackingContainer)
+	go readMessages(ctx, cli, msg, trackingContainer, kubernetesMode)
 	return cli, &info, nil
 }
 
-func readMessages(ctx context.Context, cli DockerClient, msg <-chan events.Message, trackingContainer chan []types.Container) {
+func readMessages(ctx context.Context, cli DockerClient, msg <-chan events.Message, trackingContainer chan []types.Container, kubernetesMode bool) {
 	for m := range msg {
 		if m.Type == "container" {
-			res, err := getTrackingContainer(ctx, cli)
+			res, err := getTrackingContainer(ctx, cli, kubernetesMode)
 			if err != nil {
 				logger.Get().Errorw("Error by getTrackingContainer: " + err.Error())
 				continue
@@ -39,6 +39,7 @@ func Test_readMessages(t *testing.T) {
 		want                  []types.Container
 		setContainer          []types.Container
 		dockerClientSendError bool
+		kubernetesMode        bool
 	}{
 		{
 			name: "Send message were type is not container so nothing will be returnd",
@@ -108,6 +109,73 @@ func Test_readMessages(t *testing.T) {
 			want:          nil,
 			wantContainer: true,
 		},
+		{
+			name:           "Kubernetes mode skip the pause container and use its funk annotations as labels",
+			kubernetesMode: true,
+			sendMessage: events.Message{
+				Type: "container",
+			},
+			setContainer: []types.Container{
+				types.Container{
+					ID: "pause",
+					Labels: map[string]string{
+						"io.kubernetes.docker.type":    "podsandbox",
+						"io.kubernetes.container.name": "POD",
+						"annotation.funk.log":          "true",
+						"annotation.sidecar.funk.log":  "false",
+						"annotation.funk.log.logs":     "false",
+						"annotation.funk.log.stats":    "false",
+					},
+				},
+				types.Container{
+					ID: "disabled by annotation",
+					Labels: map[string]string{
+						"io.kubernetes.docker.type":    "container",
+						"io.kubernetes.container.name": "sidecar",
+						"io.kubernetes.sandbox.id":     "pause",
+					},
+				},
+				types.Container{
+					ID: "app",
+					Labels: map[string]string{
+						"io.kubernetes.docker.type":    "container",
+						"io.kubernetes.container.name": "app",
+						"io.kubernetes.sandbox.id":     "pause",
+						"funk.log.stats":               "true",
+					},
+				},
+				types.Container{
+					ID: "other pod",
+					Labels: map[string]string{
+						"io.kubernetes.docker.type":    "container",
+						"io.kubernetes.container.name": "sidecar",
+						"io.kubernetes.sandbox.id":     "other",
+					},
+				},
+			},
+			want: []types.Container{
+				types.Container{
+					ID: "app",
+					Labels: map[string]string{
+						"io.kubernetes.docker.type":    "container",
+						"io.kubernetes.container.name": "app",
+						"io.kubernetes.sandbox.id":     "pause",
+						"funk.log":                     "true",
+						"funk.log.logs":                "false",
+						"funk.log.stats":               "true",
+					},
+				},
+				types.Container{
+					ID: "other pod",
+					Labels: map[string]string{
+						"io.kubernetes.docker.type":    "container",
+						"io.kubernetes.container.name": "sidecar",
+						"io.kubernetes.sandbox.id":     "other",
+					},
+				},
+			},
+			wantContainer: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -119,7 +187,7 @@ func Test_readMessages(t *testing.T) {
 			msg := make(chan events.Message, 1)
 			msg <- tt.sendMessage
 			tracking := make(chan []types.Container)
-			go readMessages(context.Background(), &cli, msg, tracking)
+			go readMessages(context.Background(), &cli, msg, tracking, tt.kubernetesMode)
 			if tt.wantContainer == false {
 				if len(tracking) != 0 {
 					t.Errorf("Want no feedback but got one %v", tracking)
@@ -1,143 +1,375 @@
 package geoipdbupdater
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/fasibio/funk_agent/logger"
 	"github.com/mholt/archiver"
+	"github.com/oschwald/maxminddb-golang"
 )
 
-type geoIPurlParams struct {
-	AssetPath     string
-	MaxmindFolder string
+const (
+	// DownloadURL is the maxmind download url used with account id and license key. Params are edition and suffix
+	DownloadURL = "https://download.maxmind.com/geoip/databases/%s/download?suffix=%s"
+	// LegacyDownloadURL is the maxmind download url used with license key only. Params are edition, suffix and license key
+	LegacyDownloadURL = "https://download.maxmind.com/app/geoip_download?edition_id=%s&suffix=%s&license_key=%s"
+	// DefaultEdition is the maxmind database downloaded if no edition is given
+	DefaultEdition = "GeoLite2-City"
+
+	tmpFileSuffix = ".tmp"
+)
+
+// Config describe where the maxmind databases come from
+type Config struct {
+	AccountID     string        // AccountID of the maxmind account (optional for old license keys)
+	LicenseKey    string        // LicenseKey of the maxmind account. Required to download
+	Editions      []string      // Editions to download like GeoLite2-City or GeoLite2-ASN
+	AssetPath     string        // AssetPath is the directory where the databases are stored
+	Interval      time.Duration // Interval to look for updated databases
+	LocalFiles    []string      // LocalFiles enable the offline mode. This files are watched instead of downloading
+	WatchInterval time.Duration // WatchInterval to look for changed LocalFiles
+	DownloadURL   string        // DownloadURL overwrites DownloadURL or LegacyDownloadURL (for tests)
+	Client        *http.Client
 }
 
-var DefaultGeoIPurlParams = geoIPurlParams{
+// DefaultConfig is used for all not set fields of Config
+var DefaultConfig = Config{
+	Editions:      []string{DefaultEdition},
 	AssetPath:     "./tmpassets/geoip",
-	MaxmindFolder: "geoip",
-}
-
-const DownloadURL = "https://geolite.maxmind.com/download/geoip/database/GeoLite2-City.tar.gz"
-
-func NewGEOIPUpdateTicker(geoIPReadyToUpdatePath chan string) error {
-	defaultPath := path.Join(DefaultGeoIPurlParams.AssetPath, "GeoLite2-City.mmdb")
-	stats, err := os.Stat(defaultPath)
-	if err == nil {
-		if stats.ModTime().After(time.Now().Add(24 * time.Hour)) {
-			logger.Get().Debug("GeoIpUpdateTicker: File is older than one days so update")
-			if updatedPath, err := downloadAndExtract(); err == nil {
-				geoIPReadyToUpdatePath <- updatedPath
-			} else {
-				logger.Get().Error(err)
-				return err
-			}
-		} else {
-			geoIPReadyToUpdatePath <- defaultPath
+	Interval:      24 * time.Hour,
+	WatchInterval: time.Minute,
+	Client:        http.DefaultClient,
+}
+
+func (c Config) withDefaults() Config {
+	if len(c.Editions) == 0 {
+		c.Editions = DefaultConfig.Editions
+	}
+	if c.AssetPath == "" {
+		c.AssetPath = DefaultConfig.AssetPath
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultConfig.Interval
+	}
+	if c.WatchInterval <= 0 {
+		c.WatchInterval = DefaultConfig.WatchInterval
+	}
+	if c.Client == nil {
+		c.Client = DefaultConfig.Client
+	}
+	return c
+}
+
+// IsOffline returns true if local files are watched instead of downloading
+func (c Config) IsOffline() bool {
+	return len(c.LocalFiles) != 0
+}
+
+// NewGEOIPUpdateTicker sends the path of each ready to use database to geoIPReadyToUpdatePath.
+// Existing databases younger than the interval are send directly, the others are downloaded.
+// After that it looks each interval for updates. In offline mode the local files are watched for changes.
+func NewGEOIPUpdateTicker(cfg Config, geoIPReadyToUpdatePath chan string) error {
+	cfg = cfg.withDefaults()
+	if err := os.MkdirAll(cfg.AssetPath, 0755); err != nil {
+		return err
+	}
+	CleanUpOldMaxmindDBs(cfg.AssetPath)
+	if cfg.IsOffline() {
+		return watchLocalFiles(cfg, geoIPReadyToUpdatePath)
+	}
+	if cfg.LicenseKey == "" {
+		return errors.New("GeoIpUpdateTicker: a maxmind license key is needed to download databases")
+	}
+
+	var lastErr error
+	for _, edition := range cfg.Editions {
+		dbPath := databasePath(cfg, edition)
+		stats, err := os.Stat(dbPath)
+		if err == nil && time.Since(stats.ModTime()) < cfg.Interval {
+			geoIPReadyToUpdatePath <- dbPath
+			continue
 		}
-	} else {
-		if updatedPath, err := downloadAndExtract(); err == nil {
-			geoIPReadyToUpdatePath <- updatedPath
+		logger.Get().Debugw("GeoIpUpdateTicker: File is missing or older than the interval so update", "edition", edition)
+		if updated, err := downloadAndExtract(cfg, edition); err == nil {
+			if updated || stats != nil {
+				geoIPReadyToUpdatePath <- dbPath
+			}
 		} else {
-			logger.Get().Error(err)
-			return err
+			logger.Get().Errorw("GeoIpUpdateTicker: Download failed: "+err.Error(), "edition", edition)
+			lastErr = err
+			if stats != nil {
+				geoIPReadyToUpdatePath <- dbPath
+			}
 		}
 	}
 
-	ticker := time.NewTicker(27 * time.Hour)
+	ticker := time.NewTicker(cfg.Interval)
 	go func() {
 		for range ticker.C {
-			logger.Get().Infow("Start Downloading Maxmind DB")
-			if updatedPath, err := downloadAndExtract(); err == nil {
-				geoIPReadyToUpdatePath <- updatedPath
-			} else {
-				logger.Get().Error(err)
+			for _, edition := range cfg.Editions {
+				logger.Get().Infow("Start Downloading Maxmind DB", "edition", edition)
+				updated, err := downloadAndExtract(cfg, edition)
+				if err != nil {
+					logger.Get().Errorw("GeoIpUpdateTicker: Download failed: "+err.Error(), "edition", edition)
+					continue
+				}
+				if updated {
+					geoIPReadyToUpdatePath <- databasePath(cfg, edition)
+				}
 			}
 		}
 	}()
-	return nil
+	return lastErr
 }
 
-func extractFilename(contentDisposition string) string {
-	dlFilename := strings.Split(contentDisposition, "filename=")[1]
-	dlFilename = strings.Split(dlFilename, ".tar.gz")[0]
-	return dlFilename
+func databasePath(cfg Config, edition string) string {
+	return filepath.Join(cfg.AssetPath, edition+".mmdb")
 }
 
-func CleanUpOldMaxmindDBs(activeDBPath string, params geoIPurlParams) {
-	activeDBFilename := filepath.Base(activeDBPath)
-	filepath.Walk(params.AssetPath, func(path string, info os.FileInfo, err error) error {
-		filename := filepath.Base(path)
-		if strings.HasSuffix(path, ".dat") && filename != activeDBFilename {
+func checksumPath(cfg Config, edition string) string {
+	return filepath.Join(cfg.AssetPath, edition+".sha256")
+}
+
+// CleanUpOldMaxmindDBs removes temporary files of aborted downloads inside the asset path
+func CleanUpOldMaxmindDBs(assetPath string) {
+	filepath.Walk(assetPath, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, tmpFileSuffix) {
 			os.Remove(path)
 		}
 		return nil
 	})
 }
 
-func downloadNewGeoIPInfos() (string, error) {
-	resp, err := http.Get(DownloadURL)
+func downloadURL(cfg Config, edition, suffix string) string {
+	if cfg.DownloadURL != "" {
+		return fmt.Sprintf(cfg.DownloadURL, url.QueryEscape(edition), url.QueryEscape(suffix))
+	}
+	if cfg.AccountID == "" {
+		return fmt.Sprintf(LegacyDownloadURL, url.QueryEscape(edition), url.QueryEscape(suffix), url.QueryEscape(cfg.LicenseKey))
+	}
+	return fmt.Sprintf(DownloadURL, url.PathEscape(edition), url.QueryEscape(suffix))
+}
+
+func get(cfg Config, edition, suffix string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, downloadURL(cfg, edition, suffix), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AccountID != "" {
+		req.SetBasicAuth(cfg.AccountID, cfg.LicenseKey)
+	}
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Download of %s %s failed with status %s", edition, suffix, resp.Status)
+	}
+	return resp, nil
+}
+
+// downloadChecksum returns the sha256 published by maxmind. The file looks like "[sha256]  [filename]"
+func downloadChecksum(cfg Config, edition string) (string, error) {
+	resp, err := get(cfg, edition, "tar.gz.sha256")
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	line, err := bufio.NewReader(io.LimitReader(resp.Body, 1024)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", errors.New("Empty checksum for " + edition)
+	}
+	return strings.ToLower(fields[0]), nil
+}
 
-	dlFilename := extractFilename(resp.Header.Get("Content-Disposition"))
-	dlPath := "/tmp/" + dlFilename + ".tar.gz"
+// downloadNewGeoIPInfos downloads the archive to the asset path and verify the checksum
+func downloadNewGeoIPInfos(cfg Config, edition, checksum string) (string, error) {
+	resp, err := get(cfg, edition, "tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-	out, err := os.Create(dlPath)
+	out, err := ioutil.TempFile(cfg.AssetPath, edition+"-*.tar.gz"+tmpFileSuffix)
 	if err != nil {
 		return "", err
 	}
 	defer out.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return dlPath, err
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), resp.Body); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("Checksum mismatch for %s got %s want %s", edition, sum, checksum)
+	}
+	return out.Name(), nil
 }
 
-func downloadAndExtract() (string, error) {
-	dlPath, err := downloadNewGeoIPInfos()
-	// var err error
-	// dlPath := "/tmp/GeoIP-132eu_20190319.tar.gz"
+// downloadAndExtract downloads the edition if the published checksum differs from the last download.
+// It returns true if the database file is replaced
+func downloadAndExtract(cfg Config, edition string) (bool, error) {
+	checksum, err := downloadChecksum(cfg, edition)
 	if err != nil {
-		return "", err
+		return false, err
+	}
+	dbPath := databasePath(cfg, edition)
+	if last, err := ioutil.ReadFile(checksumPath(cfg, edition)); err == nil && string(last) == checksum {
+		if _, err := os.Stat(dbPath); err == nil {
+			now := time.Now()
+			os.Chtimes(dbPath, now, now)
+			logger.Get().Debugw("GeoIpUpdateTicker: Database is up to date", "edition", edition)
+			return false, nil
+		}
 	}
 
-	return extractDownloadedGeoIPDB(dlPath, DefaultGeoIPurlParams)
-}
+	dlPath, err := downloadNewGeoIPInfos(cfg, edition, checksum)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(dlPath)
 
-func extractDownloadedGeoIPDB(dlPath string, params geoIPurlParams) (string, error) {
-	var destinationFilename = params.AssetPath + "/GeoLite2-City.mmdb"
+	if err := extractDownloadedGeoIPDB(dlPath, dbPath); err != nil {
+		return false, err
+	}
+	return true, ioutil.WriteFile(checksumPath(cfg, edition), []byte(checksum), 0644)
+}
 
+// extractDownloadedGeoIPDB extracts the .mmdb file of the archive to a temporary file
+// and renames it to destinationFilename so readers never see a half written database
+func extractDownloadedGeoIPDB(dlPath string, destinationFilename string) error {
+	found := false
 	tz := archiver.NewTarGz()
 	err := tz.Walk(dlPath, func(f archiver.File) error {
-		if strings.HasSuffix(f.Name(), ".mmdb") {
+		if !strings.HasSuffix(f.Name(), ".mmdb") {
+			return nil
+		}
+		logger.Get().Debug("found database file in archive: ", f.Name())
+		found = true
+		return atomicWrite(destinationFilename, f)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("No .mmdb file found in " + dlPath)
+	}
+	return nil
+}
+
+func atomicWrite(destinationFilename string, r io.Reader) error {
+	return atomicWriteValidated(destinationFilename, r, nil)
+}
+
+// atomicWriteValidated writes to a temporary file and renames it to destinationFilename if validate accepts the temporary file
+func atomicWriteValidated(destinationFilename string, r io.Reader, validate func(path string) error) error {
+	targetFile, err := ioutil.TempFile(filepath.Dir(destinationFilename), filepath.Base(destinationFilename)+"-*"+tmpFileSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(targetFile, r)
+	if closeErr := targetFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && validate != nil {
+		err = validate(targetFile.Name())
+	}
+	if err != nil {
+		os.Remove(targetFile.Name())
+		return err
+	}
+	return os.Rename(targetFile.Name(), destinationFilename)
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// localDatabasePath returns the place of the copy of a local file. The hash of the directory keeps files with the same name apart
+func localDatabasePath(cfg Config, file string) string {
+	h := fnv.New32a()
+	h.Write([]byte(filepath.Dir(file)))
+	return filepath.Join(cfg.AssetPath, fmt.Sprintf("local-%08x-%v", h.Sum32(), filepath.Base(file)))
+}
 
-			logger.Get().Debug("found database file in archive: ", f.Name())
+// validateDatabase opens the file as maxmind database, so half written files are not used
+func validateDatabase(path string) error {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return err
+	}
+	return reader.Close()
+}
 
-			targetFile, err := os.OpenFile(destinationFilename, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+// watchLocalFiles copies each local file to the asset path and sends the copy.
+// Using a copy the loaded database stays valid if the mounted file is changed in place.
+// A changed file is copied after its size and modification time are the same at two polls
+// and the copy is only used if it can be opened as maxmind database. At start the files are copied at once
+func watchLocalFiles(cfg Config, geoIPReadyToUpdatePath chan string) error {
+	observed := make(map[string]fileState) // observed are the states of the last poll
+	copied := make(map[string]fileState)   // copied are the states sent or failed to validate
+	initial := true
+	check := func() error {
+		var lastErr error
+		for _, one := range cfg.LocalFiles {
+			stats, err := os.Stat(one)
 			if err != nil {
-				return err
+				lastErr = err
+				logger.Get().Errorw("GeoIpUpdateTicker: Can not read local database: "+err.Error(), "file", one)
+				continue
+			}
+			state := fileState{modTime: stats.ModTime(), size: stats.Size()}
+			previous, seen := observed[one]
+			observed[one] = state
+			if copied[one] == state || (!initial && (!seen || previous != state)) {
+				continue
 			}
-			defer targetFile.Close()
-			defer f.Close()
-			_, err = io.Copy(targetFile, f)
+			copied[one] = state
+			f, err := os.Open(one)
 			if err != nil {
-				return err
+				lastErr = err
+				continue
 			}
+			dbPath := localDatabasePath(cfg, one)
+			err = atomicWriteValidated(dbPath, f, validateDatabase)
+			f.Close()
+			if err != nil {
+				lastErr = err
+				logger.Get().Errorw("GeoIpUpdateTicker: Can not copy local database: "+err.Error(), "file", one)
+				continue
+			}
+			geoIPReadyToUpdatePath <- dbPath
 		}
-		return nil
-	})
-
-	if err != nil {
-		return "", err
+		initial = false
+		return lastErr
 	}
-
-	return destinationFilename, nil
+	err := check()
+	ticker := time.NewTicker(cfg.WatchInterval)
+	go func() {
+		for range ticker.C {
+			check()
+		}
+	}()
+	return err
 }
@@ -0,0 +1,239 @@
+package geoipdbupdater
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func buildArchive(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range map[string]string{
+		"GeoLite2-City_20200101/README.txt":         "readme",
+		"GeoLite2-City_20200101/GeoLite2-City.mmdb": content,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+type mockMaxmind struct {
+	archive   []byte
+	checksum  string
+	downloads int
+	user      string
+	password  string
+}
+
+func (m *mockMaxmind) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.user, m.password, _ = r.BasicAuth()
+	switch r.URL.Query().Get("suffix") {
+	case "tar.gz.sha256":
+		w.Write([]byte(m.checksum + "  GeoLite2-City_20200101.tar.gz\n"))
+	case "tar.gz":
+		m.downloads++
+		w.Write(m.archive)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newMockMaxmind(t *testing.T, content string) *mockMaxmind {
+	archive := buildArchive(t, content)
+	sum := sha256.Sum256(archive)
+	return &mockMaxmind{archive: archive, checksum: hex.EncodeToString(sum[:])}
+}
+
+func TestNewGEOIPUpdateTicker_Download(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "geoip")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "old.tar.gz.tmp"), []byte("aborted"), 0644)
+
+	maxmind := newMockMaxmind(t, "mockdatabase")
+	server := httptest.NewServer(maxmind)
+	defer server.Close()
+
+	cfg := Config{
+		AccountID:   "1234",
+		LicenseKey:  "mockkey",
+		AssetPath:   dir,
+		DownloadURL: server.URL + "/%s/download?suffix=%s",
+	}
+	updates := make(chan string, 5)
+	if err := NewGEOIPUpdateTicker(cfg, updates); err != nil {
+		t.Fatalf("NewGEOIPUpdateTicker() error = %v", err)
+	}
+	dbPath := filepath.Join(dir, "GeoLite2-City.mmdb")
+	if got := <-updates; got != dbPath {
+		t.Errorf("NewGEOIPUpdateTicker() send %v, want %v", got, dbPath)
+	}
+	if content, _ := ioutil.ReadFile(dbPath); string(content) != "mockdatabase" {
+		t.Errorf("Database content = %v, want mockdatabase", string(content))
+	}
+	if maxmind.user != "1234" || maxmind.password != "mockkey" {
+		t.Errorf("Wrong basic auth %v:%v", maxmind.user, maxmind.password)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.tar.gz.tmp")); !os.IsNotExist(err) {
+		t.Errorf("Temporary file of aborted download is not removed")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(files) != 0 {
+		t.Errorf("Temporary files left %v", files)
+	}
+
+	updated, err := downloadAndExtract(cfg.withDefaults(), DefaultEdition)
+	if err != nil || updated {
+		t.Errorf("downloadAndExtract() with same checksum = %v, %v want false, nil", updated, err)
+	}
+	if maxmind.downloads != 1 {
+		t.Errorf("Database downloaded %v times, want 1", maxmind.downloads)
+	}
+}
+
+func TestNewGEOIPUpdateTicker_ChecksumMismatch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "geoip")
+	defer os.RemoveAll(dir)
+
+	maxmind := newMockMaxmind(t, "mockdatabase")
+	maxmind.checksum = "0000"
+	server := httptest.NewServer(maxmind)
+	defer server.Close()
+
+	updates := make(chan string, 5)
+	err := NewGEOIPUpdateTicker(Config{
+		LicenseKey:  "mockkey",
+		AssetPath:   dir,
+		DownloadURL: server.URL + "/%s/download?suffix=%s",
+	}, updates)
+	if err == nil {
+		t.Errorf("NewGEOIPUpdateTicker() want checksum error")
+	}
+	if len(updates) != 0 {
+		t.Errorf("NewGEOIPUpdateTicker() send an update for a broken download")
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("Files left after broken download %v", files)
+	}
+}
+
+func TestNewGEOIPUpdateTicker_ExistingFreshDatabase(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "geoip")
+	defer os.RemoveAll(dir)
+	dbPath := filepath.Join(dir, "GeoLite2-City.mmdb")
+	ioutil.WriteFile(dbPath, []byte("existing"), 0644)
+
+	updates := make(chan string, 5)
+	err := NewGEOIPUpdateTicker(Config{
+		LicenseKey:  "mockkey",
+		AssetPath:   dir,
+		DownloadURL: "http://127.0.0.1:0/%s/%s",
+	}, updates)
+	if err != nil {
+		t.Fatalf("NewGEOIPUpdateTicker() error = %v", err)
+	}
+	if got := <-updates; got != dbPath {
+		t.Errorf("NewGEOIPUpdateTicker() send %v, want %v", got, dbPath)
+	}
+}
+
+// testDatabase returns a maxmind database without entries and the given database type
+func testDatabase(databaseType string) []byte {
+	// one node of two empty records with record size 24
+	res := []byte{0, 0, 1, 0, 0, 1}
+	res = append(res, make([]byte, 16)...)
+	res = append(res, "\xab\xcd\xefMaxMind.com"...)
+	res = append(res, 0xe4, 0x4a)
+	res = append(res, "node_count"...)
+	res = append(res, 0xc1, 1, 0x4b)
+	res = append(res, "record_size"...)
+	res = append(res, 0xa1, 24, 0x4a)
+	res = append(res, "ip_version"...)
+	res = append(res, 0xa1, 4, 0x4d)
+	res = append(res, "database_type"...)
+	res = append(res, byte(0x40|len(databaseType)))
+	return append(res, databaseType...)
+}
+
+func databaseType(t *testing.T, path string) string {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		t.Fatalf("%v is no valid database: %v", path, err)
+	}
+	defer reader.Close()
+	return reader.Metadata.DatabaseType
+}
+
+func TestNewGEOIPUpdateTicker_Offline(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "geoip")
+	defer os.RemoveAll(dir)
+	mounted, _ := ioutil.TempDir("", "geoipmount")
+	defer os.RemoveAll(mounted)
+	os.MkdirAll(filepath.Join(mounted, "a"), 0755)
+	os.MkdirAll(filepath.Join(mounted, "b"), 0755)
+	localFile := filepath.Join(mounted, "a", "GeoIP2-City.mmdb")
+	otherFile := filepath.Join(mounted, "b", "GeoIP2-City.mmdb")
+	ioutil.WriteFile(localFile, testDatabase("v1"), 0644)
+	ioutil.WriteFile(otherFile, testDatabase("other"), 0644)
+
+	updates := make(chan string, 5)
+	err := NewGEOIPUpdateTicker(Config{
+		AssetPath:     dir,
+		LocalFiles:    []string{localFile, otherFile},
+		WatchInterval: 10 * time.Millisecond,
+	}, updates)
+	if err != nil {
+		t.Fatalf("NewGEOIPUpdateTicker() error = %v", err)
+	}
+	dbPath, otherPath := <-updates, <-updates
+	if dbPath == otherPath || filepath.Dir(dbPath) != dir {
+		t.Errorf("NewGEOIPUpdateTicker() send %v and %v, want two copies inside %v", dbPath, otherPath, dir)
+	}
+	if got := databaseType(t, dbPath); got != "v1" {
+		t.Errorf("copy of %v has type %v, want v1", localFile, got)
+	}
+	if got := databaseType(t, otherPath); got != "other" {
+		t.Errorf("copy of %v has type %v, want other", otherFile, got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(updates) != 0 {
+		t.Errorf("Unchanged file is send again")
+	}
+
+	ioutil.WriteFile(localFile, testDatabase("version2")[:10], 0644)
+	time.Sleep(50 * time.Millisecond)
+	if len(updates) != 0 {
+		t.Errorf("Half written file is send")
+	}
+	if got := databaseType(t, dbPath); got != "v1" {
+		t.Errorf("copy has type %v after a half written file, want v1", got)
+	}
+
+	ioutil.WriteFile(localFile, testDatabase("version2"), 0644)
+	select {
+	case got := <-updates:
+		if got != dbPath || databaseType(t, got) != "version2" {
+			t.Errorf("NewGEOIPUpdateTicker() send %v, want %v with version2", got, dbPath)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Changed file is not send")
+	}
+}
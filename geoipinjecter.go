@@ -1,50 +1,359 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
 
-	"github.com/cdreier/golang-snippets/snippets"
 	"github.com/fasibio/funk_agent/geoipdbupdater"
+	"github.com/fasibio/funk_agent/jsonpath"
 	"github.com/fasibio/funk_agent/logger"
 	"github.com/oschwald/geoip2-golang"
 )
 
-var geoIPDatabase *geoip2.Reader
-var mutex sync.Mutex
+// ErrNoGeoIPDatabase is returned by GetGeoDataByIP as long as no database is loaded (like during the first download)
+var ErrNoGeoIPDatabase = errors.New("No geoip database loaded")
 
-func InitGeoIP() GeoReader {
-	snippets.EnsureDir("./tmpassets")
-	snippets.EnsureDir("./tmpassets/geoip")
+// InitGeoIP starts the download or watching of the maxmind databases in the background and returns the GeoReader using them.
+// Nothing is injected until the first database is loaded, so a slow download does not block the start
+func InitGeoIP(cfg geoipdbupdater.Config) GeoReader {
+	reader := NewGeoDataReader()
 	updateInfo := make(chan string, 2)
-	geoipdbupdater.NewGEOIPUpdateTicker(updateInfo)
-
 	go func() {
 		for newDBPath := range updateInfo {
-			mutex.Lock()
-			tmpGeoIPDatabase, err := geoip2.Open(newDBPath)
+			err := reader.Update(newDBPath)
 			if err != nil {
 				logger.Get().Error("cannot open new database file: ", err.Error(), ", no updated Database is loaded!")
 			} else {
-				geoIPDatabase = tmpGeoIPDatabase
-				geoipdbupdater.CleanUpOldMaxmindDBs(newDBPath, geoipdbupdater.DefaultGeoIPurlParams)
-				logger.Get().Info("Updated newer geoIP db table")
+				logger.Get().Infow("Updated newer geoIP db table", "file", newDBPath)
 			}
-			mutex.Unlock()
 		}
 	}()
-	return &GeoDataReader{}
+	go func() {
+		if err := geoipdbupdater.NewGEOIPUpdateTicker(cfg, updateInfo); err != nil {
+			logger.Get().Errorw("Error by loading geoip databases: " + err.Error())
+		}
+	}()
+	return reader
 }
 
+// GeoData is the result of all loaded maxmind databases for one ip address.
+// Each field is nil if the matching database is not loaded
+type GeoData struct {
+	City    *geoip2.City
+	Country *geoip2.Country
+	ASN     *geoip2.ASN
+}
+
+// GeoReader returns the geodata of an ip address
 type GeoReader interface {
-	GetGeoDataByIP(IPaddress string) (*geoip2.City, error)
+	GetGeoDataByIP(IPaddress string) (*GeoData, error)
 }
 
+// GeoIPDatabaseType is the kind of a maxmind database
+type GeoIPDatabaseType string
+
+const (
+	// GeoIPDatabaseCity is a GeoIP2/GeoLite2 City database
+	GeoIPDatabaseCity GeoIPDatabaseType = "City"
+	// GeoIPDatabaseCountry is a GeoIP2/GeoLite2 Country database
+	GeoIPDatabaseCountry GeoIPDatabaseType = "Country"
+	// GeoIPDatabaseASN is a GeoLite2 ASN or GeoIP2 ISP database
+	GeoIPDatabaseASN GeoIPDatabaseType = "ASN"
+)
+
+// GeoDataReader holds one opened maxmind database of each GeoIPDatabaseType
 type GeoDataReader struct {
+	mu        sync.RWMutex
+	databases map[GeoIPDatabaseType]*geoip2.Reader
+}
+
+// NewGeoDataReader creates a GeoDataReader without any database
+func NewGeoDataReader() *GeoDataReader {
+	return &GeoDataReader{
+		databases: make(map[GeoIPDatabaseType]*geoip2.Reader),
+	}
+}
+
+func getGeoIPDatabaseType(reader *geoip2.Reader) (GeoIPDatabaseType, error) {
+	databaseType := reader.Metadata().DatabaseType
+	switch {
+	case strings.Contains(databaseType, "City"):
+		return GeoIPDatabaseCity, nil
+	case strings.Contains(databaseType, "Country"):
+		return GeoIPDatabaseCountry, nil
+	case strings.Contains(databaseType, "ASN"), strings.Contains(databaseType, "ISP"):
+		return GeoIPDatabaseASN, nil
+	}
+	return "", errors.New("Unsupported maxmind database type " + databaseType)
+}
+
+// Update opens the database at dbPath and replace the loaded database of the same type.
+// The replaced database will be closed after no lookup use it anymore
+func (g *GeoDataReader) Update(dbPath string) error {
+	reader, err := geoip2.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	databaseType, err := getGeoIPDatabaseType(reader)
+	if err != nil {
+		reader.Close()
+		return err
+	}
+	g.mu.Lock()
+	old := g.databases[databaseType]
+	g.databases[databaseType] = reader
+	g.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// GetGeoDataByIP lookup the ip address in all loaded databases
+func (g *GeoDataReader) GetGeoDataByIP(IPaddress string) (*GeoData, error) {
+	ip := net.ParseIP(IPaddress)
+	if ip == nil {
+		return nil, errors.New("Invalid ip address " + IPaddress)
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if len(g.databases) == 0 {
+		return nil, ErrNoGeoIPDatabase
+	}
+	res := GeoData{}
+	var err error
+	if db, exist := g.databases[GeoIPDatabaseCity]; exist {
+		if res.City, err = db.City(ip); err != nil {
+			return nil, err
+		}
+	} else if db, exist := g.databases[GeoIPDatabaseCountry]; exist {
+		if res.Country, err = db.Country(ip); err != nil {
+			return nil, err
+		}
+	}
+	if db, exist := g.databases[GeoIPDatabaseASN]; exist {
+		if res.ASN, err = db.ASN(ip); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// GeoLocationFormat is the format of the injected location
+type GeoLocationFormat string
+
+// IsValidate Check current value is a valid value
+func (f GeoLocationFormat) IsValidate() bool {
+	switch f {
+	case GeoLocationFormatGeoPoint, GeoLocationFormatGeoJSON, GeoLocationFormatString:
+		return true
+	}
+	return false
+}
+
+const (
+	// GeoLocationFormatGeoPoint writes the location as elasticsearch geo_point object {"lat": 1.0, "lon": 2.0}
+	GeoLocationFormatGeoPoint GeoLocationFormat = "geo_point"
+	// GeoLocationFormatGeoJSON writes the location as GeoJSON point {"type": "Point", "coordinates": [2.0, 1.0]}
+	GeoLocationFormatGeoJSON GeoLocationFormat = "geojson"
+	// GeoLocationFormatString writes the location as string "lat,lon"
+	GeoLocationFormatString GeoLocationFormat = "string"
+)
+
+type geoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func formatGeoLocation(lat, lon float64, format GeoLocationFormat) interface{} {
+	switch format {
+	case GeoLocationFormatGeoJSON:
+		return geoJSONPoint{Type: "Point", Coordinates: [2]float64{lon, lat}}
+	case GeoLocationFormatGeoPoint:
+		return geoPoint{Lat: lat, Lon: lon}
+	}
+	return fmt.Sprintf("%v,%v", lat, lon)
 }
 
-func (g *GeoDataReader) GetGeoDataByIP(IPaddress string) (*geoip2.City, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	return geoIPDatabase.City(net.ParseIP(IPaddress))
+// getGeoDataFields returns the fields to inject. The keys are without the target prefix
+func getGeoDataFields(geodata *GeoData, format GeoLocationFormat) map[string]interface{} {
+	res := make(map[string]interface{})
+	setIfFilled := func(key string, value string) {
+		if value != "" {
+			res[key] = value
+		}
+	}
+	if geodata.City != nil {
+		res["location"] = formatGeoLocation(geodata.City.Location.Latitude, geodata.City.Location.Longitude, format)
+		res["location_timezone"] = geodata.City.Location.TimeZone
+		res["city_name"] = geodata.City.City.Names["en"]
+		res["postal_code"] = geodata.City.Postal.Code
+		res["accuracy_radius"] = geodata.City.Location.AccuracyRadius
+		setIfFilled("country_iso_code", geodata.City.Country.IsoCode)
+		setIfFilled("country_name", geodata.City.Country.Names["en"])
+		setIfFilled("continent_code", geodata.City.Continent.Code)
+		setIfFilled("continent_name", geodata.City.Continent.Names["en"])
+		if len(geodata.City.Subdivisions) != 0 {
+			setIfFilled("subdivision_iso_code", geodata.City.Subdivisions[0].IsoCode)
+			setIfFilled("subdivision_name", geodata.City.Subdivisions[0].Names["en"])
+		}
+	}
+	if geodata.Country != nil {
+		setIfFilled("country_iso_code", geodata.Country.Country.IsoCode)
+		setIfFilled("country_name", geodata.Country.Country.Names["en"])
+		setIfFilled("continent_code", geodata.Country.Continent.Code)
+		setIfFilled("continent_name", geodata.Country.Continent.Names["en"])
+	}
+	if geodata.ASN != nil && geodata.ASN.AutonomousSystemNumber != 0 {
+		res["asn"] = geodata.ASN.AutonomousSystemNumber
+		setIfFilled("as_organization", geodata.ASN.AutonomousSystemOrganization)
+	}
+	return res
+}
+
+// DefaultGeoIPTarget is the prefix for the injected geodata if no target is given
+const DefaultGeoIPTarget = "funkgeoip"
+
+// GeoIPField is one entry of label funk.log.geodatafromip.
+// Path is the path inside the logline to the ip address, Target the prefix for the injected fields
+type GeoIPField struct {
+	Path   string
+	Target string
+}
+
+// ParseGeoIPFields parse the label funk.log.geodatafromip
+// something like .client.ip,.request.headers.x-forwarded-for:xff_geo
+// Without a target the first field is written to funkgeoip the others to funkgeoip_[path]
+func ParseGeoIPFields(value string) []GeoIPField {
+	var res []GeoIPField
+	for _, one := range strings.Split(value, ",") {
+		one = strings.TrimSpace(one)
+		if one == "" {
+			continue
+		}
+		field := GeoIPField{Path: one}
+		if parts := strings.SplitN(one, ":", 2); len(parts) == 2 {
+			field.Path = strings.TrimSpace(parts[0])
+			field.Target = strings.TrimSpace(parts[1])
+		}
+		if field.Target == "" {
+			field.Target = DefaultGeoIPTarget
+			if len(res) != 0 {
+				field.Target = DefaultGeoIPTarget + "_" + strings.Join(jsonpath.Split(field.Path), "_")
+			}
+		}
+		res = append(res, field)
+	}
+	return res
+}
+
+// findPublicIP returns the first public ip address inside value.
+// value can be a single address, an address with port, a X-Forwarded-For list or a list of them
+func findPublicIP(value interface{}) (net.IP, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, one := range strings.Split(v, ",") {
+			ip := parseIP(one)
+			if ip != nil && isPublicIP(ip) {
+				return ip, true
+			}
+		}
+	case []interface{}:
+		for _, one := range v {
+			if ip, found := findPublicIP(one); found {
+				return ip, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func parseIP(value string) net.IP {
+	value = strings.TrimSpace(value)
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// nonPublicNetworks are the private networks of RFC 1918 and RFC 4193 and the shared address space of RFC 6598
+var nonPublicNetworks = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+	{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)},
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *Holder) injectGeoIpInformation(value string, fields []GeoIPField) (string, error) {
+	logger.Get().Debug("All param set to get geodata from this container")
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil || values == nil {
+		return value, errors.New("Logline is not a json object")
+	}
+	var errs []string
+	injected := false
+	for _, field := range fields {
+		ipValue, found := jsonpath.Get(values, field.Path)
+		if !found {
+			errs = append(errs, fmt.Sprintf("Field %s not found", field.Path))
+			continue
+		}
+		ip, found := findPublicIP(ipValue)
+		if !found {
+			errs = append(errs, fmt.Sprintf("Field %s has no public ip address", field.Path))
+			continue
+		}
+		geodata, err := w.GeoReader.GetGeoDataByIP(ip.String())
+		if err == ErrNoGeoIPDatabase {
+			return value, nil
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for key, one := range getGeoDataFields(geodata, w.Props.GeoLocationFormat) {
+			values[field.Target+"."+key] = one
+		}
+		injected = true
+	}
+	var err error
+	if len(errs) != 0 {
+		err = errors.New(strings.Join(errs, ", "))
+	}
+	if !injected {
+		return value, err
+	}
+	geoinjectdata, marshalErr := json.Marshal(values)
+	if marshalErr != nil {
+		return value, marshalErr
+	}
+	return string(geoinjectdata), err
 }
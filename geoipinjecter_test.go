@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+type GeoReaderMock struct {
+	requestedIPs []string
+}
+
+func (g *GeoReaderMock) GetGeoDataByIP(IPaddress string) (*GeoData, error) {
+	g.requestedIPs = append(g.requestedIPs, IPaddress)
+	if IPaddress == "198.51.100.99" {
+		return nil, errors.New("Mock error")
+	}
+	res := geoip2.City{}
+	res.City.Names = map[string]string{"en": "Mockcity"}
+	res.Location.Latitude = 1.5
+	res.Location.Longitude = 2.5
+	res.Location.TimeZone = "Europe/Berlin"
+	res.Location.AccuracyRadius = 10
+	res.Postal.Code = "12345"
+	return &GeoData{City: &res}, nil
+}
+
+func TestParseGeoIPFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []GeoIPField
+	}{
+		{
+			name:  "empty label",
+			value: "",
+			want:  nil,
+		},
+		{
+			name:  "single field use default target",
+			value: ".RequestAddr",
+			want:  []GeoIPField{{Path: ".RequestAddr", Target: "funkgeoip"}},
+		},
+		{
+			name:  "multiple fields with and without target",
+			value: ".client.ip, .request.headers.x-forwarded-for:xff_geo, .remote",
+			want: []GeoIPField{
+				{Path: ".client.ip", Target: "funkgeoip"},
+				{Path: ".request.headers.x-forwarded-for", Target: "xff_geo"},
+				{Path: ".remote", Target: "funkgeoip_remote"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseGeoIPFields(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGeoIPFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHolder_injectGeoIpInformation(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		fields    string
+		want      string
+		wantIPs   []string
+		wantError bool
+	}{
+		{
+			name:    "flat root field",
+			value:   `{"RequestAddr":"203.0.113.5"}`,
+			fields:  ".RequestAddr",
+			want:    `{"RequestAddr":"203.0.113.5","funkgeoip.accuracy_radius":10,"funkgeoip.city_name":"Mockcity","funkgeoip.location":{"lat":1.5,"lon":2.5},"funkgeoip.location_timezone":"Europe/Berlin","funkgeoip.postal_code":"12345"}`,
+			wantIPs: []string{"203.0.113.5"},
+		},
+		{
+			name:    "nested x-forwarded-for takes first public address and use the target",
+			value:   `{"request":{"headers":{"x-forwarded-for":"10.0.0.1, 203.0.113.7, 198.51.100.1"}}}`,
+			fields:  ".request.headers.x-forwarded-for:xff",
+			want:    `{"request":{"headers":{"x-forwarded-for":"10.0.0.1, 203.0.113.7, 198.51.100.1"}},"xff.accuracy_radius":10,"xff.city_name":"Mockcity","xff.location":{"lat":1.5,"lon":2.5},"xff.location_timezone":"Europe/Berlin","xff.postal_code":"12345"}`,
+			wantIPs: []string{"203.0.113.7"},
+		},
+		{
+			name:    "address with port inside a list",
+			value:   `{"client":{"ip":["192.168.1.1:80","[2001:db8::1]:443"]}}`,
+			fields:  ".client.ip:c",
+			want:    `{"c.accuracy_radius":10,"c.city_name":"Mockcity","c.location":{"lat":1.5,"lon":2.5},"c.location_timezone":"Europe/Berlin","c.postal_code":"12345","client":{"ip":["192.168.1.1:80","[2001:db8::1]:443"]}}`,
+			wantIPs: []string{"2001:db8::1"},
+		},
+		{
+			name:    "big integers are not rounded",
+			value:   `{"RequestAddr":"203.0.113.5","id":9007199254740993}`,
+			fields:  ".RequestAddr",
+			want:    `{"RequestAddr":"203.0.113.5","funkgeoip.accuracy_radius":10,"funkgeoip.city_name":"Mockcity","funkgeoip.location":{"lat":1.5,"lon":2.5},"funkgeoip.location_timezone":"Europe/Berlin","funkgeoip.postal_code":"12345","id":9007199254740993}`,
+			wantIPs: []string{"203.0.113.5"},
+		},
+		{
+			name:      "one field not found the other is injected",
+			value:     `{"a":"203.0.113.5"}`,
+			fields:    ".b:b,.a:a",
+			want:      `{"a":"203.0.113.5","a.accuracy_radius":10,"a.city_name":"Mockcity","a.location":{"lat":1.5,"lon":2.5},"a.location_timezone":"Europe/Berlin","a.postal_code":"12345"}`,
+			wantIPs:   []string{"203.0.113.5"},
+			wantError: true,
+		},
+		{
+			name:      "only private addresses",
+			value:     `{"a":"10.1.2.3"}`,
+			fields:    ".a",
+			want:      `{"a":"10.1.2.3"}`,
+			wantError: true,
+		},
+		{
+			name:      "georeader returns an error",
+			value:     `{"a":"198.51.100.99"}`,
+			fields:    ".a",
+			want:      `{"a":"198.51.100.99"}`,
+			wantIPs:   []string{"198.51.100.99"},
+			wantError: true,
+		},
+		{
+			name:      "line is not an object",
+			value:     `["203.0.113.5"]`,
+			fields:    ".a",
+			want:      `["203.0.113.5"]`,
+			wantError: true,
+		},
+		{
+			name:      "line is not json",
+			value:     `no json`,
+			fields:    ".a",
+			want:      `no json`,
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := GeoReaderMock{}
+			w := &Holder{GeoReader: &reader, Props: Props{GeoLocationFormat: GeoLocationFormatGeoPoint}}
+			got, err := w.injectGeoIpInformation(tt.value, ParseGeoIPFields(tt.fields))
+			if (err != nil) != tt.wantError {
+				t.Errorf("injectGeoIpInformation() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("injectGeoIpInformation() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(reader.requestedIPs, tt.wantIPs) {
+				t.Errorf("injectGeoIpInformation() requested ips %v, want %v", reader.requestedIPs, tt.wantIPs)
+			}
+		})
+	}
+}
+
+func TestHolder_injectGeoIpInformation_NoDatabase(t *testing.T) {
+	w := &Holder{GeoReader: NewGeoDataReader()}
+	value := `{"a":"203.0.113.5"}`
+	got, err := w.injectGeoIpInformation(value, ParseGeoIPFields(".a"))
+	if err != nil || got != value {
+		t.Errorf("injectGeoIpInformation() without database = %v, %v, want the unchanged line", got, err)
+	}
+}
+
+func TestGetGeoDataFields(t *testing.T) {
+	city := geoip2.City{}
+	city.Location.Latitude = 1.5
+	city.Location.Longitude = 2.5
+	city.City.Names = map[string]string{"en": "Mockcity"}
+	city.Country.IsoCode = "DE"
+	city.Country.Names = map[string]string{"en": "Germany"}
+	city.Continent.Code = "EU"
+	city.Continent.Names = map[string]string{"en": "Europe"}
+	country := geoip2.Country{}
+	country.Country.IsoCode = "FR"
+	country.Continent.Code = "EU"
+	tests := []struct {
+		name    string
+		geodata GeoData
+		format  GeoLocationFormat
+		want    map[string]interface{}
+	}{
+		{
+			name:    "city and asn as geojson",
+			geodata: GeoData{City: &city, ASN: &geoip2.ASN{AutonomousSystemNumber: 3320, AutonomousSystemOrganization: "Mock AG"}},
+			format:  GeoLocationFormatGeoJSON,
+			want: map[string]interface{}{
+				"location":          geoJSONPoint{Type: "Point", Coordinates: [2]float64{2.5, 1.5}},
+				"location_timezone": "",
+				"city_name":         "Mockcity",
+				"postal_code":       "",
+				"accuracy_radius":   uint16(0),
+				"country_iso_code":  "DE",
+				"country_name":      "Germany",
+				"continent_code":    "EU",
+				"continent_name":    "Europe",
+				"asn":               uint(3320),
+				"as_organization":   "Mock AG",
+			},
+		},
+		{
+			name:    "city with the default string location",
+			geodata: GeoData{City: &city},
+			want: map[string]interface{}{
+				"location":          "1.5,2.5",
+				"location_timezone": "",
+				"city_name":         "Mockcity",
+				"postal_code":       "",
+				"accuracy_radius":   uint16(0),
+				"country_iso_code":  "DE",
+				"country_name":      "Germany",
+				"continent_code":    "EU",
+				"continent_name":    "Europe",
+			},
+		},
+		{
+			name:    "only country database without location",
+			geodata: GeoData{Country: &country, ASN: &geoip2.ASN{}},
+			format:  GeoLocationFormatGeoPoint,
+			want: map[string]interface{}{
+				"country_iso_code": "FR",
+				"continent_code":   "EU",
+			},
+		},
+		{
+			name:    "city as string",
+			geodata: GeoData{City: &city},
+			format:  GeoLocationFormatString,
+			want: map[string]interface{}{
+				"location":          "1.5,2.5",
+				"location_timezone": "",
+				"city_name":         "Mockcity",
+				"postal_code":       "",
+				"accuracy_radius":   uint16(0),
+				"country_iso_code":  "DE",
+				"country_name":      "Germany",
+				"continent_code":    "EU",
+				"continent_name":    "Europe",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getGeoDataFields(&tt.geodata, tt.format); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getGeoDataFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"203.0.113.5":     true,
+		"2001:db8::1":     true,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"172.32.0.1":      true,
+		"192.168.1.1":     false,
+		"100.64.0.1":      false,
+		"127.0.0.1":       false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::":              false,
+		"224.0.0.1":       false,
+		"::ffff:10.0.0.1": false,
+	}
+	for ip, want := range tests {
+		if got := isPublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isPublicIP(%v) = %v, want %v", ip, got, want)
+		}
+	}
+}
@@ -22,7 +22,7 @@ require (
 	github.com/nwaples/rardecode v1.0.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
 	github.com/oschwald/geoip2-golang v1.3.0
-	github.com/oschwald/maxminddb-golang v1.5.0 // indirect
+	github.com/oschwald/maxminddb-golang v1.5.0
 	github.com/pierrec/lz4 v2.3.0+incompatible // indirect
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/urfave/cli v1.20.0
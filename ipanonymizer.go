@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/fasibio/funk_agent/jsonpath"
+)
+
+// AnonymizeIPMode is the value of label funk.log.anonymizeip
+type AnonymizeIPMode string
+
+const (
+	// AnonymizeIPTruncate set the last bits of the address to zero (IPv4 /24, IPv6 /48)
+	AnonymizeIPTruncate AnonymizeIPMode = "truncate"
+	// AnonymizeIPHash replace the address with a HMAC-SHA256 keyed by the secret file
+	AnonymizeIPHash AnonymizeIPMode = "hash"
+	// AnonymizeIPRemove removes the field
+	AnonymizeIPRemove AnonymizeIPMode = "remove"
+)
+
+var (
+	ipv4TruncateMask = net.CIDRMask(24, 32)
+	ipv6TruncateMask = net.CIDRMask(48, 128)
+)
+
+// IPAnonymizer anonymize the ip addresses of a logline after the geodata is injected
+type IPAnonymizer struct {
+	Mode   AnonymizeIPMode
+	Fields []string
+	secret []byte
+}
+
+// NewIPAnonymizer parse the label funk.log.anonymizeip like truncate or hash:.client.ip,.remote
+// The paths of funk.log.geodatafromip are always anonymized, the paths behind : are added.
+// It returns nil if the label is not set
+func NewIPAnonymizer(value string, geoIPFields []GeoIPField, secret []byte) (*IPAnonymizer, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	res := IPAnonymizer{
+		Mode:   AnonymizeIPMode(value),
+		secret: secret,
+	}
+	if parts := strings.SplitN(value, ":", 2); len(parts) == 2 {
+		res.Mode = AnonymizeIPMode(strings.TrimSpace(parts[0]))
+		res.Fields = splitList(parts[1])
+	}
+	switch res.Mode {
+	case AnonymizeIPTruncate, AnonymizeIPRemove:
+	case AnonymizeIPHash:
+		if len(secret) == 0 {
+			return nil, errors.New("anonymizeip hash needs a secret (ANONYMIZE_IP_SECRET_FILE)")
+		}
+	default:
+		return nil, errors.New("anonymizeip has no valid mode " + string(res.Mode))
+	}
+	for _, one := range geoIPFields {
+		res.Fields = append(res.Fields, one.Path)
+	}
+	return &res, nil
+}
+
+// Anonymize returns the logline with all configured ip fields anonymized
+func (a *IPAnonymizer) Anonymize(value string) (string, error) {
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil || values == nil {
+		return value, errors.New("Logline is not a json object")
+	}
+	changed := false
+	for _, field := range a.Fields {
+		fieldValue, found := jsonpath.Get(values, field)
+		if !found {
+			continue
+		}
+		if a.Mode == AnonymizeIPRemove {
+			changed = jsonpath.Delete(values, field) || changed
+			continue
+		}
+		changed = jsonpath.Set(values, field, a.anonymizeValue(fieldValue)) || changed
+	}
+	if !changed {
+		return value, nil
+	}
+	res, err := json.Marshal(values)
+	if err != nil {
+		return value, err
+	}
+	return string(res), nil
+}
+
+// anonymizeValue replace all addresses inside a single value, a X-Forwarded-For list or a list of them
+func (a *IPAnonymizer) anonymizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		parts := strings.Split(v, ",")
+		for i, one := range parts {
+			parts[i] = a.anonymizeAddress(one)
+		}
+		return strings.Join(parts, ",")
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, one := range v {
+			res[i] = a.anonymizeValue(one)
+		}
+		return res
+	}
+	return value
+}
+
+func (a *IPAnonymizer) anonymizeAddress(value string) string {
+	trimmed := strings.TrimSpace(value)
+	host, port, err := net.SplitHostPort(trimmed)
+	if err != nil {
+		host, port = trimmed, ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return value
+	}
+	res := a.anonymizeIP(ip)
+	if port != "" {
+		res = net.JoinHostPort(res, port)
+	}
+	return strings.Replace(value, trimmed, res, 1)
+}
+
+func (a *IPAnonymizer) anonymizeIP(ip net.IP) string {
+	if a.Mode == AnonymizeIPHash {
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write([]byte(ip.String()))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(ipv4TruncateMask).String()
+	}
+	return ip.Mask(ipv6TruncateMask).String()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIPAnonymizer_Anonymize(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		geoIP   string
+		secret  string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "truncate ipv4 and ipv6 of geoip fields",
+			label: "truncate",
+			geoIP: ".client.ip,.remote:remote_geo",
+			value: `{"client":{"ip":"203.0.113.77"},"remote":"2001:db8:1234:5678::1"}`,
+			want:  `{"client":{"ip":"203.0.113.0"},"remote":"2001:db8:1234::"}`,
+		},
+		{
+			name:  "truncate x-forwarded-for list with ports and extra field",
+			label: "truncate:.extra",
+			geoIP: ".xff",
+			value: `{"xff":"203.0.113.77, 10.1.2.3:8080","extra":["198.51.100.4","no ip"]}`,
+			want:  `{"extra":["198.51.100.0","no ip"],"xff":"203.0.113.0, 10.1.2.0:8080"}`,
+		},
+		{
+			name:  "big integers are not rounded",
+			label: "truncate",
+			geoIP: ".ip",
+			value: `{"ip":"203.0.113.77","id":9007199254740993}`,
+			want:  `{"id":9007199254740993,"ip":"203.0.113.0"}`,
+		},
+		{
+			name:   "hash with secret",
+			label:  "hash",
+			geoIP:  ".ip",
+			secret: "mocksecret",
+			value:  `{"ip":"203.0.113.77"}`,
+			want:   `{"ip":"8b56fdecac59bb14f297439345bc8ecc0d6fedab1f3fc48c809e77432ca6d241"}`,
+		},
+		{
+			name:  "remove",
+			label: "remove",
+			geoIP: ".client.ip",
+			value: `{"client":{"ip":"203.0.113.77","port":80},"funkgeoip.city_name":"Mockcity"}`,
+			want:  `{"client":{"port":80},"funkgeoip.city_name":"Mockcity"}`,
+		},
+		{
+			name:  "field not found so value is unchanged",
+			label: "truncate",
+			geoIP: ".ip",
+			value: `{"other": "203.0.113.77"}`,
+			want:  `{"other": "203.0.113.77"}`,
+		},
+		{
+			name:    "no json object",
+			label:   "truncate",
+			geoIP:   ".ip",
+			value:   `plain text`,
+			want:    `plain text`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewIPAnonymizer(tt.label, ParseGeoIPFields(tt.geoIP), []byte(tt.secret))
+			if err != nil {
+				t.Fatalf("NewIPAnonymizer() error = %v", err)
+			}
+			got, err := a.Anonymize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Anonymize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Anonymize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewIPAnonymizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		secret  string
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "label not set", label: "", wantNil: true},
+		{name: "unknown mode", label: "mask", wantNil: true, wantErr: true},
+		{name: "hash without secret", label: "hash", wantNil: true, wantErr: true},
+		{name: "hash with secret", label: "hash", secret: "mock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewIPAnonymizer(tt.label, nil, []byte(tt.secret))
+			if (err != nil) != tt.wantErr || (got == nil) != tt.wantNil {
+				t.Errorf("NewIPAnonymizer() = %v, %v wantNil %v wantErr %v", got, err, tt.wantNil, tt.wantErr)
+			}
+		})
+	}
+}
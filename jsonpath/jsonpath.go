@@ -0,0 +1,82 @@
+package jsonpath
+
+import "strings"
+
+// Split splits a path like .request.headers.x-forwarded-for into its segments.
+// A leading dot is optional.
+func Split(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), ".")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// Get returns the value found at path inside obj.
+// Keys which contain a dot themselves (like dd.trace_id) are found as well,
+// the longest matching key wins at each level.
+func Get(obj interface{}, path string) (interface{}, bool) {
+	return get(obj, Split(path))
+}
+
+func get(obj interface{}, segments []string) (interface{}, bool) {
+	if len(segments) == 0 {
+		return obj, obj != nil
+	}
+	values, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	for i := len(segments); i > 0; i-- {
+		value, exist := values[strings.Join(segments[:i], ".")]
+		if !exist {
+			continue
+		}
+		if res, found := get(value, segments[i:]); found {
+			return res, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the existing value at path inside obj. It returns false if path is not found
+func Set(obj interface{}, path string, value interface{}) bool {
+	parent, key, found := findParent(obj, Split(path))
+	if !found {
+		return false
+	}
+	parent[key] = value
+	return true
+}
+
+// Delete removes the value at path inside obj. It returns false if path is not found
+func Delete(obj interface{}, path string) bool {
+	parent, key, found := findParent(obj, Split(path))
+	if !found {
+		return false
+	}
+	delete(parent, key)
+	return true
+}
+
+// findParent returns the object holding the value of segments and the key of the value inside it
+func findParent(obj interface{}, segments []string) (map[string]interface{}, string, bool) {
+	values, ok := obj.(map[string]interface{})
+	if !ok || len(segments) == 0 {
+		return nil, "", false
+	}
+	for i := len(segments); i > 0; i-- {
+		key := strings.Join(segments[:i], ".")
+		value, exist := values[key]
+		if !exist {
+			continue
+		}
+		if i == len(segments) {
+			return values, key, true
+		}
+		if parent, res, found := findParent(value, segments[i:]); found {
+			return parent, res, true
+		}
+	}
+	return nil, "", false
+}
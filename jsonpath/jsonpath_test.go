@@ -0,0 +1,63 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func mustParse(t *testing.T, value string) map[string]interface{} {
+	var res map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestGet(t *testing.T) {
+	obj := `{"a":{"b":"nested","c.d":"dotted"},"dd.trace_id":"flat","e":["list"]}`
+	tests := []struct {
+		name      string
+		path      string
+		want      interface{}
+		wantFound bool
+	}{
+		{name: "nested with leading dot", path: ".a.b", want: "nested", wantFound: true},
+		{name: "nested without leading dot", path: "a.b", want: "nested", wantFound: true},
+		{name: "key with dot at root", path: ".dd.trace_id", want: "flat", wantFound: true},
+		{name: "key with dot nested", path: ".a.c.d", want: "dotted", wantFound: true},
+		{name: "list value", path: ".e", want: []interface{}{"list"}, wantFound: true},
+		{name: "not found", path: ".a.x", want: nil, wantFound: false},
+		{name: "path through no object", path: ".e.x", want: nil, wantFound: false},
+		{name: "empty path", path: "", want: mustParse(t, obj), wantFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := Get(mustParse(t, obj), tt.path)
+			if found != tt.wantFound || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, %v want %v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	obj := mustParse(t, `{"a":{"b":"nested"},"dd.trace_id":"flat"}`)
+	if !Set(obj, ".a.b", "changed") || !Set(obj, ".dd.trace_id", "changed") {
+		t.Errorf("Set() returns false for existing paths")
+	}
+	if Set(obj, ".a.x", "new") {
+		t.Errorf("Set() returns true for missing path")
+	}
+	want := mustParse(t, `{"a":{"b":"changed"},"dd.trace_id":"changed"}`)
+	if !reflect.DeepEqual(obj, want) {
+		t.Errorf("Set() = %v, want %v", obj, want)
+	}
+	if !Delete(obj, "a.b") || Delete(obj, "a.b") {
+		t.Errorf("Delete() returns wrong found")
+	}
+	want = mustParse(t, `{"a":{},"dd.trace_id":"changed"}`)
+	if !reflect.DeepEqual(obj, want) {
+		t.Errorf("Delete() = %v, want %v", obj, want)
+	}
+}
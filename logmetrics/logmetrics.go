@@ -0,0 +1,333 @@
+// Package logmetrics turns loglines into counters and histograms (label funk.log.metrics), so errors or status codes can be counted without aggregations inside elasticsearch
+package logmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fasibio/funk_agent/jsonpath"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// Type is the kind of metric of a Rule
+type Type string
+
+const (
+	// TypeCounter counts the matching loglines
+	TypeCounter Type = "counter"
+	// TypeHistogram takes the distribution of a numeric field of the matching loglines
+	TypeHistogram Type = "histogram"
+
+	// maxGroups is the count of groups of one rule, loglines of more groups are counted for otherGroup
+	maxGroups  = 1000
+	otherGroup = "__other__"
+)
+
+// DefaultBuckets are the upper bounds of a histogram without buckets, they fit to durations in ms
+var DefaultBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Rule is one metric of the loglines of a container like
+// {"name": "errors", "type": "counter", "match": "level=error"} or
+// {"name": "request_ms", "type": "histogram", "field": "request_ms", "by": ["status"]}
+type Rule struct {
+	Name    string    `json:"name"`
+	Type    Type      `json:"type"`
+	Match   string    `json:"match,omitempty"`   // Match are filterexpressions like funk.log.keep, without all loglines are taken
+	Field   string    `json:"field,omitempty"`   // Field is the path of the numeric value of a histogram
+	By      []string  `json:"by,omitempty"`      // By are the paths of the fields the metric is grouped by
+	Buckets []float64 `json:"buckets,omitempty"` // Buckets are the upper bounds of a histogram (default DefaultBuckets)
+}
+
+// Metric is the value of a Rule for one group
+type Metric struct {
+	Name      string            `json:"name"`
+	Type      Type              `json:"type"`
+	Groups    map[string]string `json:"groups,omitempty"` // Groups are the values of the By fields
+	Count     int64             `json:"count"`
+	PerSecond float64           `json:"per_second"`
+	Sum       float64           `json:"sum,omitempty"`
+	Min       float64           `json:"min,omitempty"`
+	Avg       float64           `json:"avg,omitempty"`
+	Max       float64           `json:"max,omitempty"`
+	Buckets   []Bucket          `json:"buckets,omitempty"` // Buckets count the values less or equal Le like prometheus, the count of all is Count
+}
+
+// Bucket is one upper bound of a histogram
+type Bucket struct {
+	Le    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// ParseRules reads the rules of the json list of label funk.log.metrics
+func ParseRules(value string) ([]Rule, error) {
+	var res []Rule
+	if err := json.Unmarshal([]byte(value), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// rule is a compiled Rule with the metrics of its groups
+type rule struct {
+	Rule
+	filter  []tracker.FilterExpression
+	current map[string]*Metric // current are the metrics since the last Take
+	total   map[string]*Metric // total are the metrics since the start
+}
+
+func compile(one Rule) (*rule, error) {
+	if !validName.MatchString(one.Name) {
+		return nil, fmt.Errorf("log metric needs a name of letters, digits and _: %q", one.Name)
+	}
+	res := &rule{Rule: one, current: make(map[string]*Metric), total: make(map[string]*Metric)}
+	switch one.Type {
+	case TypeCounter:
+	case TypeHistogram:
+		if one.Field == "" {
+			return nil, fmt.Errorf("log metric %v is a histogram without field", one.Name)
+		}
+		if len(res.Buckets) == 0 {
+			res.Buckets = DefaultBuckets
+		}
+		if !sort.Float64sAreSorted(res.Buckets) {
+			return nil, fmt.Errorf("log metric %v has unsorted buckets", one.Name)
+		}
+	default:
+		return nil, fmt.Errorf("log metric %v has no valid type (counter or histogram): %q", one.Name, one.Type)
+	}
+	for _, by := range one.By {
+		if jsonpath.Split(by) == nil {
+			return nil, fmt.Errorf("log metric %v has an empty by field", one.Name)
+		}
+	}
+	if one.Match != "" {
+		filter, err := tracker.ParseFilterExpressions(one.Match)
+		if err != nil {
+			return nil, fmt.Errorf("log metric %v: %v", one.Name, err)
+		}
+		res.filter = filter
+	}
+	return res, nil
+}
+
+func (r *rule) matches(values map[string]interface{}) bool {
+	if r.filter == nil {
+		return true
+	}
+	for _, exp := range r.filter {
+		if exp.Matches(values) {
+			return true
+		}
+	}
+	return false
+}
+
+// groups returns the values of the By fields and a key of them
+func (r *rule) groups(values map[string]interface{}) (map[string]string, string) {
+	if len(r.By) == 0 {
+		return nil, ""
+	}
+	res := make(map[string]string, len(r.By))
+	parts := make([]string, 0, len(r.By))
+	for _, by := range r.By {
+		value, _ := jsonpath.Get(values, by)
+		str := valueToString(value)
+		res[by] = str
+		parts = append(parts, str)
+	}
+	key := strings.Join(parts, "\x00")
+	if _, exist := r.total[key]; !exist && len(r.total) >= maxGroups {
+		for by := range res {
+			res[by] = otherGroup
+		}
+		key = otherGroup
+	}
+	return res, key
+}
+
+func (r *rule) newMetric(groups map[string]string) *Metric {
+	res := &Metric{Name: r.Name, Type: r.Type, Groups: groups}
+	if r.Type == TypeHistogram {
+		res.Buckets = make([]Bucket, len(r.Buckets))
+		for i, le := range r.Buckets {
+			res.Buckets[i].Le = le
+		}
+	}
+	return res
+}
+
+func (r *rule) metric(metrics map[string]*Metric, key string, groups map[string]string) *Metric {
+	res, exist := metrics[key]
+	if !exist {
+		res = r.newMetric(groups)
+		metrics[key] = res
+	}
+	return res
+}
+
+func (r *rule) observe(values map[string]interface{}) {
+	if !r.matches(values) {
+		return
+	}
+	var value float64
+	if r.Type == TypeHistogram {
+		raw, _ := jsonpath.Get(values, r.Field)
+		number, isNumber := toNumber(raw)
+		if !isNumber {
+			return
+		}
+		value = number
+	}
+	groups, key := r.groups(values)
+	add(r.metric(r.current, key, groups), value)
+	add(r.metric(r.total, key, groups), value)
+}
+
+func add(m *Metric, value float64) {
+	m.Count++
+	if m.Type != TypeHistogram {
+		return
+	}
+	if m.Count == 1 || value < m.Min {
+		m.Min = value
+	}
+	if m.Count == 1 || value > m.Max {
+		m.Max = value
+	}
+	m.Sum += value
+	m.Avg = m.Sum / float64(m.Count)
+	for i := range m.Buckets {
+		if value <= m.Buckets[i].Le {
+			m.Buckets[i].Count++
+		}
+	}
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		res, err := v.Float64()
+		return res, err == nil
+	case string:
+		res, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return res, err == nil && !math.IsNaN(res) && !math.IsInf(res, 0)
+	}
+	return 0, false
+}
+
+func valueToString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// Aggregator computes the metrics of the rules of one container
+type Aggregator struct {
+	rules []*rule
+	since time.Time
+}
+
+// NewAggregator compiles the rules, it returns an error for the first invalid rule
+func NewAggregator(rules []Rule, now time.Time) (*Aggregator, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("no log metrics given")
+	}
+	res := &Aggregator{since: now}
+	names := make(map[string]bool)
+	for _, one := range rules {
+		compiled, err := compile(one)
+		if err != nil {
+			return nil, err
+		}
+		if names[one.Name] {
+			return nil, fmt.Errorf("log metric %v is given twice", one.Name)
+		}
+		names[one.Name] = true
+		res.rules = append(res.rules, compiled)
+	}
+	return res, nil
+}
+
+// Observe adds the json loglines to the metrics, other lines are ignored
+func (a *Aggregator) Observe(lines []string) {
+	for _, line := range lines {
+		values, err := tracker.DecodeLogline(line)
+		if err != nil || values == nil {
+			continue
+		}
+		for _, r := range a.rules {
+			r.observe(values)
+		}
+	}
+}
+
+// Take returns the metrics since the last Take and starts a new intervall.
+// Metrics without groups are returned with count 0 too
+func (a *Aggregator) Take(now time.Time) []Metric {
+	seconds := now.Sub(a.since).Seconds()
+	a.since = now
+	var res []Metric
+	for _, r := range a.rules {
+		if len(r.By) == 0 {
+			r.metric(r.current, "", nil)
+		}
+		for _, m := range sorted(r.current) {
+			if seconds > 0 {
+				m.PerSecond = float64(m.Count) / seconds
+			}
+			res = append(res, m)
+		}
+		r.current = make(map[string]*Metric)
+	}
+	return res
+}
+
+// Totals returns the metrics since the start like prometheus needs them
+func (a *Aggregator) Totals() []Metric {
+	var res []Metric
+	for _, r := range a.rules {
+		if len(r.By) == 0 {
+			r.metric(r.total, "", nil)
+		}
+		res = append(res, sorted(r.total)...)
+	}
+	return res
+}
+
+// sorted returns copies of the metrics sorted by their key
+func sorted(metrics map[string]*Metric) []Metric {
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := make([]Metric, 0, len(keys))
+	for _, key := range keys {
+		m := *metrics[key]
+		m.Buckets = append([]Bucket(nil), m.Buckets...)
+		res = append(res, m)
+	}
+	return res
+}
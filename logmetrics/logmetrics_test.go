@@ -0,0 +1,99 @@
+package logmetrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewAggregator_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "no json", value: `errors`},
+		{name: "no rules", value: `[]`},
+		{name: "invalid name", value: `[{"name": "request ms", "type": "counter"}]`},
+		{name: "invalid type", value: `[{"name": "errors", "type": "gauge"}]`},
+		{name: "histogram without field", value: `[{"name": "request_ms", "type": "histogram"}]`},
+		{name: "unsorted buckets", value: `[{"name": "request_ms", "type": "histogram", "field": "ms", "buckets": [10, 5]}]`},
+		{name: "invalid match", value: `[{"name": "errors", "type": "counter", "match": "level"}]`},
+		{name: "empty by", value: `[{"name": "errors", "type": "counter", "by": [""]}]`},
+		{name: "name twice", value: `[{"name": "errors", "type": "counter"}, {"name": "errors", "type": "counter"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.value)
+			if err == nil {
+				_, err = NewAggregator(rules, time.Now())
+			}
+			if err == nil {
+				t.Errorf("NewAggregator() has no error for %v", tt.value)
+			}
+		})
+	}
+}
+
+func TestAggregator_Take(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rules, err := ParseRules(`[
+		{"name": "errors", "type": "counter", "match": "level=error"},
+		{"name": "requests", "type": "counter", "match": "status=~.", "by": ["status"]},
+		{"name": "request_ms", "type": "histogram", "field": ".request.ms", "buckets": [10, 100]}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAggregator(rules, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Observe([]string{
+		`{"level": "error", "status": 500, "request": {"ms": 200}}`,
+		`{"level": "info", "status": 200, "request": {"ms": 5}}`,
+		`{"level": "info", "status": 200, "request": {"ms": "50"}}`,
+		`{"level": "info", "request": {"ms": "fast"}}`,
+		`plain text`,
+	})
+	got := a.Take(start.Add(10 * time.Second))
+	want := []Metric{
+		{Name: "errors", Type: TypeCounter, Count: 1, PerSecond: 0.1},
+		{Name: "requests", Type: TypeCounter, Groups: map[string]string{"status": "200"}, Count: 2, PerSecond: 0.2},
+		{Name: "requests", Type: TypeCounter, Groups: map[string]string{"status": "500"}, Count: 1, PerSecond: 0.1},
+		{Name: "request_ms", Type: TypeHistogram, Count: 3, PerSecond: 0.3, Sum: 255, Min: 5, Avg: 85, Max: 200, Buckets: []Bucket{{Le: 10, Count: 1}, {Le: 100, Count: 2}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take() = %+v, want %+v", got, want)
+	}
+
+	got = a.Take(start.Add(20 * time.Second))
+	want = []Metric{
+		{Name: "errors", Type: TypeCounter},
+		{Name: "request_ms", Type: TypeHistogram, Buckets: []Bucket{{Le: 10}, {Le: 100}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take() of an empty intervall = %+v, want %+v", got, want)
+	}
+	if totals := a.Totals(); len(totals) != 4 || totals[0].Count != 1 || totals[3].Count != 3 {
+		t.Errorf("Totals() = %+v, want the counts since the start", totals)
+	}
+}
+
+func TestAggregator_maxGroups(t *testing.T) {
+	a, err := NewAggregator([]Rule{{Name: "paths", Type: TypeCounter, By: []string{"path"}}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxGroups+5; i++ {
+		a.Observe([]string{`{"path": "/` + time.Duration(i).String() + `"}`})
+	}
+	totals := a.Totals()
+	if len(totals) != maxGroups+1 {
+		t.Fatalf("Totals() has %v groups, want %v", len(totals), maxGroups+1)
+	}
+	for _, one := range totals {
+		if one.Groups["path"] == otherGroup && one.Count != 5 {
+			t.Errorf("group %v count = %v, want 5", otherGroup, one.Count)
+		}
+	}
+}
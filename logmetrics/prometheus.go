@@ -0,0 +1,112 @@
+package logmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix is added to the names of the metrics for prometheus
+const Prefix = "funk_log_"
+
+// Series is a metric with the labels of its container
+type Series struct {
+	Labels map[string]string
+	Metric Metric
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labelName makes a prometheus label name of a path like .request.status
+func labelName(path string) string {
+	res := invalidLabelChars.ReplaceAllString(strings.TrimPrefix(path, "."), "_")
+	if res == "" || (res[0] >= '0' && res[0] <= '9') {
+		res = "_" + res
+	}
+	return res
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels returns the labels sorted by name like {container="web",status="200"}. The labels of the container win over the groups
+func formatLabels(s Series, extra ...string) string {
+	labels := make(map[string]string)
+	for path, value := range s.Metric.Groups {
+		labels[labelName(path)] = value
+	}
+	for name, value := range s.Labels {
+		labels[name] = value
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+`="`+labelValueEscaper.Replace(labels[name])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricName returns the prometheus name, counters end with _total
+func metricName(m Metric) string {
+	if m.Type == TypeCounter {
+		return Prefix + m.Name + "_total"
+	}
+	return Prefix + m.Name
+}
+
+// WritePrometheus writes the series in the prometheus text format. If containers use the same name for different types only the first type is written
+func WritePrometheus(w io.Writer, series []Series) error {
+	byName := make(map[string][]Series)
+	types := make(map[string]Type)
+	var names []string
+	for _, one := range series {
+		name := metricName(one.Metric)
+		if t, exist := types[name]; !exist {
+			types[name] = one.Metric.Type
+			names = append(names, name)
+		} else if t != one.Metric.Type {
+			continue
+		}
+		byName[name] = append(byName[name], one)
+	}
+	sort.Strings(names)
+
+	out := bufio.NewWriter(w)
+	for _, name := range names {
+		list := byName[name]
+		sort.SliceStable(list, func(i, j int) bool {
+			return formatLabels(list[i]) < formatLabels(list[j])
+		})
+		fmt.Fprintf(out, "# HELP %v loglines of label funk.log.metrics\n# TYPE %v %v\n", name, name, types[name])
+		for _, one := range list {
+			if one.Metric.Type == TypeCounter {
+				fmt.Fprintf(out, "%v%v %v\n", name, formatLabels(one), one.Metric.Count)
+				continue
+			}
+			for _, bucket := range one.Metric.Buckets {
+				fmt.Fprintf(out, "%v_bucket%v %v\n", name, formatLabels(one, "le", formatFloat(bucket.Le)), bucket.Count)
+			}
+			fmt.Fprintf(out, "%v_bucket%v %v\n", name, formatLabels(one, "le", "+Inf"), one.Metric.Count)
+			fmt.Fprintf(out, "%v_sum%v %v\n", name, formatLabels(one), formatFloat(one.Metric.Sum))
+			fmt.Fprintf(out, "%v_count%v %v\n", name, formatLabels(one), one.Metric.Count)
+		}
+	}
+	return out.Flush()
+}
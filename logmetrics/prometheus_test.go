@@ -0,0 +1,38 @@
+package logmetrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	web := map[string]string{"container": "web"}
+	series := []Series{
+		{Labels: web, Metric: Metric{Name: "request_ms", Type: TypeHistogram, Count: 3, Sum: 255.5, Buckets: []Bucket{{Le: 10, Count: 1}, {Le: 100, Count: 2}}}},
+		{Labels: web, Metric: Metric{Name: "requests", Type: TypeCounter, Groups: map[string]string{".http.status": "500"}, Count: 1}},
+		{Labels: map[string]string{"container": "api \"v2\""}, Metric: Metric{Name: "requests", Type: TypeCounter, Groups: map[string]string{".http.status": "200"}, Count: 2}},
+		{Labels: web, Metric: Metric{Name: "request_ms", Type: TypeCounter, Count: 7}},
+	}
+	var got bytes.Buffer
+	if err := WritePrometheus(&got, series); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP funk_log_request_ms loglines of label funk.log.metrics
+# TYPE funk_log_request_ms histogram
+funk_log_request_ms_bucket{container="web",le="10"} 1
+funk_log_request_ms_bucket{container="web",le="100"} 2
+funk_log_request_ms_bucket{container="web",le="+Inf"} 3
+funk_log_request_ms_sum{container="web"} 255.5
+funk_log_request_ms_count{container="web"} 3
+# HELP funk_log_request_ms_total loglines of label funk.log.metrics
+# TYPE funk_log_request_ms_total counter
+funk_log_request_ms_total{container="web"} 7
+# HELP funk_log_requests_total loglines of label funk.log.metrics
+# TYPE funk_log_requests_total counter
+funk_log_requests_total{container="api \"v2\"",http_status="200"} 2
+funk_log_requests_total{container="web",http_status="500"} 1
+`
+	if got.String() != want {
+		t.Errorf("WritePrometheus() = \n%v\nwant\n%v", got.String(), want)
+	}
+}
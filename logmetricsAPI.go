@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasibio/funk_agent/logger"
+	"github.com/fasibio/funk_agent/logmetrics"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// LogMetrics keeps the aggregators of the containers with label funk.log.metrics
+type LogMetrics struct {
+	aggregators map[string]*containerAggregator
+}
+
+// containerAggregator is the aggregator of one container and the label it is created of
+type containerAggregator struct {
+	label      string
+	aggregator *logmetrics.Aggregator // aggregator is nil if the label is invalid
+	container  string
+	id         string
+}
+
+// NewLogMetrics creates an empty LogMetrics
+func NewLogMetrics() *LogMetrics {
+	return &LogMetrics{aggregators: make(map[string]*containerAggregator)}
+}
+
+// aggregator returns the aggregator of the container, it is created again if label funk.log.metrics has changed
+func (m *LogMetrics) aggregator(v tracker.TrackElement) *logmetrics.Aggregator {
+	if m == nil {
+		return nil
+	}
+	container := v.GetContainer()
+	label := container.Labels["funk.log.metrics"]
+	current, exist := m.aggregators[container.ID]
+	if exist && current.label == label {
+		return current.aggregator
+	}
+	if label == "" {
+		delete(m.aggregators, container.ID)
+		return nil
+	}
+	current = &containerAggregator{label: label, id: shortContainerID(container.ID)}
+	if len(container.Names) > 0 {
+		current.container = strings.TrimPrefix(container.Names[0], "/")
+	}
+	rules, err := logmetrics.ParseRules(label)
+	if err == nil {
+		current.aggregator, err = logmetrics.NewAggregator(rules, time.Now())
+	}
+	if err != nil {
+		getLoggerWithContainerInformation(logger.Get(), container).Errorw("Error by label funk.log.metrics, no log metrics for this container: " + err.Error())
+	}
+	m.aggregators[container.ID] = current
+	return current.aggregator
+}
+
+// Prune removes the aggregators of the containers which are not tracked anymore, so their series are not served anymore
+func (m *LogMetrics) Prune(tracked map[string]bool) {
+	if m == nil {
+		return
+	}
+	for id := range m.aggregators {
+		if !tracked[id] {
+			delete(m.aggregators, id)
+		}
+	}
+}
+
+// Observe adds the loglines of the container to its metrics
+func (m *LogMetrics) Observe(v tracker.TrackElement, lines []string) {
+	if aggregator := m.aggregator(v); aggregator != nil {
+		aggregator.Observe(lines)
+	}
+}
+
+// series returns the metrics since the start of all containers for prometheus
+func (m *LogMetrics) series() []logmetrics.Series {
+	var res []logmetrics.Series
+	for _, one := range m.aggregators {
+		if one.aggregator == nil {
+			continue
+		}
+		labels := map[string]string{"container": one.container, "container_id": one.id}
+		for _, metric := range one.aggregator.Totals() {
+			res = append(res, logmetrics.Series{Labels: labels, Metric: metric})
+		}
+	}
+	return res
+}
+
+// getLogMetricsInfo returns the log metrics of the container since the last stats
+func (w *Holder) getLogMetricsInfo(v tracker.TrackElement) *Message {
+	aggregator := w.LogMetrics.aggregator(v)
+	if aggregator == nil {
+		return nil
+	}
+	stoutlog := getLoggerWithContainerInformation(logger.Get(), v.GetContainer())
+	var data []string
+	for _, metric := range aggregator.Take(time.Now()) {
+		b, err := json.Marshal(metric)
+		if err != nil {
+			stoutlog.Warnw("Error by Marshal log metric:"+err.Error(), "metric", metric)
+			continue
+		}
+		data = append(data, string(b))
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return &Message{
+		Time:          time.Now(),
+		Type:          MessageTypeStats,
+		SubType:       MessageSubTypeLogMetrics,
+		Data:          data,
+		Attributes:    getFilledMessageAttributes(w, v),
+		SearchIndex:   v.SearchIndex() + "_log_metrics",
+		StaticContent: getStaticContent(v),
+	}
+}
+
+// StartPrometheus serves the log metrics of all containers at addr/metrics in the prometheus text format
+func (w *Holder) StartPrometheus(addr string, mu *sync.Mutex) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		series := w.LogMetrics.series()
+		mu.Unlock()
+		res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := logmetrics.WritePrometheus(res, series); err != nil {
+			logger.Get().Warnw("Error by write prometheus metrics: " + err.Error())
+		}
+	})
+	logger.Get().Infow("Serve log metrics for prometheus", "addr", listener.Addr().String())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Get().Errorw("Error by serve prometheus metrics: " + err.Error())
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logmetrics"
+	"github.com/fasibio/funk_agent/tracker"
+	"github.com/gorilla/websocket"
+)
+
+func TestHolder_getLogMetricsInfo(t *testing.T) {
+	var got []Message
+	w := &Holder{
+		Props:           Props{LogStats: StatsLogNo},
+		itSelfNamedHost: "test_unit",
+		LogMetrics:      NewLogMetrics(),
+		writeToServer: func(con *websocket.Conn, msg []Message) error {
+			got = msg
+			return nil
+		},
+	}
+	v := &TrackerMock{
+		Log: `{"level": "error", "status": 500}`,
+		Con: types.Container{ID: "0123456789abcdef", Names: []string{"/mockContainer"}, Labels: map[string]string{
+			"funk.log.metrics": `[{"name": "errors", "type": "counter", "match": "level=error", "by": ["status"]}]`,
+		}},
+	}
+	w.SaveTrackingInfo(v)
+	w.SaveStatsInfo(v)
+	if len(got) != 1 || got[0].Type != MessageTypeStats || got[0].SubType != MessageSubTypeLogMetrics || got[0].SearchIndex != "MockIndex_log_metrics" || len(got[0].Data) != 1 {
+		t.Fatalf("SaveStatsInfo() = %+v, want one log metrics message", got)
+	}
+	var metric logmetrics.Metric
+	if err := json.Unmarshal([]byte(got[0].Data[0]), &metric); err != nil {
+		t.Fatal(err)
+	}
+	if metric.Name != "errors" || metric.Count != 1 || metric.Groups["status"] != "500" {
+		t.Errorf("SaveStatsInfo() metric = %+v, want errors with count 1 for status 500", metric)
+	}
+
+	series := w.LogMetrics.series()
+	if len(series) != 1 || series[0].Labels["container"] != "mockContainer" || series[0].Labels["container_id"] != "0123456789ab" || series[0].Metric.Count != 1 {
+		t.Errorf("series() = %+v, want the total of errors with the container labels", series)
+	}
+
+	v.Con.Labels["funk.log.metrics"] = `[{"name": "errors"}]`
+	got = nil
+	w.SaveStatsInfo(v)
+	if got != nil || len(w.LogMetrics.series()) != 0 {
+		t.Errorf("SaveStatsInfo() with invalid label = %+v, want nothing", got)
+	}
+}
+
+func TestLogMetrics_Prune(t *testing.T) {
+	m := NewLogMetrics()
+	label := map[string]string{"funk.log.metrics": `[{"name": "lines", "type": "counter"}]`}
+	w := &Holder{LogMetrics: m, trackingContainers: map[string]tracker.TrackElement{
+		"kept": &TrackerMock{Con: types.Container{ID: "kept", Names: []string{"/kept"}, Labels: label}},
+	}}
+	for _, id := range []string{"kept", "removed"} {
+		m.Observe(&TrackerMock{Con: types.Container{ID: id, Names: []string{"/" + id}, Labels: label}}, []string{`{}`})
+	}
+	m.Prune(w.trackedContainerIDs())
+	if _, exist := m.aggregators["removed"]; exist || len(m.aggregators) != 1 {
+		t.Errorf("Prune() keeps the aggregators %v", m.aggregators)
+	}
+	if series := m.series(); len(series) != 1 || series[0].Labels["container"] != "kept" {
+		t.Errorf("series() after Prune() = %v, want only the kept container", series)
+	}
+	var none *LogMetrics
+	none.Prune(nil)
+}
@@ -0,0 +1,271 @@
+// Package logpattern groups log messages into templates like Drain (He et al., An Online Log Parsing Approach with Fixed Depth Tree).
+// Variable parts like numbers, ips and ids are masked with <*>, so new kinds of messages can be found without filters
+package logpattern
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Wildcard is the token of the variable parts of a template
+const Wildcard = "<*>"
+
+const (
+	defaultDepth         = 3   // defaultDepth is the depth of the tree: length, depth-2 first tokens and the clusters. Drain uses 4, but names are often the second token
+	defaultSimilarity    = 0.4 // defaultSimilarity is the part of the tokens a message has to share with a template
+	defaultMaxChildren   = 100 // defaultMaxChildren are the tokens of one node, other tokens share the wildcard node
+	defaultMaxClusters   = 1000
+	maxTokens            = 200
+	maxTemplateLength    = 1000
+	wildcardLengthSuffix = "+"
+)
+
+// masks replace the variable parts before the message is split into tokens
+var masks = []*regexp.Regexp{
+	regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+	regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`),
+	regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`),
+	regexp.MustCompile(`\b([0-9a-fA-F]{1,4}:){3,7}[0-9a-fA-F]{1,4}\b`),
+	regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`),
+	// hex words need a digit and a letter, so words like "added" or "face" are kept
+	regexp.MustCompile(`\b[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\b|\b[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\d[0-9a-fA-F]*\b`),
+	regexp.MustCompile(`\b\d+(\.\d+)*[a-zA-Z%]{0,3}\b`),
+}
+
+// Mask replaces the variable parts of the message with <*> and splits it into tokens
+func Mask(message string) []string {
+	for _, one := range masks {
+		message = one.ReplaceAllString(message, Wildcard)
+	}
+	tokens := strings.Fields(message)
+	if len(tokens) > maxTokens {
+		tokens = append(tokens[:maxTokens-1], Wildcard)
+	}
+	return tokens
+}
+
+// Cluster is one template and what is known about it
+type Cluster struct {
+	ID        string // ID is taken of the path at the tree and the masked tokens of the first message, so it does not depend on the other clusters and stays the same if the template gets more wildcards
+	tokens    []string
+	Count     int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+	seen      int64 // seen is the count since the last Take
+}
+
+// Template returns the tokens of the template joined by space
+func (c *Cluster) Template() string {
+	res := strings.Join(c.tokens, " ")
+	if len(res) > maxTemplateLength {
+		res = res[:maxTemplateLength]
+	}
+	return res
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// Miner finds the cluster of each message. It is not safe for concurrent use
+type Miner struct {
+	root        *node
+	depth       int
+	similarity  float64
+	maxChildren int
+	maxClusters int
+	clusters    map[string]*Cluster
+}
+
+// NewMiner creates a Miner with the defaults of Drain
+func NewMiner() *Miner {
+	return &Miner{
+		root:        newNode(),
+		depth:       defaultDepth,
+		similarity:  defaultSimilarity,
+		maxChildren: defaultMaxChildren,
+		maxClusters: defaultMaxClusters,
+		clusters:    make(map[string]*Cluster),
+	}
+}
+
+func hasDigit(token string) bool {
+	return strings.IndexAny(token, "0123456789") >= 0
+}
+
+// leaf returns the node of the clusters of the tokens and the keys of the nodes on the way (the count of tokens and the masked first tokens).
+// Missing nodes are created
+func (m *Miner) leaf(tokens []string) (*node, []string) {
+	key := fmt.Sprint(len(tokens))
+	if len(tokens) >= maxTokens {
+		key += wildcardLengthSuffix
+	}
+	path := []string{key}
+	current := m.child(m.root, key)
+	for i := 0; i < m.depth-2 && i < len(tokens); i++ {
+		token := tokens[i]
+		if token == Wildcard || hasDigit(token) {
+			token = Wildcard
+		} else if _, exist := current.children[token]; !exist && len(current.children) >= m.maxChildren-1 {
+			token = Wildcard
+		}
+		path = append(path, token)
+		current = m.child(current, token)
+	}
+	return current, path
+}
+
+func (m *Miner) child(parent *node, token string) *node {
+	res, exist := parent.children[token]
+	if !exist {
+		res = newNode()
+		parent.children[token] = res
+	}
+	return res
+}
+
+// similarity returns the part of equal tokens and the count of wildcards of the template
+func similarity(template, tokens []string) (float64, int) {
+	if len(template) == 0 {
+		return 1, 0
+	}
+	equal, wildcards := 0, 0
+	for i, token := range template {
+		if token == Wildcard {
+			wildcards++
+			continue
+		}
+		if token == tokens[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(template)), wildcards
+}
+
+// Add returns the cluster of the message, the template of the cluster is changed to fit the message
+func (m *Miner) Add(message string, now time.Time) *Cluster {
+	tokens := Mask(message)
+	leaf, path := m.leaf(tokens)
+	var best *Cluster
+	bestSimilarity, bestWildcards := -1.0, -1
+	for _, one := range leaf.clusters {
+		sim, wildcards := similarity(one.tokens, tokens)
+		if sim > bestSimilarity || (sim == bestSimilarity && wildcards > bestWildcards) {
+			best, bestSimilarity, bestWildcards = one, sim, wildcards
+		}
+	}
+	if best == nil || bestSimilarity < m.similarity {
+		best = m.clusterOf(leaf, path, tokens, now)
+	}
+	for i, token := range tokens {
+		if best.tokens[i] != token {
+			best.tokens[i] = Wildcard
+		}
+	}
+	best.Count++
+	best.seen++
+	best.LastSeen = now
+	return best
+}
+
+// clusterOf returns the cluster of leaf with the id of path and tokens, a new one with the template tokens is added if it does not exist.
+// The id is the hash of path and tokens, so the same message gets the same id in all agents, after a restart and after the cluster was evicted,
+// no matter which other clusters were added before.
+// A cluster with the id exists already if its template got so many wildcards that its first message is not similar anymore, then the message joins it
+func (m *Miner) clusterOf(leaf *node, path, tokens []string, now time.Time) *Cluster {
+	id := patternID(append(append([]string{}, path...), tokens...))
+	if res, exist := m.clusters[id]; exist {
+		return res
+	}
+	if len(m.clusters) >= m.maxClusters {
+		m.evict()
+	}
+	res := &Cluster{ID: id, tokens: tokens, FirstSeen: now}
+	leaf.clusters = append(leaf.clusters, res)
+	m.clusters[res.ID] = res
+	return res
+}
+
+// evict removes the cluster which was not seen for the longest time
+func (m *Miner) evict() {
+	var oldest *Cluster
+	for _, one := range m.clusters {
+		if oldest == nil || one.LastSeen.Before(oldest.LastSeen) {
+			oldest = one
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	delete(m.clusters, oldest.ID)
+	m.removeFrom(m.root, oldest)
+}
+
+func (m *Miner) removeFrom(current *node, cluster *Cluster) bool {
+	for i, one := range current.clusters {
+		if one == cluster {
+			current.clusters = append(current.clusters[:i], current.clusters[i+1:]...)
+			return true
+		}
+	}
+	for _, child := range current.children {
+		if m.removeFrom(child, cluster) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternID is a short hash of the tokens
+func patternID(tokens []string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(tokens, " ")))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Stats are the count of one pattern
+type Stats struct {
+	PatternID  string    `json:"pattern_id"`
+	Template   string    `json:"template"`
+	Count      int64     `json:"count"`       // Count is the count since the last stats
+	TotalCount int64     `json:"total_count"` // TotalCount is the count since the agent has started
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	New        bool      `json:"new"` // New is true if the pattern has been seen the first time since the last stats
+}
+
+// Take returns the stats of the patterns seen since the last Take sorted by count
+func (m *Miner) Take() []Stats {
+	var res []Stats
+	for _, one := range m.clusters {
+		if one.seen == 0 {
+			continue
+		}
+		res = append(res, Stats{
+			PatternID:  one.ID,
+			Template:   one.Template(),
+			Count:      one.seen,
+			TotalCount: one.Count,
+			FirstSeen:  one.FirstSeen,
+			LastSeen:   one.LastSeen,
+			New:        one.seen == one.Count,
+		})
+		one.seen = 0
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].PatternID < res[j].PatternID
+	})
+	return res
+}
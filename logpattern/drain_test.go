@@ -0,0 +1,130 @@
+package logpattern
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{message: "GET /users/42 took 12ms", want: "GET /users/<*> took <*>"},
+		{message: "connection from 10.0.0.12:5432 closed", want: "connection from <*> closed"},
+		{message: "request 3f2b1c4e-9a0d-4e5f-8a7b-6c5d4e3f2a1b failed", want: "request <*> failed"},
+		{message: "pointer 0xc000123456 at 2020-01-02T03:04:05.123Z", want: "pointer <*> at <*>"},
+		{message: "commit deadbeef42 added face", want: "commit <*> added face"},
+		{message: "  many   spaces ", want: "many spaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := strings.Join(Mask(tt.message), " "); got != tt.want {
+				t.Errorf("Mask() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiner_Add(t *testing.T) {
+	m := NewMiner()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	first := m.Add("user alice logged in from 10.0.0.1", now)
+	second := m.Add("user bob logged in from 10.0.0.2", now.Add(time.Second))
+	other := m.Add("disk is full", now.Add(2*time.Second))
+	if first != second {
+		t.Errorf("Add() has created two clusters for the same template")
+	}
+	if first == other {
+		t.Errorf("Add() has put different messages into one cluster")
+	}
+	if got := first.Template(); got != "user <*> logged in from <*>" {
+		t.Errorf("Template() = %q, want %q", got, "user <*> logged in from <*>")
+	}
+	if first.ID != patternID([]string{"6", "user", "user", "alice", "logged", "in", "from", Wildcard}) {
+		t.Errorf("ID = %v, want the id of the path and the first message", first.ID)
+	}
+	if again := NewMiner().Add("user alice logged in from 10.0.0.3", now); again.ID != first.ID {
+		t.Errorf("Add() of another first message in a new miner = %v, want the stable id %v", again.ID, first.ID)
+	}
+	if m.Add("user", now) == first || m.Add("user alice logged in from somewhere else", now) == first {
+		t.Errorf("Add() has put messages with another count of tokens into the cluster")
+	}
+}
+
+func TestMiner_Take(t *testing.T) {
+	m := NewMiner()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	m.Add("disk is full", now)
+	m.Add("job 1 done", now)
+	m.Add("job 2 done", now.Add(time.Second))
+	got := m.Take()
+	want := []Stats{
+		{PatternID: patternID([]string{"3", "job", "job", Wildcard, "done"}), Template: "job <*> done", Count: 2, TotalCount: 2, FirstSeen: now, LastSeen: now.Add(time.Second), New: true},
+		{PatternID: patternID([]string{"3", "disk", "disk", "is", "full"}), Template: "disk is full", Count: 1, TotalCount: 1, FirstSeen: now, LastSeen: now, New: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take() = %+v, want %+v", got, want)
+	}
+
+	m.Add("job 3 done", now.Add(time.Minute))
+	got = m.Take()
+	if len(got) != 1 || got[0].Count != 1 || got[0].TotalCount != 3 || got[0].New {
+		t.Errorf("Take() = %+v, want only the known job pattern", got)
+	}
+	if got := m.Take(); len(got) != 0 {
+		t.Errorf("Take() without messages = %+v, want nothing", got)
+	}
+}
+
+func TestMiner_maxClusters(t *testing.T) {
+	m := NewMiner()
+	m.maxClusters = 2
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	oldest := m.Add("disk is full", now)
+	m.Add("cache was cleared", now.Add(time.Second))
+	m.Add("queue got stuck", now.Add(2*time.Second))
+	if len(m.clusters) != 2 {
+		t.Fatalf("miner has %v clusters, want 2", len(m.clusters))
+	}
+	if _, exist := m.clusters[oldest.ID]; exist {
+		t.Errorf("the oldest cluster is not removed")
+	}
+	if again := m.Add("disk is full", now.Add(3*time.Second)); again == oldest || again.Count != 1 {
+		t.Errorf("Add() of a removed template = %+v, want a new cluster", again)
+	}
+}
+
+func TestMiner_Add_orderIndependentID(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	messages := []string{"job 1 done by worker", "user login failed", "job 2 done by worker", "user cart emptied", "disk sda1 is full"}
+	forward, backward := NewMiner(), NewMiner()
+	for i := range messages {
+		forward.Add(messages[i], now)
+		backward.Add(messages[len(messages)-1-i], now)
+	}
+	for _, message := range messages {
+		if got, want := backward.Add(message, now).ID, forward.Add(message, now).ID; got != want {
+			t.Errorf("ID of %q = %v in the reverse order, want %v", message, got, want)
+		}
+	}
+	if id := forward.Add("job 4 done by worker", now).ID; id != patternID([]string{"5", "job", "job", Wildcard, "done", "by", "worker"}) {
+		t.Errorf("ID = %v, want the id of the path and the first message", id)
+	}
+	if NewMiner().Add("disk is full", now).ID == NewMiner().Add("disk is empty now", now).ID {
+		t.Errorf("messages with another count of tokens have the same id")
+	}
+
+	evicted := NewMiner()
+	evicted.maxClusters = 1
+	login := evicted.Add("user login failed", now).ID
+	cart := evicted.Add("user cart emptied", now.Add(time.Second)).ID
+	if again := evicted.Add("user login failed", now.Add(2*time.Second)).ID; again != login {
+		t.Errorf("ID after evict = %v, want %v", again, login)
+	}
+	if login != forward.Add("user login failed", now).ID || cart != forward.Add("user cart emptied", now).ID {
+		t.Errorf("IDs with evict = %v %v, want the ones without", login, cart)
+	}
+}
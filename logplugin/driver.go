@@ -0,0 +1,383 @@
+package logplugin
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fasibio/funk_agent/logger"
+)
+
+const (
+	pluginContentType = "application/vnd.docker.plugins.v1+json"
+	// watcherBuffer is the count of entries a ReadLogs follower can be behind before entries are dropped for it
+	watcherBuffer = 100
+	// stopTimeout is the time StopLogging waits for the last loglines of the fifo
+	stopTimeout = 5 * time.Second
+	// historyTTL is the time the loglines of a stopped container are kept for docker logs
+	historyTTL = 24 * time.Hour
+)
+
+// Info is the information docker gives about the container at StartLogging and ReadLogs
+type Info struct {
+	Config              map[string]string `json:"Config"`
+	ContainerID         string            `json:"ContainerID"`
+	ContainerName       string            `json:"ContainerName"`
+	ContainerEntrypoint string            `json:"ContainerEntrypoint"`
+	ContainerArgs       []string          `json:"ContainerArgs"`
+	ContainerImageID    string            `json:"ContainerImageID"`
+	ContainerImageName  string            `json:"ContainerImageName"`
+	ContainerCreated    time.Time         `json:"ContainerCreated"`
+	ContainerEnv        []string          `json:"ContainerEnv"`
+	ContainerLabels     map[string]string `json:"ContainerLabels"`
+	LogPath             string            `json:"LogPath"`
+	DaemonName          string            `json:"DaemonName"`
+}
+
+// ReadConfig selects the loglines of ReadLogs (docker logs --since --until --tail --follow)
+type ReadConfig struct {
+	Since  time.Time `json:"Since"`
+	Until  time.Time `json:"Until"`
+	Tail   int       `json:"Tail"` // Tail is the count of last lines, negative for all
+	Follow bool      `json:"Follow"`
+}
+
+// Handler gets the loglines of the containers
+type Handler interface {
+	// StartLogging is called before the first logline of a container
+	StartLogging(info Info)
+	// Log is called for each complete logline of source (stdout or stderr), the parts of lines docker has split are joined
+	Log(info Info, source string, at time.Time, line string)
+	// StopLogging is called after the last logline of a container
+	StopLogging(info Info)
+}
+
+// history keeps the last loglines of a container for ReadLogs.
+// It is kept after StopLogging, so docker logs works for stopped containers, until historyTTL is over
+type history struct {
+	entries  []LogEntry
+	watchers map[chan LogEntry]bool
+	stopped  time.Time // stopped is the time of StopLogging, zero while the container is logging
+}
+
+// stream is the fifo docker writes the logs of a container to
+type stream struct {
+	info   Info
+	file   io.Closer
+	closed bool
+	done   chan struct{} // done is closed when the fifo is read to its end
+}
+
+// Driver implements the docker log driver plugin protocol (docker.logdriver/1.0).
+// Docker writes the logs to a fifo per container, the Driver reads them and gives them to the Handler
+type Driver struct {
+	handler     Handler
+	historySize int
+	mux         *http.ServeMux
+	mu          sync.Mutex
+	streams     map[string]*stream  // streams by fifo
+	histories   map[string]*history // histories by container id
+}
+
+// NewDriver creates a Driver which keeps the last historySize loglines of each container for docker logs
+func NewDriver(handler Handler, historySize int) *Driver {
+	d := &Driver{
+		handler:     handler,
+		historySize: historySize,
+		mux:         http.NewServeMux(),
+		streams:     make(map[string]*stream),
+		histories:   make(map[string]*history),
+	}
+	d.mux.HandleFunc("/Plugin.Activate", d.activate)
+	d.mux.HandleFunc("/LogDriver.StartLogging", d.startLogging)
+	d.mux.HandleFunc("/LogDriver.StopLogging", d.stopLogging)
+	d.mux.HandleFunc("/LogDriver.Capabilities", d.capabilities)
+	d.mux.HandleFunc("/LogDriver.ReadLogs", d.readLogs)
+	return d
+}
+
+// ListenAndServe serves the plugin api at the unix socket (like /run/docker/plugins/funk.sock)
+func (d *Driver) ListenAndServe(socket string) error {
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return err
+	}
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	return http.Serve(listener, d)
+}
+
+func (d *Driver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+type errResponse struct {
+	Err string `json:"Err"`
+}
+
+func writeResponse(w http.ResponseWriter, res interface{}, failed bool) {
+	w.Header().Set("Content-Type", pluginContentType)
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeResponse(w, errResponse{Err: err.Error()}, true)
+		return
+	}
+	writeResponse(w, errResponse{}, false)
+}
+
+func (d *Driver) activate(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, map[string][]string{"Implements": {"LogDriver"}}, false)
+}
+
+func (d *Driver) capabilities(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, map[string]map[string]bool{"Cap": {"ReadLogs": true}}, false)
+}
+
+type startLoggingRequest struct {
+	File string `json:"File"`
+	Info Info   `json:"Info"`
+}
+
+func (d *Driver) startLogging(w http.ResponseWriter, r *http.Request) {
+	var req startLoggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if req.File == "" || req.Info.ContainerID == "" {
+		writeResponse(w, errResponse{Err: "File and ContainerID are needed"}, true)
+		return
+	}
+	s := &stream{info: req.Info, done: make(chan struct{})}
+	d.mu.Lock()
+	d.streams[req.File] = s
+	d.expireHistories(time.Now())
+	if h, exist := d.histories[req.Info.ContainerID]; exist {
+		h.stopped = time.Time{}
+	} else {
+		d.histories[req.Info.ContainerID] = &history{watchers: make(map[chan LogEntry]bool)}
+	}
+	d.mu.Unlock()
+	d.handler.StartLogging(req.Info)
+	go d.consume(req.File, s)
+	writeErr(w, nil)
+}
+
+type stopLoggingRequest struct {
+	File string `json:"File"`
+}
+
+func (d *Driver) stopLogging(w http.ResponseWriter, r *http.Request) {
+	var req stopLoggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, err)
+		return
+	}
+	d.mu.Lock()
+	s, exist := d.streams[req.File]
+	if exist {
+		s.closed = true
+		if s.file != nil {
+			s.file.Close()
+		}
+		delete(d.streams, req.File)
+		if h, exist := d.histories[s.info.ContainerID]; exist {
+			for watcher := range h.watchers {
+				close(watcher)
+			}
+			h.watchers = make(map[chan LogEntry]bool)
+			h.stopped = time.Now()
+		}
+	}
+	d.mu.Unlock()
+	if exist {
+		select {
+		case <-s.done:
+		case <-time.After(stopTimeout):
+			logger.Get().Warnw("Log fifo is not read to its end at StopLogging", "container", s.info.ContainerName, "fifo", req.File)
+		}
+		d.handler.StopLogging(s.info)
+	}
+	writeErr(w, nil)
+}
+
+// expireHistories removes the histories of the containers stopped longer than historyTTL.
+// The caller has to hold d.mu
+func (d *Driver) expireHistories(now time.Time) {
+	for id, h := range d.histories {
+		if !h.stopped.IsZero() && now.Sub(h.stopped) > historyTTL {
+			delete(d.histories, id)
+		}
+	}
+}
+
+// consume reads the fifo until it is closed by docker or StopLogging
+func (d *Driver) consume(file string, s *stream) {
+	defer close(s.done)
+	logs := logger.Get().With("container", s.info.ContainerName, "fifo", file)
+	fifo, err := os.OpenFile(file, os.O_RDONLY, 0700)
+	if err != nil {
+		logs.Errorw("Can not open log fifo: " + err.Error())
+		return
+	}
+	d.mu.Lock()
+	if s.closed {
+		d.mu.Unlock()
+		fifo.Close()
+		return
+	}
+	s.file = fifo
+	d.mu.Unlock()
+	defer fifo.Close()
+
+	partial := make(map[string][]byte)
+	var entry LogEntry
+	for {
+		if err := ReadEntry(fifo, &entry); err != nil {
+			if err != io.EOF && !isClosed(err) {
+				logs.Warnw("Error by reading log fifo: " + err.Error())
+			}
+			return
+		}
+		line := append(partial[entry.Source], entry.Line...)
+		complete := !entry.Partial || (entry.PartialLogMetadata != nil && entry.PartialLogMetadata.Last)
+		if !complete && len(line) < maxEntrySize {
+			partial[entry.Source] = line
+			continue
+		}
+		delete(partial, entry.Source)
+		d.log(s.info, LogEntry{Source: entry.Source, TimeNano: entry.TimeNano, Line: line})
+	}
+}
+
+func isClosed(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == os.ErrClosed
+}
+
+// log saves the entry for ReadLogs and gives it to the handler
+func (d *Driver) log(info Info, entry LogEntry) {
+	d.mu.Lock()
+	if h, exist := d.histories[info.ContainerID]; exist && d.historySize > 0 {
+		h.entries = append(h.entries, entry)
+		if len(h.entries) > d.historySize {
+			h.entries = append([]LogEntry{}, h.entries[len(h.entries)-d.historySize:]...)
+		}
+		for watcher := range h.watchers {
+			select {
+			case watcher <- entry:
+			default:
+			}
+		}
+	}
+	d.mu.Unlock()
+	d.handler.Log(info, entry.Source, time.Unix(0, entry.TimeNano), string(entry.Line))
+}
+
+type readLogsRequest struct {
+	Info   Info       `json:"Info"`
+	Config ReadConfig `json:"Config"`
+}
+
+// selectEntries returns the entries matching since, until and tail
+func selectEntries(entries []LogEntry, cfg ReadConfig) []LogEntry {
+	var res []LogEntry
+	for _, one := range entries {
+		if cfg.matches(one) {
+			res = append(res, one)
+		}
+	}
+	if cfg.Tail >= 0 && len(res) > cfg.Tail {
+		res = res[len(res)-cfg.Tail:]
+	}
+	return res
+}
+
+func (cfg ReadConfig) matches(entry LogEntry) bool {
+	at := time.Unix(0, entry.TimeNano)
+	if !cfg.Since.IsZero() && at.Before(cfg.Since) {
+		return false
+	}
+	return cfg.Until.IsZero() || !at.After(cfg.Until)
+}
+
+// readLogs streams the kept loglines (docker logs) and the new ones if Follow is set
+func (d *Driver) readLogs(w http.ResponseWriter, r *http.Request) {
+	var req readLogsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, err)
+		return
+	}
+	var entries []LogEntry
+	var watcher chan LogEntry
+	d.mu.Lock()
+	if h, exist := d.histories[req.Info.ContainerID]; exist {
+		entries = selectEntries(h.entries, req.Config)
+		if req.Config.Follow && h.stopped.IsZero() {
+			watcher = make(chan LogEntry, watcherBuffer)
+			h.watchers[watcher] = true
+		}
+	}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	flusher, _ := w.(http.Flusher)
+	for i := range entries {
+		if err := WriteEntry(w, &entries[i]); err != nil {
+			d.removeWatcher(req.Info.ContainerID, watcher)
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	if watcher == nil {
+		return
+	}
+	defer d.removeWatcher(req.Info.ContainerID, watcher)
+	for {
+		select {
+		case entry, ok := <-watcher:
+			if !ok {
+				return
+			}
+			if !req.Config.Until.IsZero() && time.Unix(0, entry.TimeNano).After(req.Config.Until) {
+				return
+			}
+			if err := WriteEntry(w, &entry); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (d *Driver) removeWatcher(containerID string, watcher chan LogEntry) {
+	if watcher == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if h, exist := d.histories[containerID]; exist && h.watchers[watcher] {
+		delete(h.watchers, watcher)
+	}
+}
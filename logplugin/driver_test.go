@@ -0,0 +1,207 @@
+//go:build !windows
+// +build !windows
+
+package logplugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type handlerMock struct {
+	mu      sync.Mutex
+	started []string
+	stopped []string
+	lines   chan string
+}
+
+func (h *handlerMock) StartLogging(info Info) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.started = append(h.started, info.ContainerID)
+}
+
+func (h *handlerMock) StopLogging(info Info) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = append(h.stopped, info.ContainerID)
+}
+
+func (h *handlerMock) Log(info Info, source string, at time.Time, line string) {
+	h.lines <- info.ContainerID + " " + source + " " + at.UTC().Format(time.RFC3339Nano) + " " + line
+}
+
+func post(t *testing.T, server *httptest.Server, path string, body interface{}) *http.Response {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Post(server.URL+path, pluginContentType, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes.TrimSpace(body))
+}
+
+// TestDriver works like the docker daemon: it creates the fifo, calls StartLogging and writes the entries
+func TestDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funk_logplugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fifoPath := filepath.Join(dir, "abc")
+	if err := syscall.Mkfifo(fifoPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+	handler := &handlerMock{lines: make(chan string, 10)}
+	server := httptest.NewServer(NewDriver(handler, 2))
+	defer server.Close()
+
+	if got := readBody(t, post(t, server, "/Plugin.Activate", nil)); got != `{"Implements":["LogDriver"]}` {
+		t.Errorf("Plugin.Activate = %v", got)
+	}
+	if got := readBody(t, post(t, server, "/LogDriver.Capabilities", nil)); got != `{"Cap":{"ReadLogs":true}}` {
+		t.Errorf("LogDriver.Capabilities = %v", got)
+	}
+	if res := post(t, server, "/LogDriver.StartLogging", map[string]interface{}{"File": fifoPath}); res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("LogDriver.StartLogging without container status = %v", res.StatusCode)
+	}
+	info := Info{ContainerID: "abc", ContainerName: "/web"}
+	if got := readBody(t, post(t, server, "/LogDriver.StartLogging", map[string]interface{}{"File": fifoPath, "Info": info})); got != `{"Err":""}` {
+		t.Errorf("LogDriver.StartLogging = %v", got)
+	}
+
+	fifo, err := os.OpenFile(fifoPath, os.O_WRONLY, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fifo.Close()
+	for _, entry := range []LogEntry{
+		{Source: "stdout", TimeNano: 1, Line: []byte("first")},
+		{Source: "stdout", TimeNano: 2, Line: []byte("split "), Partial: true, PartialLogMetadata: &PartialLogEntryMetadata{ID: "x", Ordinal: 1}},
+		{Source: "stderr", TimeNano: 3, Line: []byte("error")},
+		{Source: "stdout", TimeNano: 4, Line: []byte("line"), Partial: true, PartialLogMetadata: &PartialLogEntryMetadata{ID: "x", Ordinal: 2, Last: true}},
+	} {
+		if err := WriteEntry(fifo, &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{
+		"abc stdout 1970-01-01T00:00:00.000000001Z first",
+		"abc stderr 1970-01-01T00:00:00.000000003Z error",
+		"abc stdout 1970-01-01T00:00:00.000000004Z split line",
+	} {
+		select {
+		case got := <-handler.lines:
+			if got != want {
+				t.Errorf("Log() = %v, want %v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no logline received, want %v", want)
+		}
+	}
+
+	res := post(t, server, "/LogDriver.ReadLogs", map[string]interface{}{"Info": info, "Config": ReadConfig{Tail: -1}})
+	defer res.Body.Close()
+	var lines []string
+	var entry LogEntry
+	for ReadEntry(res.Body, &entry) == nil {
+		lines = append(lines, string(entry.Line))
+	}
+	if want := []string{"error", "split line"}; len(lines) != 2 || lines[0] != want[0] || lines[1] != want[1] {
+		t.Errorf("LogDriver.ReadLogs = %v, want the last 2 lines %v", lines, want)
+	}
+
+	if got := readBody(t, post(t, server, "/LogDriver.StopLogging", map[string]interface{}{"File": fifoPath})); got != `{"Err":""}` {
+		t.Errorf("LogDriver.StopLogging = %v", got)
+	}
+	if len(handler.started) != 1 || handler.started[0] != "abc" {
+		t.Errorf("StartLogging calls = %v", handler.started)
+	}
+	if len(handler.stopped) != 1 || handler.stopped[0] != "abc" {
+		t.Errorf("StopLogging calls = %v", handler.stopped)
+	}
+	if got := readBody(t, post(t, server, "/LogDriver.ReadLogs", map[string]interface{}{"Info": info, "Config": ReadConfig{Tail: 1, Follow: true}})); !strings.Contains(got, "split line") {
+		t.Errorf("LogDriver.ReadLogs after StopLogging = %v, want the kept logline", got)
+	}
+}
+
+func TestDriver_expireHistories(t *testing.T) {
+	d := NewDriver(&handlerMock{}, 10)
+	now := time.Now()
+	d.histories["running"] = &history{}
+	d.histories["stopped"] = &history{stopped: now.Add(-time.Hour)}
+	d.histories["expired"] = &history{stopped: now.Add(-historyTTL - time.Second)}
+	d.expireHistories(now)
+	if _, exist := d.histories["expired"]; exist || len(d.histories) != 2 {
+		t.Errorf("expireHistories() keeps %v, want the running and the stopped history", d.histories)
+	}
+}
+
+func TestDriver_readLogsFollow(t *testing.T) {
+	handler := &handlerMock{lines: make(chan string, 10)}
+	d := NewDriver(handler, 10)
+	server := httptest.NewServer(d)
+	defer server.Close()
+	info := Info{ContainerID: "abc"}
+	d.histories["abc"] = &history{watchers: make(map[chan LogEntry]bool)}
+	d.streams["fifo"] = &stream{info: info, done: make(chan struct{})}
+	close(d.streams["fifo"].done)
+	d.log(info, LogEntry{TimeNano: 1, Line: []byte("old")})
+
+	res := post(t, server, "/LogDriver.ReadLogs", map[string]interface{}{"Info": info, "Config": ReadConfig{Tail: -1, Follow: true, Since: time.Unix(0, 1)}})
+	defer res.Body.Close()
+	var entry LogEntry
+	if err := ReadEntry(res.Body, &entry); err != nil || string(entry.Line) != "old" {
+		t.Fatalf("ReadLogs first entry = %s, %v", entry.Line, err)
+	}
+	d.log(info, LogEntry{TimeNano: 2, Line: []byte("new")})
+	if err := ReadEntry(res.Body, &entry); err != nil || string(entry.Line) != "new" {
+		t.Fatalf("ReadLogs followed entry = %s, %v", entry.Line, err)
+	}
+	post(t, server, "/LogDriver.StopLogging", map[string]interface{}{"File": "fifo"}).Body.Close()
+	if err := ReadEntry(res.Body, &entry); err == nil {
+		t.Errorf("ReadLogs has not ended after StopLogging")
+	}
+}
+
+func Test_selectEntries(t *testing.T) {
+	entries := []LogEntry{{TimeNano: 1}, {TimeNano: 2}, {TimeNano: 3}, {TimeNano: 4}}
+	tests := []struct {
+		name string
+		cfg  ReadConfig
+		want int
+	}{
+		{name: "all", cfg: ReadConfig{Tail: -1}, want: 4},
+		{name: "tail", cfg: ReadConfig{Tail: 1}, want: 1},
+		{name: "tail 0", cfg: ReadConfig{Tail: 0}, want: 0},
+		{name: "since and until", cfg: ReadConfig{Tail: -1, Since: time.Unix(0, 2), Until: time.Unix(0, 3)}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectEntries(entries, tt.cfg); len(got) != tt.want {
+				t.Errorf("selectEntries() = %v, want %v entries", got, tt.want)
+			}
+		})
+	}
+}
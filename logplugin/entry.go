@@ -0,0 +1,258 @@
+package logplugin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxEntrySize limits the length of one framed LogEntry (docker splits lines at 16k, the metadata is small)
+const maxEntrySize = 2 << 20
+
+// LogEntry is the protobuf message docker writes to the fifo of the log driver plugin
+// (github.com/docker/docker/api/types/plugins/logdriver/entry.proto)
+type LogEntry struct {
+	Source             string
+	TimeNano           int64
+	Line               []byte
+	Partial            bool
+	PartialLogMetadata *PartialLogEntryMetadata
+}
+
+// PartialLogEntryMetadata groups the parts of a line docker has split
+type PartialLogEntryMetadata struct {
+	Last    bool
+	ID      string
+	Ordinal int32
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// protoReader reads the fields of a protobuf message
+type protoReader struct {
+	data []byte
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errors.New("invalid protobuf varint")
+	}
+	r.data = r.data[n:]
+	return value, nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	length, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(r.data)) {
+		return nil, errors.New("protobuf field is longer than the message")
+	}
+	res := r.data[:length]
+	r.data = r.data[length:]
+	return res, nil
+}
+
+// next returns the field number and the wire type of the next field
+func (r *protoReader) next() (int, int, error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(key >> 3), int(key & 7), nil
+}
+
+// skip jumps over a field which is not known
+func (r *protoReader) skip(wireType int) error {
+	switch wireType {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case 1:
+		if len(r.data) < 8 {
+			return io.ErrUnexpectedEOF
+		}
+		r.data = r.data[8:]
+		return nil
+	case 5:
+		if len(r.data) < 4 {
+			return io.ErrUnexpectedEOF
+		}
+		r.data = r.data[4:]
+		return nil
+	}
+	return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+}
+
+// Unmarshal reads a protobuf encoded LogEntry
+func (e *LogEntry) Unmarshal(data []byte) error {
+	*e = LogEntry{}
+	r := &protoReader{data: data}
+	for len(r.data) > 0 {
+		field, wireType, err := r.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			value, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			e.Source = string(value)
+		case field == 2 && wireType == wireVarint:
+			value, err := r.varint()
+			if err != nil {
+				return err
+			}
+			e.TimeNano = int64(value)
+		case field == 3 && wireType == wireBytes:
+			value, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			e.Line = append([]byte{}, value...)
+		case field == 4 && wireType == wireVarint:
+			value, err := r.varint()
+			if err != nil {
+				return err
+			}
+			e.Partial = value != 0
+		case field == 5 && wireType == wireBytes:
+			value, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			e.PartialLogMetadata = &PartialLogEntryMetadata{}
+			if err := e.PartialLogMetadata.unmarshal(value); err != nil {
+				return err
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *PartialLogEntryMetadata) unmarshal(data []byte) error {
+	r := &protoReader{data: data}
+	for len(r.data) > 0 {
+		field, wireType, err := r.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wireType == wireVarint:
+			value, err := r.varint()
+			if err != nil {
+				return err
+			}
+			m.Last = value != 0
+		case field == 2 && wireType == wireBytes:
+			value, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			m.ID = string(value)
+		case field == 3 && wireType == wireVarint:
+			value, err := r.varint()
+			if err != nil {
+				return err
+			}
+			m.Ordinal = int32(value)
+		default:
+			if err := r.skip(wireType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendUvarint(buf []byte, value uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], value)
+	return append(buf, tmp[:n]...)
+}
+
+func appendVarintField(buf []byte, field int, value uint64) []byte {
+	buf = appendUvarint(buf, uint64(field<<3|wireVarint))
+	return appendUvarint(buf, value)
+}
+
+func appendBytesField(buf []byte, field int, value []byte) []byte {
+	buf = appendUvarint(buf, uint64(field<<3|wireBytes))
+	buf = appendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// Marshal encodes the LogEntry with protobuf (used by ReadLogs)
+func (e *LogEntry) Marshal() []byte {
+	var res []byte
+	if e.Source != "" {
+		res = appendBytesField(res, 1, []byte(e.Source))
+	}
+	if e.TimeNano != 0 {
+		res = appendVarintField(res, 2, uint64(e.TimeNano))
+	}
+	if len(e.Line) != 0 {
+		res = appendBytesField(res, 3, e.Line)
+	}
+	if e.Partial {
+		res = appendVarintField(res, 4, 1)
+	}
+	if m := e.PartialLogMetadata; m != nil {
+		var meta []byte
+		if m.Last {
+			meta = appendVarintField(meta, 1, 1)
+		}
+		if m.ID != "" {
+			meta = appendBytesField(meta, 2, []byte(m.ID))
+		}
+		if m.Ordinal != 0 {
+			meta = appendVarintField(meta, 3, uint64(m.Ordinal))
+		}
+		res = appendBytesField(res, 5, meta)
+	}
+	return res
+}
+
+// ReadEntry reads one LogEntry framed by its length (uint32 big endian) like docker writes it to the fifo
+func ReadEntry(r io.Reader, entry *LogEntry) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length > maxEntrySize {
+		return fmt.Errorf("log entry too long: %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return entry.Unmarshal(buf)
+}
+
+// WriteEntry writes the LogEntry framed by its length
+func WriteEntry(w io.Writer, entry *LogEntry) error {
+	data := entry.Marshal()
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	_, err := w.Write(append(buf, data...))
+	return err
+}
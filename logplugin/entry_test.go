@@ -0,0 +1,79 @@
+package logplugin
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestLogEntry_Unmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    LogEntry
+		wantErr bool
+	}{
+		{
+			name: "complete entry",
+			data: append(append([]byte{0x0a, 0x06}, "stdout"...), 0x10, 0x01, 0x1a, 0x02, 'h', 'i'),
+			want: LogEntry{Source: "stdout", TimeNano: 1, Line: []byte("hi")},
+		},
+		{
+			name: "partial entry with metadata and unknown field",
+			data: []byte{0x20, 0x01, 0x2a, 0x07, 0x08, 0x01, 0x12, 0x01, 'a', 0x18, 0x02, 0x30, 0x05},
+			want: LogEntry{Partial: true, PartialLogMetadata: &PartialLogEntryMetadata{Last: true, ID: "a", Ordinal: 2}},
+		},
+		{
+			name:    "field longer than message",
+			data:    []byte{0x1a, 0x05, 'h'},
+			wantErr: true,
+		},
+		{
+			name:    "broken varint",
+			data:    []byte{0x10, 0xff},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got LogEntry
+			err := got.Unmarshal(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteEntry_ReadEntry(t *testing.T) {
+	entries := []LogEntry{
+		{Source: "stdout", TimeNano: 1565614199000000001, Line: []byte(`{"message":"hello"}`)},
+		{Source: "stderr", TimeNano: 2, Line: []byte("part"), Partial: true, PartialLogMetadata: &PartialLogEntryMetadata{ID: "x", Ordinal: 1}},
+	}
+	var buf bytes.Buffer
+	for i := range entries {
+		if err := WriteEntry(&buf, &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range entries {
+		var got LogEntry
+		if err := ReadEntry(&buf, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadEntry() = %+v, want %+v", got, want)
+		}
+	}
+	var got LogEntry
+	if err := ReadEntry(&buf, &got); err != io.EOF {
+		t.Errorf("ReadEntry() at the end error = %v, want EOF", err)
+	}
+	if err := ReadEntry(bytes.NewReader([]byte{0, 0, 0, 5, 0x10}), &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadEntry() of cut entry error = %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -5,16 +5,24 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/fasibio/funk_agent/alert"
+	"github.com/fasibio/funk_agent/geoipdbupdater"
 	"github.com/fasibio/funk_agent/logger"
+	"github.com/fasibio/funk_agent/netinput"
+	"github.com/fasibio/funk_agent/nodestats"
 	"github.com/fasibio/funk_agent/tracker"
+	"github.com/fasibio/funk_agent/useragent"
 	"github.com/gorilla/websocket"
 	"github.com/urfave/cli"
 	"go.uber.org/zap"
@@ -29,6 +37,12 @@ type Holder struct {
 	trackingContainers map[string]tracker.TrackElement
 	writeToServer      Serverwriter
 	GeoReader          GeoReader
+	UserAgentParser    UserAgentParser
+	TraceExtractor     *TraceExtractor
+	Alerter            *Alerter
+	LogMetrics         *LogMetrics
+	PatternInjecter    *PatternInjecter
+	containerIndex     containerIndex // containerIndex finds the tracked containers by short id or name for the network inputs
 }
 
 // StatsLog is a param the type can check if it is set to the right value
@@ -57,6 +71,27 @@ const (
 	StatsLogNo StatsLog = "no"
 )
 
+// InputMode is the way the agent finds the containers and reads the logs
+type InputMode string
+
+// IsValidate Check current value is a valid value
+func (i InputMode) IsValidate() bool {
+	switch i {
+	case InputModeDocker, InputModeCRI, InputModePlugin:
+		return true
+	}
+	return false
+}
+
+const (
+	// InputModeDocker use the docker api
+	InputModeDocker InputMode = "docker"
+	// InputModeCRI follows the CRI log files of kubernetes (containerd, CRI-O)
+	InputModeCRI InputMode = "cri"
+	// InputModePlugin runs as docker log driver plugin, docker sends the logs to the agent
+	InputModePlugin InputMode = "plugin"
+)
+
 // Props hold all cli given information
 type Props struct {
 	funkServerURL      string
@@ -64,7 +99,14 @@ type Props struct {
 	Connectionkey      string
 	LogStats           StatsLog
 	SwarmMode          bool
+	KubernetesMode     bool
+	InputMode          InputMode
+	CRILogDir          string
 	EnableGeoIpReader  bool
+	GeoLocationFormat  GeoLocationFormat
+	AnonymizeIPSecret  []byte
+	ForwardLabels      []string
+	TrackerOptions     tracker.Options
 }
 
 const (
@@ -74,6 +116,20 @@ const (
 	ClikeyFunkserver string = "funkserver"
 	// ClikeySwarmmode see description in main methode
 	ClikeySwarmmode string = "swarmmode"
+	// ClikeyKubernetesmode see description in main methode
+	ClikeyKubernetesmode string = "kubernetesmode"
+	// ClikeyInputMode see description in main methode
+	ClikeyInputMode string = "inputmode"
+	// ClikeyCRILogDir see description in main methode
+	ClikeyCRILogDir string = "crilogdir"
+	// ClikeyCRIConfigFile see description in main methode
+	ClikeyCRIConfigFile string = "criconfigfile"
+	// ClikeyNodeName see description in main methode
+	ClikeyNodeName string = "nodename"
+	// ClikeyPluginSocket see description in main methode
+	ClikeyPluginSocket string = "pluginsocket"
+	// ClikeyPluginHistory see description in main methode
+	ClikeyPluginHistory string = "pluginhistory"
 	// ClikeyConnectionkey see description in main methode
 	ClikeyConnectionkey string = "connectionkey"
 	// ClikeyLogstats see description in main methode
@@ -82,8 +138,70 @@ const (
 	ClikeyLoglevel string = "loglevel"
 	// EnableGeoIPInject allows to get an location by ip address. This will download a database from https://www.maxmind.com
 	EnableGeoIPInject string = "enableGeoIPInject"
+	// ClikeyGeoIPLicenseKey see description in main methode
+	ClikeyGeoIPLicenseKey string = "geoiplicensekey"
+	// ClikeyGeoIPAccountID see description in main methode
+	ClikeyGeoIPAccountID string = "geoipaccountid"
+	// ClikeyGeoIPEditions see description in main methode
+	ClikeyGeoIPEditions string = "geoipeditions"
+	// ClikeyGeoIPDatabaseFiles see description in main methode
+	ClikeyGeoIPDatabaseFiles string = "geoipdatabasefiles"
+	// ClikeyGeoIPAssetDir see description in main methode
+	ClikeyGeoIPAssetDir string = "geoipassetdir"
+	// ClikeyGeoIPUpdateIntervall see description in main methode
+	ClikeyGeoIPUpdateIntervall string = "geoipupdateintervall"
+	// ClikeyGeoLocationFormat see description in main methode
+	ClikeyGeoLocationFormat string = "geolocationformat"
+	// ClikeyAnonymizeIPSecretFile see description in main methode
+	ClikeyAnonymizeIPSecretFile string = "anonymizeipsecretfile"
+	// ClikeyUserAgentRegexFile see description in main methode
+	ClikeyUserAgentRegexFile string = "useragentregexfile"
+	// ClikeyTraceIDFields see description in main methode
+	ClikeyTraceIDFields string = "traceidfields"
+	// ClikeySpanIDFields see description in main methode
+	ClikeySpanIDFields string = "spanidfields"
+	// ClikeyForwardLabels see description in main methode
+	ClikeyForwardLabels string = "forwardlabels"
+	// ClikeyFileInputsConfig see description in main methode
+	ClikeyFileInputsConfig string = "fileinputsconfig"
+	// ClikeyFileInputsCheckpoint see description in main methode
+	ClikeyFileInputsCheckpoint string = "fileinputscheckpoint"
+	// ClikeyHostRootDir see description in main methode
+	ClikeyHostRootDir string = "hostrootdir"
+	// ClikeyForwardListenAddr see description in main methode
+	ClikeyForwardListenAddr string = "forwardlistenaddr"
+	// ClikeyForwardSharedKey see description in main methode
+	ClikeyForwardSharedKey string = "forwardsharedkey"
+	// ClikeySyslogListenAddr see description in main methode
+	ClikeySyslogListenAddr string = "sysloglistenaddr"
+	// ClikeySyslogSearchIndex see description in main methode
+	ClikeySyslogSearchIndex string = "syslogsearchindex"
+	// ClikeyGELFListenAddr see description in main methode
+	ClikeyGELFListenAddr string = "gelflistenaddr"
+	// ClikeyGELFSearchIndex see description in main methode
+	ClikeyGELFSearchIndex string = "gelfsearchindex"
 	// StatsIntervall set the second where statsinfo will be send
 	StatsIntervall string = "statsintervall"
+	// ClikeyStatsSource see description in main methode
+	ClikeyStatsSource string = "statssource"
+	// ClikeyNodeStats see description in main methode
+	ClikeyNodeStats string = "nodestats"
+	// ClikeyNodeStatsSearchIndex see description in main methode
+	ClikeyNodeStatsSearchIndex string = "nodestatssearchindex"
+	// ClikeyMinLogLevel see description in main methode
+	ClikeyMinLogLevel string = "minloglevel"
+	// ClikeyAlertRulesConfig see description in main methode
+	ClikeyAlertRulesConfig string = "alertrulesconfig"
+	// ClikeyAlertWebhookURL see description in main methode
+	ClikeyAlertWebhookURL string = "alertwebhookurl"
+	// ClikeyLogPatterns see description in main methode
+	ClikeyLogPatterns string = "logpatterns"
+	// ClikeyPrometheusListenAddr see description in main methode
+	ClikeyPrometheusListenAddr string = "prometheuslistenaddr"
+	// SnapshotIntervall set the second where the processes and disk usage of the containers will be send
+	SnapshotIntervall string = "snapshotintervall"
+	// FilterReportIntervall set the second where the count of filtered loglines will be reported
+	FilterReportIntervall string = "filterreportintervall"
 )
 
 func main() {
@@ -107,6 +225,45 @@ func main() {
 			EnvVar: "SWARM_MODE",
 			Usage:  "Set this field if the agent runs on a swarm cluster host to optimize the outputs of metadata",
 		},
+		cli.BoolFlag{
+			Name:   ClikeyKubernetesmode,
+			EnvVar: "KUBERNETES_MODE",
+			Usage:  "Set this field if the agent runs on a kubernetes node with docker (dockershim/cri-dockerd) to get the pod metadata and skip the pause containers",
+		},
+		cli.StringFlag{
+			Name:   ClikeyInputMode,
+			EnvVar: "INPUT_MODE",
+			Value:  string(InputModeDocker),
+			Usage:  "docker: find the containers by the docker api, cri: follow the kubernetes CRI log files at crilogdir (containerd, CRI-O), plugin: run as docker log driver plugin",
+		},
+		cli.StringFlag{
+			Name:   ClikeyCRILogDir,
+			EnvVar: "CRI_LOG_DIR",
+			Value:  "/var/log/pods",
+			Usage:  "directory of the kubernetes pod logs for inputmode cri",
+		},
+		cli.StringFlag{
+			Name:   ClikeyCRIConfigFile,
+			EnvVar: "CRI_CONFIG_FILE",
+			Usage:  "json file with the funk labels of the namespaces, pods and containers for inputmode cri, it is read again on changes",
+		},
+		cli.StringFlag{
+			Name:   ClikeyNodeName,
+			EnvVar: "NODE_NAME",
+			Usage:  "hostname for inputmode cri and plugin, default is the hostname of the agent",
+		},
+		cli.StringFlag{
+			Name:   ClikeyPluginSocket,
+			EnvVar: "PLUGIN_SOCKET",
+			Value:  "/run/docker/plugins/funk.sock",
+			Usage:  "unix socket of the docker log driver plugin api for inputmode plugin",
+		},
+		cli.StringFlag{
+			Name:   ClikeyPluginHistory,
+			EnvVar: "PLUGIN_HISTORY",
+			Value:  "1000",
+			Usage:  "count of the last loglines per container kept for docker logs at inputmode plugin",
+		},
 		cli.StringFlag{
 			Name:   ClikeyConnectionkey,
 			EnvVar: "CONNECTION_KEY",
@@ -130,12 +287,178 @@ func main() {
 			EnvVar: "ENABLE_GEO_IP_INJECT",
 			Usage:  "allows to get an geo location by ip address. This will download a database from https://www.maxmind.com",
 		},
+		cli.StringFlag{
+			Name:   ClikeyGeoIPLicenseKey,
+			EnvVar: "GEOIP_LICENSE_KEY",
+			Usage:  "the maxmind license key to download the geoip databases",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGeoIPAccountID,
+			EnvVar: "GEOIP_ACCOUNT_ID",
+			Usage:  "the maxmind account id to download the geoip databases",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGeoIPEditions,
+			EnvVar: "GEOIP_EDITIONS",
+			Value:  geoipdbupdater.DefaultEdition,
+			Usage:  "comma separated list of maxmind editions to download (GeoLite2-City, GeoLite2-Country, GeoLite2-ASN)",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGeoIPDatabaseFiles,
+			EnvVar: "GEOIP_DATABASE_FILES",
+			Usage:  "comma separated list of local .mmdb files. If set nothing will be downloaded, the files are watched for changes instead",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGeoIPAssetDir,
+			EnvVar: "GEOIP_ASSET_DIR",
+			Value:  geoipdbupdater.DefaultConfig.AssetPath,
+			Usage:  "the directory where the geoip databases are stored",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGeoIPUpdateIntervall,
+			EnvVar: "GEOIP_UPDATE_INTERVALL",
+			Value:  "24",
+			Usage:  "set the hours to look for updated geoip databases",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGeoLocationFormat,
+			EnvVar: "GEO_LOCATION_FORMAT",
+			Value:  string(GeoLocationFormatString),
+			Usage:  "format of the injected geo location: string (lat,lon), geo_point (elasticsearch geo_point object) or geojson",
+		},
+		cli.StringFlag{
+			Name:   ClikeyAnonymizeIPSecretFile,
+			EnvVar: "ANONYMIZE_IP_SECRET_FILE",
+			Usage:  "file with the secret to hash ip addresses (label funk.log.anonymizeip=hash)",
+		},
+		cli.StringFlag{
+			Name:   ClikeyUserAgentRegexFile,
+			EnvVar: "USER_AGENT_REGEX_FILE",
+			Usage:  "file with the regexes to parse user agents (label funk.log.useragentfrom). Without it the embedded regexes are used",
+		},
+		cli.StringFlag{
+			Name:   ClikeyTraceIDFields,
+			EnvVar: "TRACE_ID_FIELDS",
+			Usage:  "comma separated list of additional paths inside the logs to find the trace id (written to trace.id)",
+		},
+		cli.StringFlag{
+			Name:   ClikeySpanIDFields,
+			EnvVar: "SPAN_ID_FIELDS",
+			Usage:  "comma separated list of additional paths inside the logs to find the span id (written to span.id)",
+		},
+		cli.StringFlag{
+			Name:   ClikeyForwardLabels,
+			EnvVar: "FORWARD_LABELS",
+			Usage:  "comma separated list of container labels (wildcards like com.example.* allowed) which are send as attributes",
+		},
+		cli.StringFlag{
+			Name:   ClikeyFileInputsConfig,
+			EnvVar: "FILE_INPUTS_CONFIG",
+			Usage:  "json file with the host log files to follow (list of {paths, exclude, searchindex, staticcontent, formatRegex, multiline, labels})",
+		},
+		cli.StringFlag{
+			Name:   ClikeyFileInputsCheckpoint,
+			EnvVar: "FILE_INPUTS_CHECKPOINT",
+			Value:  "./tmpassets/file_checkpoints.json",
+			Usage:  "file to save the read positions of the host log files and the files of label funk.log.files",
+		},
+		cli.StringFlag{
+			Name:   ClikeyHostRootDir,
+			EnvVar: "HOST_ROOT_DIR",
+			Usage:  "place of the host filesystem inside the agent (like /host) to find the files of label funk.log.files",
+		},
+		cli.StringFlag{
+			Name:   ClikeyForwardListenAddr,
+			EnvVar: "FORWARD_LISTEN_ADDR",
+			Usage:  "address (like :24224) to receive logs by the fluentd forward protocol (docker log driver fluentd, fluent-bit). Empty disables the listener",
+		},
+		cli.StringFlag{
+			Name:   ClikeyForwardSharedKey,
+			EnvVar: "FORWARD_SHARED_KEY",
+			Usage:  "shared key of the fluentd forward handshake. Empty disables the handshake",
+		},
+		cli.StringFlag{
+			Name:   ClikeySyslogListenAddr,
+			EnvVar: "SYSLOG_LISTEN_ADDR",
+			Usage:  "address (like :514) to receive RFC5424 and RFC3164 syslog messages by udp and tcp. Empty disables the listener",
+		},
+		cli.StringFlag{
+			Name:   ClikeySyslogSearchIndex,
+			EnvVar: "SYSLOG_SEARCH_INDEX",
+			Value:  "syslog",
+			Usage:  "searchindex of syslog messages which do not belong to a tracked container",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGELFListenAddr,
+			EnvVar: "GELF_LISTEN_ADDR",
+			Usage:  "address (like :12201) to receive gelf messages by udp (chunked and compressed) and tcp. Empty disables the listener",
+		},
+		cli.StringFlag{
+			Name:   ClikeyGELFSearchIndex,
+			EnvVar: "GELF_SEARCH_INDEX",
+			Value:  "gelf",
+			Usage:  "searchindex of gelf messages which do not belong to a tracked container",
+		},
 		cli.StringFlag{
 			Name:   StatsIntervall,
 			EnvVar: "STATSINTERVALL",
 			Usage:  "set the second where statsinfo will be send to server",
 			Value:  "15",
 		},
+		cli.StringFlag{
+			Name:   ClikeyStatsSource,
+			EnvVar: "STATS_SOURCE",
+			Value:  string(tracker.StatsSourceDocker),
+			Usage:  "read the stats by the docker api (docker) or from the cgroup filesystem of the host (cgroup)",
+		},
+		cli.StringFlag{
+			Name:   SnapshotIntervall,
+			EnvVar: "SNAPSHOT_INTERVALL",
+			Usage:  "set the second where the processes (label funk.log.top) and the disk usage (label funk.log.size) of the containers will be send to server",
+			Value:  "300",
+		},
+		cli.BoolFlag{
+			Name:   ClikeyNodeStats,
+			EnvVar: "NODE_STATS",
+			Usage:  "send the stats of the host (load, memory, filesystems, network) each STATSINTERVALL",
+		},
+		cli.StringFlag{
+			Name:   ClikeyNodeStatsSearchIndex,
+			EnvVar: "NODE_STATS_SEARCH_INDEX",
+			Value:  "default",
+			Usage:  "searchindex of the stats of the host, _node_stats is added",
+		},
+		cli.StringFlag{
+			Name:   ClikeyMinLogLevel,
+			EnvVar: "MIN_LOG_LEVEL",
+			Usage:  "default for label funk.log.minlevel. Loglines of tracked containers with a lower level will not be send (trace, debug, info, warn, error, fatal)",
+		},
+		cli.StringFlag{
+			Name:   ClikeyAlertRulesConfig,
+			EnvVar: "ALERT_RULES_CONFIG",
+			Usage:  "json file with a list of alert rules on the stats and loglines of all containers (see README)",
+		},
+		cli.StringFlag{
+			Name:   ClikeyAlertWebhookURL,
+			EnvVar: "ALERT_WEBHOOK_URL",
+			Usage:  "url the alerts will be posted to as json when a rule fires or resolves",
+		},
+		cli.BoolFlag{
+			Name:   ClikeyLogPatterns,
+			EnvVar: "LOG_PATTERNS",
+			Usage:  "default for label funk.log.patterns. Group the log messages into templates, write their pattern_id to the loglines and send the count of the templates each STATSINTERVALL",
+		},
+		cli.StringFlag{
+			Name:   ClikeyPrometheusListenAddr,
+			EnvVar: "PROMETHEUS_LISTEN_ADDR",
+			Usage:  "address like :9100 to serve the log metrics of label funk.log.metrics at /metrics for prometheus, empty to disable",
+		},
+		cli.StringFlag{
+			Name:   FilterReportIntervall,
+			EnvVar: "FILTER_REPORT_INTERVALL",
+			Usage:  "set the second where the count of dropped loglines (funk.log.drop, funk.log.keep, funk.log.sample) will be reported",
+			Value:  "60",
+		},
 	}
 	if err := app.Run(os.Args); err != nil {
 		logger.Get().Fatalw("Global error: " + err.Error())
@@ -150,11 +473,85 @@ func run(c *cli.Context) error {
 		return fmt.Errorf("logstats has no valid Parameter %v", statslog)
 	}
 
+	inputMode := InputMode(c.String(ClikeyInputMode))
+	if !inputMode.IsValidate() {
+		return fmt.Errorf("inputmode has no valid Parameter %v", inputMode)
+	}
+
+	statsSource := tracker.StatsSource(c.String(ClikeyStatsSource))
+	if !statsSource.IsValidate() {
+		return fmt.Errorf("statssource has no valid Parameter %v", statsSource)
+	}
+
+	geoLocationFormat := GeoLocationFormat(c.String(ClikeyGeoLocationFormat))
+	if !geoLocationFormat.IsValidate() {
+		return fmt.Errorf("geolocationformat has no valid Parameter %v", geoLocationFormat)
+	}
+
+	if minLevel := c.String(ClikeyMinLogLevel); minLevel != "" && tracker.ParseLogLevel(minLevel) == tracker.LogLevelUnknown {
+		return fmt.Errorf("minloglevel has no valid Parameter %v", minLevel)
+	}
+
+	statsSecond, err := strconv.ParseInt(c.String(StatsIntervall), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	var anonymizeIPSecret []byte
+	if secretFile := c.String(ClikeyAnonymizeIPSecretFile); secretFile != "" {
+		secret, err := ioutil.ReadFile(secretFile)
+		if err != nil {
+			return err
+		}
+		anonymizeIPSecret = []byte(strings.TrimSpace(string(secret)))
+	}
+
+	var fileInputs []tracker.FileInput
+	if fileInputsConfig := c.String(ClikeyFileInputsConfig); fileInputsConfig != "" {
+		inputs, err := tracker.LoadFileInputs(fileInputsConfig)
+		if err != nil {
+			return err
+		}
+		fileInputs = inputs
+	}
+
+	if _, err := loadCRIConfig(c.String(ClikeyCRIConfigFile)); err != nil {
+		return err
+	}
+
+	var alertRules []alert.Rule
+	if alertRulesConfig := c.String(ClikeyAlertRulesConfig); alertRulesConfig != "" {
+		alertRules, err = alert.LoadRules(alertRulesConfig)
+		if err != nil {
+			return err
+		}
+	}
+	alerter, err := NewAlerter(alertRules, c.String(ClikeyAlertWebhookURL))
+	if err != nil {
+		return err
+	}
+
 	enableGeoIPInject := c.Bool(EnableGeoIPInject)
 	var georeader GeoReader
 	if enableGeoIPInject {
-		georeader = InitGeoIP()
+		geoIPUpdateHours, err := strconv.ParseInt(c.String(ClikeyGeoIPUpdateIntervall), 10, 64)
+		if err != nil {
+			return err
+		}
+		georeader = InitGeoIP(geoipdbupdater.Config{
+			AccountID:  c.String(ClikeyGeoIPAccountID),
+			LicenseKey: c.String(ClikeyGeoIPLicenseKey),
+			Editions:   splitList(c.String(ClikeyGeoIPEditions)),
+			LocalFiles: splitList(c.String(ClikeyGeoIPDatabaseFiles)),
+			AssetPath:  c.String(ClikeyGeoIPAssetDir),
+			Interval:   time.Duration(geoIPUpdateHours) * time.Hour,
+		})
+	}
+	var userAgentParser UserAgentParser = useragent.NewDefaultParser()
+	if regexFile := c.String(ClikeyUserAgentRegexFile); regexFile != "" {
+		userAgentParser = useragent.NewFileParser(regexFile, time.Minute)
 	}
+
 	holder := Holder{
 		Props: Props{
 			funkServerURL:      c.String(ClikeyFunkserver),
@@ -162,42 +559,128 @@ func run(c *cli.Context) error {
 			Connectionkey:      c.String(ClikeyConnectionkey),
 			LogStats:           statslog,
 			SwarmMode:          c.Bool(ClikeySwarmmode),
+			KubernetesMode:     c.Bool(ClikeyKubernetesmode) || inputMode == InputModeCRI,
+			InputMode:          inputMode,
+			CRILogDir:          c.String(ClikeyCRILogDir),
 			EnableGeoIpReader:  enableGeoIPInject,
+			GeoLocationFormat:  geoLocationFormat,
+			AnonymizeIPSecret:  anonymizeIPSecret,
+			ForwardLabels:      splitList(c.String(ClikeyForwardLabels)),
+			TrackerOptions: tracker.Options{
+				MinLevel:      c.String(ClikeyMinLogLevel),
+				HostRoot:      c.String(ClikeyHostRootDir),
+				StatsSource:   statsSource,
+				Checkpoints:   tracker.LoadCheckpoints(c.String(ClikeyFileInputsCheckpoint)),
+				StateInterval: stateInterval(statslog, statsSecond),
+			},
 		},
 		GeoReader:          georeader,
+		UserAgentParser:    userAgentParser,
+		TraceExtractor:     NewTraceExtractor(splitList(c.String(ClikeyTraceIDFields)), splitList(c.String(ClikeySpanIDFields))),
+		Alerter:            alerter,
+		LogMetrics:         NewLogMetrics(),
+		PatternInjecter:    NewPatternInjecter(c.Bool(ClikeyLogPatterns)),
 		writeToServer:      WriteToServer,
 		itSelfNamedHost:    "localhost",
 		trackingContainers: make(map[string]tracker.TrackElement),
 	}
-	err := holder.openSocketConn(false)
+	err = holder.openSocketConn(false)
 	for err != nil {
 		err = holder.openSocketConn(false)
 		logger.Get().Errorw("No connection to Server... Wait 5s and try again later")
 		time.Sleep(5 * time.Second)
 	}
 
-	logger.Get().Infow("Connected to Funk-Server", "swarmmode", holder.Props.SwarmMode)
+	logger.Get().Infow("Connected to Funk-Server", "swarmmode", holder.Props.SwarmMode, "kubernetesmode", holder.Props.KubernetesMode)
 	containerChan := make(chan []types.Container, 1)
-	cli, info, err := StartListeningForContainer(context.Background(), containerChan)
-	if err != nil {
-		panic(err)
+	mu := sync.Mutex{}
+	switch holder.Props.InputMode {
+	case InputModeCRI, InputModePlugin:
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		holder.itSelfNamedHost = getFilledValue(c.String(ClikeyNodeName), hostname)
+		if holder.Props.InputMode == InputModeCRI {
+			go StartWatchingCRILogs(holder.Props.CRILogDir, c.String(ClikeyCRIConfigFile), containerChan, time.NewTicker(10*time.Second))
+			break
+		}
+		historySize, err := strconv.Atoi(c.String(ClikeyPluginHistory))
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := holder.StartPluginDriver(c.String(ClikeyPluginSocket), historySize, &mu); err != nil {
+				logger.Get().Fatalw("Error by serving the log driver plugin api: " + err.Error())
+			}
+		}()
+	default:
+		cli, info, err := StartListeningForContainer(context.Background(), containerChan, holder.Props.KubernetesMode)
+		if err != nil {
+			panic(err)
+		}
+		holder.itSelfNamedHost = info.Name
+		holder.client = cli
 	}
-	holder.itSelfNamedHost = info.Name
 
-	mu := sync.Mutex{}
+	mu.Lock()
+	for _, v := range tracker.StartFileInputs(fileInputs, holder.Props.TrackerOptions.Checkpoints, holder.Props.TrackerOptions) {
+		holder.trackingContainers[v.GetContainer().ID] = v
+	}
+	mu.Unlock()
+
+	if forwardAddr := c.String(ClikeyForwardListenAddr); forwardAddr != "" {
+		err := holder.StartForwardInput(netinput.ForwardConfig{
+			Addr:         forwardAddr,
+			SharedKey:    c.String(ClikeyForwardSharedKey),
+			SelfHostname: holder.itSelfNamedHost,
+		}, &mu)
+		if err != nil {
+			return err
+		}
+	}
+	if syslogAddr := c.String(ClikeySyslogListenAddr); syslogAddr != "" {
+		if err := holder.StartSyslogInput(syslogAddr, c.String(ClikeySyslogSearchIndex), &mu); err != nil {
+			return err
+		}
+	}
+	if gelfAddr := c.String(ClikeyGELFListenAddr); gelfAddr != "" {
+		if err := holder.StartGELFInput(gelfAddr, c.String(ClikeyGELFSearchIndex), &mu); err != nil {
+			return err
+		}
+	}
+
+	if prometheusAddr := c.String(ClikeyPrometheusListenAddr); prometheusAddr != "" {
+		if err := holder.StartPrometheus(prometheusAddr, &mu); err != nil {
+			return err
+		}
+	}
 
-	holder.client = cli
 	go holder.updateTrackingContainer(containerChan, &mu)
 	ticker := time.NewTicker(5 * time.Second)
 
-	statsSecond, err := strconv.ParseInt(c.String(StatsIntervall), 10, 64)
+	// the log metrics (funk.log.metrics) and patterns (funk.log.patterns) are send each STATSINTERVALL too, so it runs without LOG_STATS as well
+	statsTicker := time.NewTicker(time.Duration(statsSecond) * time.Second)
+	go holder.uploadStatsInfromation(&mu, statsTicker)
+	if c.Bool(ClikeyNodeStats) {
+		collector := nodestats.NewCollector(c.String(ClikeyHostRootDir))
+		searchIndex := c.String(ClikeyNodeStatsSearchIndex)
+		go collector.Run(time.NewTicker(time.Duration(statsSecond)*time.Second), func(stats nodestats.Stats) {
+			mu.Lock()
+			defer mu.Unlock()
+			holder.SaveNodeStats(stats, searchIndex)
+		})
+	}
+	snapshotSecond, err := strconv.ParseInt(c.String(SnapshotIntervall), 10, 64)
 	if err != nil {
 		return err
 	}
-	if holder.Props.LogStats != StatsLogNo {
-		statsTicker := time.NewTicker(time.Duration(statsSecond) * time.Second)
-		go holder.uploadStatsInfromation(&mu, statsTicker)
+	go holder.uploadSnapshotInformation(&mu, time.NewTicker(time.Duration(snapshotSecond)*time.Second))
+	filterReportSecond, err := strconv.ParseInt(c.String(FilterReportIntervall), 10, 64)
+	if err != nil {
+		return err
 	}
+	go holder.reportFilterCounter(&mu, time.NewTicker(time.Duration(filterReportSecond)*time.Second))
 	holder.uploadTrackingInformation(&mu, ticker)
 	return nil
 }
@@ -209,11 +692,101 @@ func (w *Holder) uploadStatsInfromation(mu *sync.Mutex, intervall *time.Ticker)
 			for _, v := range w.trackingContainers {
 				w.SaveStatsInfo(v)
 			}
+			tracked := w.trackedContainerIDs()
+			w.Alerter.Prune(tracked)
+			w.LogMetrics.Prune(tracked)
+			w.PatternInjecter.Prune(tracked)
+			mu.Unlock()
+		}
+	}
+}
+
+// trackedContainerIDs returns the ids of the containers of all trackers, so the state kept per container of removed ones can be pruned.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) trackedContainerIDs() map[string]bool {
+	res := make(map[string]bool, len(w.trackingContainers))
+	for _, v := range w.trackingContainers {
+		res[v.GetContainer().ID] = true
+	}
+	return res
+}
+
+// uploadSnapshotInformation sends the processes and disk usage of the containers with label funk.log.top or funk.log.size.
+// Docker needs time for them, so the lock is only hold to send
+func (w *Holder) uploadSnapshotInformation(mu *sync.Mutex, intervall *time.Ticker) {
+	for range intervall.C {
+		mu.Lock()
+		var jobs []snapshotJob
+		for _, v := range w.trackingContainers {
+			if job, ok := w.getSnapshotJob(v); ok {
+				jobs = append(jobs, job)
+			}
+		}
+		mu.Unlock()
+		for _, job := range jobs {
+			msg := w.getSnapshotInfo(job)
+			mu.Lock()
+			w.SaveSnapshotInfo(msg)
+			mu.Unlock()
+		}
+	}
+}
+
+func (w *Holder) reportFilterCounter(mu *sync.Mutex, intervall *time.Ticker) {
+	for {
+		for range intervall.C {
+			mu.Lock()
+			var msg []Message
+			for _, v := range w.trackingContainers {
+				if counter := w.getFilterCounterInfo(v); counter != nil {
+					msg = append(msg, *counter)
+				}
+			}
+			if len(msg) != 0 {
+				err := w.writeToServer(w.streamCon, msg)
+				if err != nil {
+					logger.Get().Warnw("Error by write Data to Server" + err.Error() + " try to reconnect")
+
+					err := w.openSocketConn(true)
+					if err != nil {
+						logger.Get().Warnw("Can not connect try again later: " + err.Error())
+					} else {
+						logger.Get().Infow("Connected to Funk-Server")
+					}
+				}
+			}
 			mu.Unlock()
 		}
 	}
 }
 
+// getFilterCounterInfo returns the count of the dropped loglines of the container since the last report, nil if none are dropped
+func (w *Holder) getFilterCounterInfo(v tracker.TrackElement) *Message {
+	counter := v.GetFilterCounter()
+	if counter.Total() == 0 {
+		return nil
+	}
+	stoutlog := getLoggerWithContainerInformation(logger.Get(), v.GetContainer())
+	stoutlog.Debugw("Dropped loglines by filter", "dropped", counter.Total())
+	b, err := json.Marshal(struct {
+		Dropped int64 `json:"dropped"`
+		tracker.FilterCounter
+	}{counter.Total(), counter})
+	if err != nil {
+		stoutlog.Warnw("Error by Marshal filter counter:"+err.Error(), "counter", counter)
+		return nil
+	}
+	return &Message{
+		Time:          time.Now(),
+		Type:          MessageTypeStats,
+		SubType:       MessageSubTypeFilter,
+		Data:          []string{string(b)},
+		Attributes:    getFilledMessageAttributes(w, v),
+		SearchIndex:   v.SearchIndex() + "_filter",
+		StaticContent: getStaticContent(v),
+	}
+}
+
 // Will stock the process forever like a tcplistener
 func (w *Holder) uploadTrackingInformation(mu *sync.Mutex, intervall *time.Ticker) {
 
@@ -233,12 +806,13 @@ func (w *Holder) updateTrackingContainer(containerChan chan []types.Container, m
 	for {
 		for c := range containerChan {
 			mu.Lock()
+			w.removeMissingTrackers(c)
 			for _, v := range c {
 				d, exist := w.trackingContainers[v.ID]
 				if exist {
 					d.SetContainer(v)
 				} else {
-					w.trackingContainers[v.ID] = tracker.NewTracker(w.client, v)
+					w.trackingContainers[v.ID] = w.newTracker(v)
 				}
 			}
 			mu.Unlock()
@@ -246,14 +820,54 @@ func (w *Holder) updateTrackingContainer(containerChan chan []types.Container, m
 	}
 }
 
+// removeMissingTrackers sends the last loglines and deletes the docker and CRI trackers whose container is missing at found, because it has stopped or its log directory is removed.
+// Trackers of the other inputs (network, plugin and files) are not part of the list and kept.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) removeMissingTrackers(found []types.Container) {
+	exist := make(map[string]bool, len(found))
+	for _, v := range found {
+		exist[v.ID] = true
+	}
+	for id, v := range w.trackingContainers {
+		switch v.(type) {
+		case *tracker.Tracker, *tracker.CRITracker:
+			if !exist[id] {
+				w.SaveTrackingInfo(v)
+				delete(w.trackingContainers, id)
+			}
+		}
+	}
+}
+
+func (w *Holder) newTracker(container types.Container) tracker.TrackElement {
+	if w.Props.InputMode == InputModeCRI {
+		return tracker.NewCRITracker(w.Props.CRILogDir, container, w.Props.TrackerOptions)
+	}
+	return tracker.NewTracker(w.client, container, w.Props.TrackerOptions)
+}
+
 // SaveStatsInfo collect all statsinfo and send them to server
 func (w *Holder) SaveStatsInfo(data tracker.TrackElement) {
 	var msg []Message
-	if w.Props.LogStats != StatsLogNo {
-		stats := w.getStatsInfo(data)
+	if w.Props.LogStats != StatsLogNo && data.GetContainer().Labels["funk.log.stats"] != "false" {
+		cumulated := data.GetCumulateStats()
+		cumulated.ContainerState = tracker.StateOf(data.GetInspect())
+		stats := w.getStatsInfo(data, cumulated)
 		if stats != nil {
 			msg = append(msg, *stats)
 		}
+		alerts := w.getAlertInfo(data, w.Alerter.EvaluateStats(data, cumulated, time.Now()))
+		if alerts != nil {
+			msg = append(msg, *alerts)
+		}
+	}
+	logMetrics := w.getLogMetricsInfo(data)
+	if logMetrics != nil {
+		msg = append(msg, *logMetrics)
+	}
+	patterns := w.getPatternInfo(data)
+	if patterns != nil {
+		msg = append(msg, *patterns)
 	}
 	if len(msg) != 0 {
 		err := w.writeToServer(w.streamCon, msg)
@@ -270,14 +884,136 @@ func (w *Holder) SaveStatsInfo(data tracker.TrackElement) {
 	}
 }
 
+// SaveNodeStats sends the stats of the host to the server
+func (w *Holder) SaveNodeStats(stats nodestats.Stats, searchIndex string) {
+	msg := w.getNodeStatsInfo(stats, searchIndex)
+	if msg == nil {
+		return
+	}
+	err := w.writeToServer(w.streamCon, []Message{*msg})
+	if err != nil {
+		logger.Get().Warnw("Error by write Data to Server" + err.Error() + " try to reconnect")
+
+		err := w.openSocketConn(true)
+		if err != nil {
+			logger.Get().Warnw("Can not connect try again later: " + err.Error())
+		} else {
+			logger.Get().Infow("Connected to Funk-Server")
+		}
+	}
+}
+
+func (w *Holder) getNodeStatsInfo(stats nodestats.Stats, searchIndex string) *Message {
+	b, err := json.Marshal(stats)
+	if err != nil {
+		logger.Get().Warnw("Error by Marshal node stats:"+err.Error(), "stats", stats)
+		return nil
+	}
+	return &Message{
+		Time:        time.Now(),
+		Type:        MessageTypeStats,
+		Data:        []string{string(b)},
+		Attributes:  Attributes{Host: w.itSelfNamedHost},
+		SearchIndex: searchIndex + "_node_stats",
+	}
+}
+
+// SaveSnapshotInfo sends the snapshots of a container to the server
+func (w *Holder) SaveSnapshotInfo(msg []Message) {
+	if len(msg) == 0 {
+		return
+	}
+	err := w.writeToServer(w.streamCon, msg)
+	if err != nil {
+		logger.Get().Warnw("Error by write Data to Server" + err.Error() + " try to reconnect")
+
+		err := w.openSocketConn(true)
+		if err != nil {
+			logger.Get().Warnw("Can not connect try again later: " + err.Error())
+		} else {
+			logger.Get().Infow("Connected to Funk-Server")
+		}
+	}
+}
+
+// snapshotJob is a container with label funk.log.top or funk.log.size and the information of its messages.
+// It is copied with the lock of trackingContainers held, so the snapshot can be taken without it
+type snapshotJob struct {
+	snapshotter   tracker.Snapshotter
+	container     types.Container
+	attributes    Attributes
+	searchIndex   string
+	staticContent string
+}
+
+// getSnapshotJob returns the snapshotJob of v, false if v is no Snapshotter or has no label funk.log.top or funk.log.size.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) getSnapshotJob(v tracker.TrackElement) (snapshotJob, bool) {
+	snapshotter, ok := v.(tracker.Snapshotter)
+	container := v.GetContainer()
+	if !ok || !(tracker.WantsTop(container) || tracker.WantsSize(container)) {
+		return snapshotJob{}, false
+	}
+	return snapshotJob{
+		snapshotter:   snapshotter,
+		container:     container,
+		attributes:    getFilledMessageAttributes(w, v),
+		searchIndex:   v.SearchIndex(),
+		staticContent: getStaticContent(v),
+	}, true
+}
+
+// getSnapshotInfo takes the processes (label funk.log.top) and the disk usage (label funk.log.size) of the container of job.
+// It calls docker and does not need the lock of trackingContainers
+func (w *Holder) getSnapshotInfo(job snapshotJob) []Message {
+	stoutlog := getLoggerWithContainerInformation(logger.Get(), job.container)
+	var res []Message
+	add := func(subType MessageSubType, suffix string, data interface{}, err error) {
+		if err != nil {
+			stoutlog.Warnw("Error by get " + string(subType) + " of container:" + err.Error())
+			return
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			stoutlog.Warnw("Error by Marshal "+string(subType)+":"+err.Error(), "data", data)
+			return
+		}
+		res = append(res, Message{
+			Time:          time.Now(),
+			Type:          MessageTypeStats,
+			SubType:       subType,
+			Data:          []string{string(b)},
+			Attributes:    job.attributes,
+			SearchIndex:   job.searchIndex + suffix,
+			StaticContent: job.staticContent,
+		})
+	}
+	if tracker.WantsTop(job.container) {
+		top, err := job.snapshotter.GetTop(job.container.ID)
+		add(MessageSubTypeTop, "_top", top, err)
+	}
+	if tracker.WantsSize(job.container) {
+		size, err := job.snapshotter.GetSize(job.container.ID)
+		add(MessageSubTypeSize, "_size", size, err)
+	}
+	return res
+}
+
 // SaveTrackingInfo collect all logs and send this to the server
 func (w *Holder) SaveTrackingInfo(data tracker.TrackElement) {
 	stoutlog := getLoggerWithContainerInformation(logger.Get(), data.GetContainer())
 
 	var msg []Message
+	var lines []string
 	logs := w.getLogs(data)
 	if logs != nil {
 		msg = append(msg, *logs)
+		lines = logs.Data
+	}
+	w.LogMetrics.Observe(data, lines)
+	alerts := w.getAlertInfo(data, w.Alerter.EvaluateLogs(data, lines, time.Now()))
+	if alerts != nil {
+		msg = append(msg, *alerts)
 	}
 	if len(msg) != 0 {
 		err := w.writeToServer(w.streamCon, msg)
@@ -316,18 +1052,15 @@ func getStaticContent(v tracker.TrackElement) string {
 	return string(staticcontentstr)
 }
 
-func (w *Holder) getStatsInfo(v tracker.TrackElement) *Message {
+func (w *Holder) getStatsInfo(v tracker.TrackElement, cumulated tracker.CumulateStats) *Message {
 	stoutlog := getLoggerWithContainerInformation(logger.Get(), v.GetContainer())
 
 	if v.GetContainer().Labels["funk.log.stats"] == "false" {
 		stoutlog.Debugw("No stats Logging for" + v.GetContainer().Names[0])
 		return nil
 	}
-	stats := v.GetStats()
-
-	var b []byte
 	if w.Props.LogStats == StatsLogCumulated {
-		stats := tracker.CumulateStatsInfo(stats)
+		stats := cumulated
 		b, err := json.Marshal(stats)
 		if err != nil {
 			stoutlog.Warnw("Error by Marshal stats:"+err.Error(), "stats", stats)
@@ -344,6 +1077,8 @@ func (w *Holder) getStatsInfo(v tracker.TrackElement) *Message {
 		}
 	}
 
+	stats := v.GetStats()
+	stats.ContainerState = cumulated.ContainerState
 	b, err := json.Marshal(stats)
 	if err != nil {
 		stoutlog.Warnw("Error by Marshal stats:"+err.Error(), "stats", stats)
@@ -360,6 +1095,25 @@ func (w *Holder) getStatsInfo(v tracker.TrackElement) *Message {
 	}
 }
 
+// stateInterval returns the intervall to inspect the containers again, 0 if no stats are send
+func stateInterval(statslog StatsLog, statsSecond int64) time.Duration {
+	if statslog == StatsLogNo {
+		return 0
+	}
+	return time.Duration(statsSecond) * time.Second
+}
+
+// splitList splits a comma separated cli value and removes empty entries
+func splitList(value string) []string {
+	var res []string
+	for _, one := range strings.Split(value, ",") {
+		if one = strings.TrimSpace(one); one != "" {
+			res = append(res, one)
+		}
+	}
+	return res
+}
+
 func getFilledValue(value, fallback string) string {
 	if value != "" {
 		return value
@@ -367,52 +1121,99 @@ func getFilledValue(value, fallback string) string {
 	return fallback
 }
 
-func getFilledMessageAttributes(holder *Holder, v tracker.TrackElement) Attributes {
+const shortContainerIDLength = 12
 
-	if holder.Props.SwarmMode {
-		return Attributes{
-			Containername: getFilledValue(v.GetContainer().Labels["com.docker.swarm.task.name"], v.GetContainer().Names[0]),
-			Servicename:   v.GetContainer().Labels["com.docker.swarm.service.name"],
-			Namespace:     v.GetContainer().Labels["com.docker.stack.namespace"],
-			Host:          holder.itSelfNamedHost,
-			ContainerID:   v.GetContainer().ImageID,
-		}
+func shortContainerID(id string) string {
+	if len(id) > shortContainerIDLength {
+		return id[:shortContainerIDLength]
 	}
-	return Attributes{
-		Containername: v.GetContainer().Names[0],
-		Host:          holder.itSelfNamedHost,
-		ContainerID:   v.GetContainer().ImageID,
+	return id
+}
+
+// splitImageReference splits an image like registry:5000/app:1.0@sha256:... into name and tag
+func splitImageReference(image string) (string, string) {
+	name := strings.SplitN(image, "@", 2)[0]
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i], name[i+1:]
 	}
+	return name, ""
+}
 
+// getForwardedLabels returns all labels matching one of the patterns (like com.example.*)
+func getForwardedLabels(labels map[string]string, patterns []string) map[string]string {
+	var res map[string]string
+	for key, value := range labels {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, key); matched {
+				if res == nil {
+					res = make(map[string]string)
+				}
+				res[key] = value
+				break
+			}
+		}
+	}
+	return res
 }
 
-func (w *Holder) injectGeoIpInformation(value, keyword string) (string, error) {
-	logger.Get().Debug("All param set to get geodata from this container")
-	var valueobj interface{}
-	json.Unmarshal([]byte(value), &valueobj)
-	values := valueobj.(map[string]interface{})
-	ip := values[keyword[1:]]
-	if ip == nil {
-		return value, fmt.Errorf("Field %s not found", keyword)
+func getContainerNetworks(container types.Container) map[string]string {
+	if container.NetworkSettings == nil || len(container.NetworkSettings.Networks) == 0 {
+		return nil
 	}
-	geodata, err := w.GeoReader.GetGeoDataByIP(ip.(string))
-	if err != nil {
-		return value, err
+	res := make(map[string]string)
+	for name, one := range container.NetworkSettings.Networks {
+		if one != nil {
+			res[name] = getFilledValue(one.IPAddress, one.GlobalIPv6Address)
+		}
 	}
+	return res
+}
 
-	type location struct {
-		Lon float64 `json:"lon,omitempty"`
-		Lat float64 `json:"lat,omitempty"`
+func getContainerStartedAt(v tracker.TrackElement) string {
+	inspect := v.GetInspect()
+	if inspect == nil || inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return ""
 	}
+	return inspect.State.StartedAt
+}
 
-	values["funkgeoip.location"] = fmt.Sprintf("%v,%v", geodata.Location.Latitude, geodata.Location.Longitude)
-	values["funkgeoip.location_timezone"] = geodata.Location.TimeZone
-	values["funkgeoip.city_name"] = geodata.City.Names["en"]
-	values["funkgeoip.postal_code"] = geodata.Postal.Code
-	values["funkgeoip.accuracy_radius"] = geodata.Location.AccuracyRadius
-	geoinjectdata, err := json.Marshal(values)
-	return string(geoinjectdata), err
+func getFilledMessageAttributes(holder *Holder, v tracker.TrackElement) Attributes {
+	container := v.GetContainer()
+	imageName, imageTag := splitImageReference(container.Image)
+	res := Attributes{
+		Containername:    container.Names[0],
+		Host:             holder.itSelfNamedHost,
+		ContainerID:      container.ID,
+		ContainerIDShort: shortContainerID(container.ID),
+		Image:            container.Image,
+		ImageName:        imageName,
+		ImageTag:         imageTag,
+		ImageDigest:      container.ImageID,
+		ComposeProject:   container.Labels["com.docker.compose.project"],
+		ComposeService:   container.Labels["com.docker.compose.service"],
+		StartedAt:        getContainerStartedAt(v),
+		Labels:           getForwardedLabels(container.Labels, holder.Props.ForwardLabels),
+		Networks:         getContainerNetworks(container),
+	}
+	if holder.Props.SwarmMode {
+		res.Containername = getFilledValue(container.Labels["com.docker.swarm.task.name"], container.Names[0])
+		res.Servicename = container.Labels["com.docker.swarm.service.name"]
+		res.Namespace = container.Labels["com.docker.stack.namespace"]
+	}
+	if holder.Props.KubernetesMode {
+		res.Containername = getFilledValue(container.Labels["io.kubernetes.container.name"], container.Names[0])
+		res.Namespace = container.Labels["io.kubernetes.pod.namespace"]
+		res.Pod = container.Labels["io.kubernetes.pod.name"]
+		res.PodUID = container.Labels["io.kubernetes.pod.uid"]
+	}
+	if pushed, ok := v.(*tracker.PushTracker); ok {
+		sender := pushed.GetSender()
+		res.Sender = sender.IP
+		res.SenderHost = sender.Host
+	}
+	return res
 }
+
 func getLoggerWithContainerInformation(logs *zap.SugaredLogger, container types.Container) *zap.SugaredLogger {
 	return logs.With(
 		"containername", container.Names[0],
@@ -427,20 +1228,51 @@ func (w *Holder) getLogs(v tracker.TrackElement) *Message {
 	logs := v.GetLogs()
 	var strLogs []string
 
+	geoIPFields := ParseGeoIPFields(v.GetContainer().Labels["funk.log.geodatafromip"])
+	userAgentField := ParseUserAgentField(v.GetContainer().Labels["funk.log.useragentfrom"])
+	anonymizer, err := NewIPAnonymizer(v.GetContainer().Labels["funk.log.anonymizeip"], geoIPFields, w.Props.AnonymizeIPSecret)
+	if err != nil {
+		stoutlog.Errorw("Error by anonymizeip, remove the ip fields instead: " + err.Error())
+		anonymizer, _ = NewIPAnonymizer(string(AnonymizeIPRemove), geoIPFields, nil)
+	}
+	if anonymizer != nil && len(anonymizer.Fields) == 0 {
+		stoutlog.Warnw("Label funk.log.anonymizeip has no fields, nothing is anonymized. Add the paths behind : or set funk.log.geodatafromip")
+	}
+	miner := w.PatternInjecter.miner(v)
 	for _, value := range logs {
-		if w.Props.EnableGeoIpReader && v.GetContainer().Labels["funk.log.geodatafromip"] != "" {
-			keyword := v.GetContainer().Labels["funk.log.geodatafromip"]
-
-			injectValue, err := w.injectGeoIpInformation(string(value), keyword)
+		line := string(value)
+		if w.Props.EnableGeoIpReader && len(geoIPFields) != 0 {
+			injectValue, err := w.injectGeoIpInformation(line, geoIPFields)
 			if err != nil {
 				stoutlog.Warnw("Error by inject geoip data " + err.Error())
-				strLogs = append(strLogs, string(value))
-			} else {
-				strLogs = append(strLogs, injectValue)
 			}
-		} else {
-			strLogs = append(strLogs, string(value))
+			line = injectValue
+		}
+		if userAgentField != nil && w.UserAgentParser != nil {
+			injectValue, err := w.injectUserAgentInformation(line, userAgentField)
+			if err != nil {
+				stoutlog.Debugw("Error by inject user agent information " + err.Error())
+			}
+			line = injectValue
+		}
+		if w.TraceExtractor != nil && v.GetContainer().Labels["funk.log.trace"] != "false" {
+			if injectValue, err := w.TraceExtractor.Inject(line); err == nil {
+				line = injectValue
+			}
+		}
+		if anonymizer != nil {
+			anonymizedValue, err := anonymizer.Anonymize(line)
+			if err != nil {
+				stoutlog.Debugw("Error by anonymize ip " + err.Error())
+			}
+			line = anonymizedValue
+		}
+		if miner != nil {
+			if injectValue, err := injectPattern(miner, line, time.Now()); err == nil {
+				line = injectValue
+			}
 		}
+		strLogs = append(strLogs, line)
 	}
 
 	if len(strLogs) > 0 {
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bouk/monkey"
 	"github.com/bradleyjkemp/cupaloy/v2"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/fasibio/funk_agent/nodestats"
 	"github.com/fasibio/funk_agent/tracker"
 	"github.com/gorilla/websocket"
 )
@@ -32,7 +41,7 @@ func Test_getFilledMessageAttributes(t *testing.T) {
 			want: Attributes{
 				Containername: "Containername",
 				Host:          "MockTest",
-				ContainerID:   "MockImageid",
+				ImageDigest:   "MockImageid",
 			},
 			holder: Holder{
 				itSelfNamedHost: "MockTest",
@@ -56,7 +65,7 @@ func Test_getFilledMessageAttributes(t *testing.T) {
 				Servicename:   "ServiceName",
 				Namespace:     "namespace",
 				Host:          "MockTest",
-				ContainerID:   "MockImageid",
+				ImageDigest:   "MockImageid",
 			},
 			holder: Holder{
 				itSelfNamedHost: "MockTest",
@@ -81,7 +90,7 @@ func Test_getFilledMessageAttributes(t *testing.T) {
 				Servicename:   "ServiceName",
 				Namespace:     "namespace",
 				Host:          "MockTest",
-				ContainerID:   "MockImageid",
+				ImageDigest:   "MockImageid",
 			},
 			holder: Holder{
 				itSelfNamedHost: "MockTest",
@@ -99,6 +108,93 @@ func Test_getFilledMessageAttributes(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "fill Attribute with Kubernetesmode use the pod metadata",
+			want: Attributes{
+				Containername: "app",
+				Namespace:     "default",
+				Pod:           "web-5d9f7c-x2x7q",
+				PodUID:        "6f1e2b54-4c2d-4e8a-9a3b-2c1d0e9f8a7b",
+				Host:          "MockTest",
+				ImageDigest:   "MockImageid",
+			},
+			holder: Holder{
+				itSelfNamedHost: "MockTest",
+				Props: Props{
+					KubernetesMode: true,
+				},
+			},
+			tracker: &TrackerMock{
+				Con: types.Container{
+					Labels: map[string]string{
+						"io.kubernetes.container.name": "app",
+						"io.kubernetes.pod.name":       "web-5d9f7c-x2x7q",
+						"io.kubernetes.pod.namespace":  "default",
+						"io.kubernetes.pod.uid":        "6f1e2b54-4c2d-4e8a-9a3b-2c1d0e9f8a7b",
+					},
+					Names: []string{
+						"k8s_app_web-5d9f7c-x2x7q_default_6f1e2b54-4c2d-4e8a-9a3b-2c1d0e9f8a7b_0",
+					},
+					ImageID: "MockImageid",
+				},
+			},
+		},
+		{
+			name: "fill Attribute with complete container metadata",
+			want: Attributes{
+				Containername:    "/app_web_1",
+				Host:             "MockTest",
+				ContainerID:      "4f66ad9a0b2e3c1dfa7d9e1b3c5a7f9e0d2c4b6a8e0f1a3b5c7d9e1f3a5b7c9d",
+				ContainerIDShort: "4f66ad9a0b2e",
+				Image:            "registry:5000/app/web:1.2",
+				ImageName:        "registry:5000/app/web",
+				ImageTag:         "1.2",
+				ImageDigest:      "sha256:1234",
+				ComposeProject:   "app",
+				ComposeService:   "web",
+				StartedAt:        "2019-08-12T12:52:07.123Z",
+				Labels: map[string]string{
+					"com.example.team":  "funk",
+					"com.example.stage": "dev",
+				},
+				Networks: map[string]string{
+					"app_default": "172.18.0.2",
+				},
+			},
+			holder: Holder{
+				itSelfNamedHost: "MockTest",
+				Props: Props{
+					ForwardLabels: []string{"com.example.*"},
+				},
+			},
+			tracker: &TrackerMock{
+				Con: types.Container{
+					ID:      "4f66ad9a0b2e3c1dfa7d9e1b3c5a7f9e0d2c4b6a8e0f1a3b5c7d9e1f3a5b7c9d",
+					Image:   "registry:5000/app/web:1.2",
+					ImageID: "sha256:1234",
+					Labels: map[string]string{
+						"com.docker.compose.project": "app",
+						"com.docker.compose.service": "web",
+						"com.example.team":           "funk",
+						"com.example.stage":          "dev",
+						"other":                      "not forwarded",
+					},
+					Names: []string{
+						"/app_web_1",
+					},
+					NetworkSettings: &types.SummaryNetworkSettings{
+						Networks: map[string]*network.EndpointSettings{
+							"app_default": &network.EndpointSettings{IPAddress: "172.18.0.2"},
+						},
+					},
+				},
+				Inspect: &types.ContainerJSON{
+					ContainerJSONBase: &types.ContainerJSONBase{
+						State: &types.ContainerState{StartedAt: "2019-08-12T12:52:07.123Z"},
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -110,9 +206,10 @@ func Test_getFilledMessageAttributes(t *testing.T) {
 }
 
 type TrackerMock struct {
-	Stats tracker.Stats
-	Log   tracker.TrackerLogs
-	Con   types.Container
+	Stats   tracker.Stats
+	Log     tracker.TrackerLogs
+	Con     types.Container
+	Inspect *types.ContainerJSON
 }
 
 func (t *TrackerMock) SearchIndex() string {
@@ -122,6 +219,10 @@ func (t *TrackerMock) GetStats() tracker.Stats {
 	return t.Stats
 }
 
+func (t *TrackerMock) GetCumulateStats() tracker.CumulateStats {
+	return tracker.CumulateStatsInfo(t.Stats)
+}
+
 func (t *TrackerMock) GetLogs() []tracker.TrackerLogs {
 	res := make([]tracker.TrackerLogs, 1)
 	res = append(res, t.Log)
@@ -138,6 +239,14 @@ func (t *TrackerMock) GetContainer() types.Container {
 
 func (t *TrackerMock) SetContainer(con types.Container) {}
 
+func (t *TrackerMock) GetInspect() *types.ContainerJSON {
+	return t.Inspect
+}
+
+func (t *TrackerMock) GetFilterCounter() tracker.FilterCounter {
+	return tracker.FilterCounter{}
+}
+
 func TestHolder_SaveTrackingInfo(t *testing.T) {
 	wayback := time.Date(1974, time.May, 19, 1, 2, 3, 4, time.UTC)
 	patch := monkey.Patch(time.Now, func() time.Time { return wayback })
@@ -418,3 +527,202 @@ func TestHolder_SaveStatsInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestHolder_SaveNodeStats(t *testing.T) {
+	wayback := time.Date(1974, time.May, 19, 1, 2, 3, 4, time.UTC)
+	patch := monkey.Patch(time.Now, func() time.Time { return wayback })
+	defer patch.Unpatch()
+	w := &Holder{
+		itSelfNamedHost: "test_unit",
+		writeToServer: func(con *websocket.Conn, msg []Message) error {
+			cupaloy.SnapshotT(t, msg)
+			return nil
+		},
+	}
+	w.SaveNodeStats(nodestats.Stats{
+		UptimeSeconds: 100,
+		Load1:         0.5,
+		CPUCount:      2,
+		MemoryTotalMb: 1000,
+		Filesystems:   []nodestats.Filesystem{{Mount: "/", Device: "/dev/sda1", Type: "ext4", TotalMb: 100, UsedMb: 50}},
+	}, "default")
+}
+
+type SnapshotTrackerMock struct {
+	TrackerMock
+	Top     *tracker.Top
+	Size    *tracker.Size
+	SizeErr error
+}
+
+func (t *SnapshotTrackerMock) GetTop(containerID string) (*tracker.Top, error) {
+	return t.Top, nil
+}
+
+func (t *SnapshotTrackerMock) GetSize(containerID string) (*tracker.Size, error) {
+	return t.Size, t.SizeErr
+}
+
+func TestHolder_getSnapshotInfo(t *testing.T) {
+	wayback := time.Date(1974, time.May, 19, 1, 2, 3, 4, time.UTC)
+	patch := monkey.Patch(time.Now, func() time.Time { return wayback })
+	defer patch.Unpatch()
+	top := &tracker.Top{ProcessCount: 1, Processes: []map[string]string{{"pid": "1", "cmd": "nginx"}}}
+	size := &tracker.Size{SizeRwMb: 1.5, SizeRootFsMb: 100}
+	tests := []struct {
+		name    string
+		arg     tracker.TrackElement
+		want    []MessageSubType
+		indexes []string
+	}{
+		{
+			name: "no snapshotter",
+			arg:  &TrackerMock{Con: types.Container{Names: []string{"mockContainer"}, Labels: map[string]string{"funk.log.top": "true"}}},
+		},
+		{
+			name: "no labels",
+			arg:  &SnapshotTrackerMock{TrackerMock: TrackerMock{Con: types.Container{Names: []string{"mockContainer"}}}, Top: top, Size: size},
+		},
+		{
+			name:    "top and size",
+			arg:     &SnapshotTrackerMock{TrackerMock: TrackerMock{Con: types.Container{Names: []string{"mockContainer"}, Labels: map[string]string{"funk.log.top": "true", "funk.log.size": "true"}}}, Top: top, Size: size},
+			want:    []MessageSubType{MessageSubTypeTop, MessageSubTypeSize},
+			indexes: []string{"MockIndex_top", "MockIndex_size"},
+		},
+		{
+			name:    "size has error",
+			arg:     &SnapshotTrackerMock{TrackerMock: TrackerMock{Con: types.Container{Names: []string{"mockContainer"}, Labels: map[string]string{"funk.log.top": "true", "funk.log.size": "true"}}}, Top: top, SizeErr: errors.New("mock error")},
+			want:    []MessageSubType{MessageSubTypeTop},
+			indexes: []string{"MockIndex_top"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Holder{itSelfNamedHost: "test_unit"}
+			var got []Message
+			if job, ok := w.getSnapshotJob(tt.arg); ok {
+				got = w.getSnapshotInfo(job)
+			}
+			var subTypes []MessageSubType
+			var indexes []string
+			for _, one := range got {
+				subTypes = append(subTypes, one.SubType)
+				indexes = append(indexes, one.SearchIndex)
+				if one.Type != MessageTypeStats {
+					t.Errorf("getSnapshotInfo() Type = %v, want STATS", one.Type)
+				}
+			}
+			if !reflect.DeepEqual(subTypes, tt.want) || !reflect.DeepEqual(indexes, tt.indexes) {
+				t.Errorf("getSnapshotInfo() = %v %v, want %v %v", subTypes, indexes, tt.want, tt.indexes)
+			}
+			if len(got) > 0 {
+				cupaloy.SnapshotT(t, got[0].Data)
+			}
+		})
+	}
+}
+
+func TestHolder_getStatsInfo_state(t *testing.T) {
+	inspect := &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		RestartCount: 2,
+		State: &types.ContainerState{
+			Status:  "running",
+			Running: true,
+			Health:  &types.Health{Status: "unhealthy", FailingStreak: 4, Log: []*types.HealthcheckResult{{ExitCode: 1, Output: "down"}}},
+		},
+	}}
+	for _, logStats := range []StatsLog{StatsLogAll, StatsLogCumulated} {
+		t.Run(string(logStats), func(t *testing.T) {
+			w := &Holder{Props: Props{LogStats: logStats}}
+			msg := w.getStatsInfo(&TrackerMock{Con: types.Container{Names: []string{"mockContainer"}}, Inspect: inspect}, tracker.CumulateStats{ContainerState: tracker.StateOf(inspect)})
+			var got map[string]interface{}
+			if err := json.Unmarshal([]byte(msg.Data[0]), &got); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]interface{}{"state": "running", "health_status": "unhealthy", "health_failing_streak": 4.0, "health_output": "down", "health_exit_code": 1.0, "restart_count": 2.0, "oom_killed": false, "exit_code": 0.0}
+			for key, value := range want {
+				if got[key] != value {
+					t.Errorf("getStatsInfo() %v = %v, want %v", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+type FilterTrackerMock struct {
+	TrackerMock
+	Counter tracker.FilterCounter
+}
+
+func (t *FilterTrackerMock) GetFilterCounter() tracker.FilterCounter {
+	return t.Counter
+}
+
+func TestHolder_getFilterCounterInfo(t *testing.T) {
+	w := &Holder{itSelfNamedHost: "test_unit"}
+	v := &FilterTrackerMock{TrackerMock: TrackerMock{Con: types.Container{Names: []string{"mockContainer"}}}}
+	if got := w.getFilterCounterInfo(v); got != nil {
+		t.Errorf("getFilterCounterInfo() without dropped lines = %+v, want nil", got)
+	}
+	v.Counter = tracker.FilterCounter{DroppedByDrop: 2, DroppedByLevel: 3}
+	got := w.getFilterCounterInfo(v)
+	if got == nil || got.Type != MessageTypeStats || got.SubType != MessageSubTypeFilter || got.SearchIndex != "MockIndex_filter" || got.Attributes.Host != "test_unit" {
+		t.Fatalf("getFilterCounterInfo() = %+v, want a FILTER stats message", got)
+	}
+	want := `{"dropped":5,"dropped_by_keep":0,"dropped_by_drop":2,"dropped_by_sample":0,"dropped_by_level":3}`
+	if len(got.Data) != 1 || got.Data[0] != want {
+		t.Errorf("getFilterCounterInfo() Data = %v, want %v", got.Data, want)
+	}
+}
+
+// trackerClientMock is a docker client of stopped containers without logs and stats
+type trackerClientMock struct{}
+
+func (m *trackerClientMock) ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (m *trackerClientMock) ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error) {
+	return types.ContainerStats{Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (m *trackerClientMock) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{}, errors.New("No such container: " + containerID)
+}
+
+func (m *trackerClientMock) ContainerInspectWithRaw(ctx context.Context, containerID string, getSize bool) (types.ContainerJSON, []byte, error) {
+	return types.ContainerJSON{}, nil, errors.New("No such container: " + containerID)
+}
+
+func (m *trackerClientMock) ContainerTop(ctx context.Context, containerID string, arguments []string) (types.ContainerProcessList, error) {
+	return types.ContainerProcessList{}, errors.New("No such container: " + containerID)
+}
+
+func TestHolder_removeMissingTrackers(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	keptCRI := types.Container{ID: "default_web_6f1e2b54/app", Names: []string{"/web/app"}}
+	removedCRI := types.Container{ID: "default_old_7a2c3d65/app", Names: []string{"/old/app"}}
+	keptDocker := types.Container{ID: "abc", Names: []string{"/web"}}
+	removedDocker := types.Container{ID: "def", Names: []string{"/old"}}
+	w := &Holder{trackingContainers: map[string]tracker.TrackElement{
+		keptCRI.ID:       tracker.NewCRITracker(root, keptCRI, tracker.Options{}),
+		removedCRI.ID:    tracker.NewCRITracker(root, removedCRI, tracker.Options{}),
+		keptDocker.ID:    tracker.NewTracker(&trackerClientMock{}, keptDocker, tracker.Options{}),
+		removedDocker.ID: tracker.NewTracker(&trackerClientMock{}, removedDocker, tracker.Options{}),
+		"syslog":         tracker.NewPushTracker(types.Container{ID: "syslog", Names: []string{"/syslog"}}, tracker.Options{}),
+	}}
+	w.removeMissingTrackers([]types.Container{keptCRI, keptDocker})
+	want := []string{"abc", "default_web_6f1e2b54/app", "syslog"}
+	var got []string
+	for id := range w.trackingContainers {
+		got = append(got, id)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("removeMissingTrackers() keeps %v, want %v", got, want)
+	}
+}
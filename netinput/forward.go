@@ -0,0 +1,273 @@
+package netinput
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/fasibio/funk_agent/logger"
+)
+
+// Record is one log record received by a network input
+type Record struct {
+	Tag    string
+	Time   time.Time
+	Fields map[string]interface{}
+	Sender string // Sender is the ip address the record is received from
+}
+
+// ForwardConfig configures the fluentd forward listener
+type ForwardConfig struct {
+	Addr         string // Addr to listen at like :24224
+	SharedKey    string // SharedKey enables the handshake of fluentd secure forward if set
+	SelfHostname string // SelfHostname is send to the clients at the handshake
+}
+
+// ForwardServer receives logs by the fluentd forward protocol (docker log driver fluentd, fluent-bit, fluentd).
+// It supports the Message, Forward, PackedForward and CompressedPackedForward mode and answers the chunk option with an ack
+type ForwardServer struct {
+	cfg      ForwardConfig
+	handler  func(Record)
+	listener net.Listener
+}
+
+// NewForwardServer creates a ForwardServer which calls handler for each received record
+func NewForwardServer(cfg ForwardConfig, handler func(Record)) *ForwardServer {
+	return &ForwardServer{
+		cfg:     cfg,
+		handler: handler,
+	}
+}
+
+// Listen opens the tcp listener
+func (s *ForwardServer) Listen() error {
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Addr returns the address the server listens at
+func (s *ForwardServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the listener
+func (s *ForwardServer) Close() error {
+	return s.listener.Close()
+}
+
+// Serve accepts connections until the listener is closed
+func (s *ForwardServer) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *ForwardServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	logs := logger.Get().With("input", "forward", "remote", conn.RemoteAddr().String())
+	reader := bufio.NewReader(conn)
+	decoder := newMsgpackDecoder(reader)
+	if s.cfg.SharedKey != "" {
+		if err := s.handshake(conn, decoder); err != nil {
+			logs.Warnw("Forward handshake failed: " + err.Error())
+			return
+		}
+	}
+	for {
+		value, err := decoder.Decode()
+		if err != nil {
+			if err != io.EOF {
+				logs.Warnw("Error by reading forward message: " + err.Error())
+			}
+			return
+		}
+		option, err := s.handleEntries(value, remoteIP(conn.RemoteAddr()))
+		if err != nil {
+			logs.Warnw("Error by reading forward message: " + err.Error())
+			return
+		}
+		if chunk, ok := option["chunk"]; ok {
+			ack, _ := encodeMsgpack(map[string]interface{}{"ack": toString(chunk)})
+			if _, err := conn.Write(ack); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handshake runs the shared key authentication (HELO, PING, PONG) of fluentd secure forward
+func (s *ForwardServer) handshake(conn net.Conn, decoder *msgpackDecoder) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	helo, _ := encodeMsgpack([]interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      []byte{},
+		"keepalive": true,
+	}})
+	if _, err := conn.Write(helo); err != nil {
+		return err
+	}
+	value, err := decoder.Decode()
+	if err != nil {
+		return err
+	}
+	ping, ok := value.([]interface{})
+	if !ok || len(ping) < 4 || toString(ping[0]) != "PING" {
+		return errors.New("no PING received")
+	}
+	hostname, salt, digest := toString(ping[1]), toString(ping[2]), toString(ping[3])
+	if digest != sharedKeyDigest(salt, hostname, nonce, s.cfg.SharedKey) {
+		pong, _ := encodeMsgpack([]interface{}{"PONG", false, "shared_key mismatch", "", ""})
+		conn.Write(pong)
+		return errors.New("shared_key mismatch from " + hostname)
+	}
+	pong, _ := encodeMsgpack([]interface{}{"PONG", true, "", s.cfg.SelfHostname, sharedKeyDigest(salt, s.cfg.SelfHostname, nonce, s.cfg.SharedKey)})
+	_, err = conn.Write(pong)
+	return err
+}
+
+func sharedKeyDigest(salt, hostname string, nonce []byte, sharedKey string) string {
+	h := sha512.New()
+	h.Write([]byte(salt))
+	h.Write([]byte(hostname))
+	h.Write(nonce)
+	h.Write([]byte(sharedKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handleEntries calls the handler for each record of a forward message and returns its option
+func (s *ForwardServer) handleEntries(value interface{}, sender string) (map[string]interface{}, error) {
+	message, ok := value.([]interface{})
+	if !ok || len(message) < 2 {
+		return nil, errors.New("forward message is no array")
+	}
+	tag := toString(message[0])
+	option := func(index int) map[string]interface{} {
+		if len(message) > index {
+			if res, ok := message[index].(map[string]interface{}); ok {
+				return res
+			}
+		}
+		return map[string]interface{}{}
+	}
+	switch entries := message[1].(type) {
+	case []interface{}:
+		for _, one := range entries {
+			entry, ok := one.([]interface{})
+			if !ok || len(entry) < 2 {
+				return nil, errors.New("forward entry is no array")
+			}
+			if err := s.handleRecord(tag, entry[0], entry[1], sender); err != nil {
+				return nil, err
+			}
+		}
+		return option(2), nil
+	case string, []byte:
+		opt := option(2)
+		var r io.Reader = bytes.NewReader([]byte(toString(entries)))
+		if toString(opt["compressed"]) == "gzip" {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		decoder := newMsgpackDecoder(r)
+		for {
+			one, err := decoder.Decode()
+			if err == io.EOF {
+				return opt, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			entry, ok := one.([]interface{})
+			if !ok || len(entry) < 2 {
+				return nil, errors.New("packed forward entry is no array")
+			}
+			if err := s.handleRecord(tag, entry[0], entry[1], sender); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(message) < 3 {
+		return nil, errors.New("forward message without record")
+	}
+	return option(3), s.handleRecord(tag, message[1], message[2], sender)
+}
+
+func (s *ForwardServer) handleRecord(tag string, eventTime, record interface{}, sender string) error {
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return errors.New("forward record is no map")
+	}
+	t, err := parseEventTime(eventTime)
+	if err != nil {
+		return err
+	}
+	s.handler(Record{
+		Tag:    tag,
+		Time:   t,
+		Fields: normaliseFields(fields).(map[string]interface{}),
+		Sender: sender,
+	})
+	return nil
+}
+
+// parseEventTime reads the time of an entry, unix seconds or the EventTime extension
+func parseEventTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case int64:
+		return time.Unix(v, 0), nil
+	case uint64:
+		return time.Unix(int64(v), 0), nil
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), nil
+	case msgpackExt:
+		if v.Type == 0 && len(v.Data) == 8 {
+			return time.Unix(int64(binary.BigEndian.Uint32(v.Data[:4])), int64(binary.BigEndian.Uint32(v.Data[4:]))), nil
+		}
+	}
+	return time.Time{}, errors.New("forward entry has no valid time")
+}
+
+// normaliseFields converts bin values to strings so the record can be written as json
+func normaliseFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case msgpackExt:
+		return nil
+	case []interface{}:
+		for i, one := range v {
+			v[i] = normaliseFields(one)
+		}
+	case map[string]interface{}:
+		for key, one := range v {
+			v[key] = normaliseFields(one)
+		}
+	}
+	return value
+}
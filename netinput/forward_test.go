@@ -0,0 +1,205 @@
+package netinput
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_msgpack(t *testing.T) {
+	values := []interface{}{
+		nil,
+		true,
+		false,
+		int64(1),
+		int64(-1),
+		int64(-100000),
+		"short",
+		string(bytes.Repeat([]byte("a"), 300)),
+		[]byte{1, 2, 3},
+		[]interface{}{"a", int64(2)},
+		map[string]interface{}{"key": "value", "list": []interface{}{true}},
+	}
+	for _, one := range values {
+		data, err := encodeMsgpack(one)
+		if err != nil {
+			t.Fatalf("encodeMsgpack(%v) error = %v", one, err)
+		}
+		got, err := newMsgpackDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			t.Fatalf("Decode(%v) error = %v", one, err)
+		}
+		if !reflect.DeepEqual(got, one) {
+			t.Errorf("Decode() = %#v, want %#v", got, one)
+		}
+	}
+	other := []struct {
+		data []byte
+		want interface{}
+	}{
+		{data: []byte{0xcc, 0xff}, want: uint64(255)},
+		{data: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, want: 1.5},
+		{data: []byte{0xd7, 0x00, 0x5d, 0x51, 0x60, 0x77, 0x00, 0x00, 0x00, 0x01}, want: msgpackExt{Type: 0, Data: []byte{0x5d, 0x51, 0x60, 0x77, 0, 0, 0, 1}}},
+	}
+	for _, one := range other {
+		got, err := newMsgpackDecoder(bytes.NewReader(one.data)).Decode()
+		if err != nil || !reflect.DeepEqual(got, one.want) {
+			t.Errorf("Decode(%x) = %#v, %v want %#v", one.data, got, err, one.want)
+		}
+	}
+}
+
+func TestMsgpackDecoder_MaxDepth(t *testing.T) {
+	nested := append(bytes.Repeat([]byte{0x91}, maxMsgpackDepth), 0xc0)
+	if _, err := newMsgpackDecoder(bytes.NewReader(nested)).Decode(); err != nil {
+		t.Errorf("Decode() of %d nested arrays error = %v", maxMsgpackDepth, err)
+	}
+	tooDeep := append(bytes.Repeat([]byte{0x81, 0xa1, 'k'}, maxMsgpackDepth+1), 0xc0)
+	if _, err := newMsgpackDecoder(bytes.NewReader(tooDeep)).Decode(); err == nil {
+		t.Errorf("Decode() of too deep nested maps has no error")
+	}
+	if _, err := newMsgpackDecoder(bytes.NewReader(bytes.Repeat([]byte{0x91}, 20<<20))).Decode(); err == nil {
+		t.Errorf("Decode() of 20 MB nested arrays has no error")
+	}
+}
+
+// eventTime returns the fluentd EventTime extension of 2019-08-12T12:49:59.000000001Z
+func eventTime() []byte {
+	return []byte{0xd7, 0x00, 0x5d, 0x51, 0x60, 0x77, 0x00, 0x00, 0x00, 0x01}
+}
+
+func mustEncode(t *testing.T, value interface{}) []byte {
+	res, err := encodeMsgpack(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func startForwardServer(t *testing.T, cfg ForwardConfig) (*ForwardServer, chan Record) {
+	records := make(chan Record, 10)
+	cfg.Addr = "127.0.0.1:0"
+	server := NewForwardServer(cfg, func(r Record) {
+		records <- r
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	return server, records
+}
+
+func receive(t *testing.T, records chan Record) Record {
+	select {
+	case res := <-records:
+		return res
+	case <-time.After(time.Second):
+		t.Fatal("no record received")
+	}
+	return Record{}
+}
+
+func TestForwardServer_modes(t *testing.T) {
+	server, records := startForwardServer(t, ForwardConfig{})
+	defer server.Close()
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	wantTime := time.Unix(1565614199, 1)
+	record := map[string]interface{}{"container_name": "/web", "log": "hello"}
+
+	// Message mode with the EventTime extension
+	message := []byte{0x93}
+	message = append(message, mustEncode(t, "docker.web")...)
+	message = append(message, eventTime()...)
+	message = append(message, mustEncode(t, record)...)
+	conn.Write(message)
+	got := receive(t, records)
+	if got.Tag != "docker.web" || !got.Time.Equal(wantTime) || !reflect.DeepEqual(got.Fields, record) {
+		t.Errorf("Message mode got %v", got)
+	}
+
+	// Forward mode
+	conn.Write(mustEncode(t, []interface{}{"docker.web", []interface{}{
+		[]interface{}{int64(1565614199), map[string]interface{}{"log": "one"}},
+		[]interface{}{int64(1565614199), map[string]interface{}{"log": "two"}},
+	}}))
+	for _, want := range []string{"one", "two"} {
+		if got := receive(t, records); got.Fields["log"] != want || !got.Time.Equal(time.Unix(1565614199, 0)) {
+			t.Errorf("Forward mode got %v want log %v", got, want)
+		}
+	}
+
+	// CompressedPackedForward mode with chunk ack
+	var packed bytes.Buffer
+	gz := gzip.NewWriter(&packed)
+	gz.Write([]byte{0x92})
+	gz.Write(eventTime())
+	gz.Write(mustEncode(t, map[string]interface{}{"log": []byte("packed")}))
+	gz.Close()
+	conn.Write(mustEncode(t, []interface{}{"docker.web", packed.Bytes(), map[string]interface{}{"compressed": "gzip", "chunk": "p8n9gmxTQVC8/nh2wlKKeQ=="}}))
+	if got := receive(t, records); got.Fields["log"] != "packed" {
+		t.Errorf("CompressedPackedForward mode got %v", got)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	ack, err := newMsgpackDecoder(bufio.NewReader(conn)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"ack": "p8n9gmxTQVC8/nh2wlKKeQ=="}; !reflect.DeepEqual(ack, want) {
+		t.Errorf("ack = %v, want %v", ack, want)
+	}
+}
+
+func TestForwardServer_handshake(t *testing.T) {
+	server, records := startForwardServer(t, ForwardConfig{SharedKey: "secret", SelfHostname: "agent"})
+	defer server.Close()
+	for _, tt := range []struct {
+		name      string
+		sharedKey string
+		want      bool
+	}{
+		{name: "right shared key", sharedKey: "secret", want: true},
+		{name: "wrong shared key", sharedKey: "wrong", want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", server.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			decoder := newMsgpackDecoder(bufio.NewReader(conn))
+			helo, err := decoder.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nonce := helo.([]interface{})[1].(map[string]interface{})["nonce"].([]byte)
+			conn.Write(mustEncode(t, []interface{}{"PING", "client", "salt", sharedKeyDigest("salt", "client", nonce, tt.sharedKey), "", ""}))
+			pong, err := decoder.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pongValues := pong.([]interface{})
+			if pongValues[1] != tt.want {
+				t.Fatalf("PONG = %v, want auth %v", pong, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if pongValues[4] != sharedKeyDigest("salt", "agent", nonce, "secret") {
+				t.Errorf("PONG digest = %v", pongValues[4])
+			}
+			conn.Write(mustEncode(t, []interface{}{"app", int64(1565614199), map[string]interface{}{"message": "authenticated"}}))
+			if got := receive(t, records); got.Fields["message"] != "authenticated" {
+				t.Errorf("after handshake got %v", got)
+			}
+		})
+	}
+}
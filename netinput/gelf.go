@@ -0,0 +1,187 @@
+package netinput
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fasibio/funk_agent/logger"
+)
+
+const (
+	// maxGELFMessage limits the length of a (decompressed) gelf message
+	maxGELFMessage = 8 << 20
+	// maxGELFChunks is the maximum count of chunks of one message given by the gelf specification
+	maxGELFChunks = 128
+	// gelfChunkTimeout drops incomplete chunked messages after this time
+	gelfChunkTimeout = 5 * time.Second
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// ParseGELF reads a gelf message (plain, gzip or zlib compressed json).
+// The fields are message (short_message), full_message, hostname (host), level and the additional fields without the leading underscore.
+// The docker log driver gelf adds container_id, container_name, image_name, tag, ... this way
+func ParseGELF(data []byte, now time.Time) (Record, error) {
+	var reader io.Reader = bytes.NewReader(data)
+	switch {
+	case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return Record{}, err
+		}
+		defer gz.Close()
+		reader = gz
+	case len(data) > 2 && data[0] == 0x78:
+		z, err := zlib.NewReader(reader)
+		if err != nil {
+			return Record{}, err
+		}
+		defer z.Close()
+		reader = z
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(reader, maxGELFMessage))
+	if err != nil {
+		return Record{}, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return Record{}, err
+	}
+	res := Record{Time: now, Fields: map[string]interface{}{}}
+	for key, value := range values {
+		switch key {
+		case "version", "_id":
+		case "short_message":
+			res.Fields["message"] = value
+		case "host":
+			res.Fields["hostname"] = value
+		case "timestamp":
+			if seconds, ok := value.(float64); ok {
+				whole, fraction := math.Modf(seconds)
+				res.Time = time.Unix(int64(whole), int64(math.Round(fraction*1000))*int64(time.Millisecond))
+			}
+		default:
+			res.Fields[strings.TrimPrefix(key, "_")] = value
+		}
+	}
+	if _, ok := res.Fields["message"]; !ok {
+		return Record{}, errors.New("gelf message without short_message")
+	}
+	res.Tag, _ = res.Fields["tag"].(string)
+	return res, nil
+}
+
+// gelfChunks collects the chunks of one message
+type gelfChunks struct {
+	parts    [][]byte
+	received int
+	first    time.Time
+}
+
+// GELFServer receives gelf messages by udp (chunked and compressed) and tcp (null byte separated)
+type GELFServer struct {
+	dualListener
+	handler func(Record)
+	chunks  map[string]*gelfChunks
+}
+
+// NewGELFServer creates a GELFServer listening at addr which calls handler for each received message
+func NewGELFServer(addr string, handler func(Record)) *GELFServer {
+	return &GELFServer{
+		dualListener: dualListener{addr: addr},
+		handler:      handler,
+		chunks:       make(map[string]*gelfChunks),
+	}
+}
+
+// Listen opens the udp and tcp listener
+func (s *GELFServer) Listen() error {
+	return s.listen()
+}
+
+// Serve receives messages until the listeners are closed
+func (s *GELFServer) Serve() {
+	s.serve(func(data []byte, from string) {
+		if data = s.addChunk(data, time.Now()); data != nil {
+			s.handle(data, from)
+		}
+	}, s.handleConn)
+}
+
+// addChunk returns the complete message of a datagram or nil if chunks of the message are missing.
+// It is only called by the udp go routine
+func (s *GELFServer) addChunk(data []byte, now time.Time) []byte {
+	for id, one := range s.chunks {
+		if now.Sub(one.first) > gelfChunkTimeout {
+			delete(s.chunks, id)
+		}
+	}
+	if !bytes.HasPrefix(data, gelfChunkMagic) {
+		return data
+	}
+	if len(data) < 12 {
+		return nil
+	}
+	id, seq, count := string(data[2:10]), int(data[10]), int(data[11])
+	if count == 0 || count > maxGELFChunks || seq >= count {
+		return nil
+	}
+	message, exist := s.chunks[id]
+	if !exist {
+		message = &gelfChunks{parts: make([][]byte, count), first: now}
+		s.chunks[id] = message
+	}
+	if len(message.parts) != count || message.parts[seq] != nil {
+		return nil
+	}
+	message.parts[seq] = data[12:]
+	message.received++
+	if message.received < count {
+		return nil
+	}
+	delete(s.chunks, id)
+	return bytes.Join(message.parts, nil)
+}
+
+func (s *GELFServer) handle(data []byte, from string) {
+	record, err := ParseGELF(data, time.Now())
+	if err != nil {
+		logger.Get().Debugw("Error by reading gelf message: "+err.Error(), "remote", from)
+		return
+	}
+	record.Sender = from
+	s.handler(record)
+}
+
+func (s *GELFServer) handleConn(conn net.Conn) {
+	from := remoteIP(conn.RemoteAddr())
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxGELFMessage)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		if data := bytes.TrimSpace(scanner.Bytes()); len(data) > 0 {
+			s.handle(data, from)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Get().Warnw("Error by reading gelf stream: "+err.Error(), "remote", from)
+	}
+}
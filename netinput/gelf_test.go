@@ -0,0 +1,130 @@
+package netinput
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const gelfMessage = `{"version":"1.1","host":"dockerhost","short_message":"hello","timestamp":1578694455.25,"level":3,"_container_id":"abc","_container_name":"web","_tag":"abc"}`
+
+func compress(t *testing.T, zip func(w io.Writer) io.WriteCloser) []byte {
+	var res bytes.Buffer
+	w := zip(&res)
+	if _, err := w.Write([]byte(gelfMessage)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return res.Bytes()
+}
+
+func TestParseGELF(t *testing.T) {
+	want := Record{
+		Tag:  "abc",
+		Time: time.Date(2020, time.January, 10, 22, 14, 15, 250000000, time.UTC),
+		Fields: map[string]interface{}{
+			"hostname":       "dockerhost",
+			"message":        "hello",
+			"level":          float64(3),
+			"container_id":   "abc",
+			"container_name": "web",
+			"tag":            "abc",
+		},
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "plain", data: []byte(gelfMessage)},
+		{name: "gzip", data: compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		{name: "zlib", data: compress(t, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+		{name: "no short_message", data: []byte(`{"version":"1.1","host":"dockerhost"}`), wantErr: true},
+		{name: "no json", data: []byte(`hello`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGELF(tt.data, time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGELF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Tag != want.Tag || !got.Time.Equal(want.Time) || !reflect.DeepEqual(got.Fields, want.Fields) {
+				t.Errorf("ParseGELF() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func gelfChunk(id string, seq, count byte, data string) []byte {
+	res := append([]byte{}, gelfChunkMagic...)
+	res = append(res, id...)
+	res = append(res, seq, count)
+	return append(res, data...)
+}
+
+func TestGELFServer_addChunk(t *testing.T) {
+	now := time.Now()
+	s := NewGELFServer("", nil)
+	if got := s.addChunk([]byte("plain"), now); string(got) != "plain" {
+		t.Errorf("addChunk() of plain message = %s", got)
+	}
+	if got := s.addChunk(gelfChunk("message1", 1, 2, "world"), now); got != nil {
+		t.Errorf("addChunk() of first chunk = %s, want nil", got)
+	}
+	if got := s.addChunk(gelfChunk("message1", 1, 2, "world"), now); got != nil {
+		t.Errorf("addChunk() of duplicated chunk = %s, want nil", got)
+	}
+	if got := s.addChunk(gelfChunk("message1", 0, 2, "hello "), now); string(got) != "hello world" {
+		t.Errorf("addChunk() of last chunk = %s", got)
+	}
+	s.addChunk(gelfChunk("message2", 0, 2, "hello "), now)
+	if got := s.addChunk(gelfChunk("message2", 1, 2, "world"), now.Add(gelfChunkTimeout+time.Second)); got != nil {
+		t.Errorf("addChunk() after timeout = %s, want nil", got)
+	}
+	if got := s.addChunk(gelfChunk("message3", 0, maxGELFChunks+1, "x"), now); got != nil || len(s.chunks) != 1 {
+		t.Errorf("addChunk() with too many chunks = %s, chunks %v", got, s.chunks)
+	}
+}
+
+func TestGELFServer(t *testing.T) {
+	records := make(chan Record, 10)
+	server := NewGELFServer("127.0.0.1:0", func(r Record) {
+		records <- r
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	udp, err := net.Dial("udp", server.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	udp.Write(gelfChunk("message1", 0, 2, gelfMessage[:20]))
+	udp.Write(gelfChunk("message1", 1, 2, gelfMessage[20:]))
+	if got := receive(t, records); got.Fields["message"] != "hello" || got.Sender != "127.0.0.1" {
+		t.Errorf("udp got %v", got)
+	}
+
+	tcp, err := net.Dial("tcp", server.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	tcp.Write([]byte(gelfMessage + "\x00" + `{"short_message":"second"}` + "\x00"))
+	for _, want := range []string{"hello", "second"} {
+		if got := receive(t, records); got.Fields["message"] != want {
+			t.Errorf("tcp got %v want message %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package netinput
+
+import (
+	"net"
+	"sync"
+)
+
+// maxPacketSize is the biggest udp datagram
+const maxPacketSize = 65536
+
+// dualListener listens with udp and tcp at the same address like syslog and gelf do
+type dualListener struct {
+	addr   string
+	packet net.PacketConn
+	stream net.Listener
+}
+
+func (l *dualListener) listen() error {
+	packet, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return err
+	}
+	stream, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		packet.Close()
+		return err
+	}
+	l.packet = packet
+	l.stream = stream
+	return nil
+}
+
+// UDPAddr returns the address the udp listener listens at
+func (l *dualListener) UDPAddr() net.Addr {
+	return l.packet.LocalAddr()
+}
+
+// TCPAddr returns the address the tcp listener listens at
+func (l *dualListener) TCPAddr() net.Addr {
+	return l.stream.Addr()
+}
+
+// Close stops both listeners
+func (l *dualListener) Close() error {
+	errPacket := l.packet.Close()
+	if err := l.stream.Close(); err != nil {
+		return err
+	}
+	return errPacket
+}
+
+// serve calls onPacket for each datagram and onConn (in own go routine) for each connection until the listeners are closed
+func (l *dualListener) serve(onPacket func(data []byte, from string), onConn func(conn net.Conn)) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, from, err := l.packet.ReadFrom(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				return
+			}
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			onPacket(data, remoteIP(from))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.stream.Accept()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				return
+			}
+			go func() {
+				defer conn.Close()
+				onConn(conn)
+			}()
+		}
+	}()
+	wg.Wait()
+}
+
+// remoteIP returns the ip address without the port
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,286 @@
+package netinput
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// msgpackExt is a msgpack extension type like the fluentd EventTime (type 0)
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// maxMsgpackLength limits the length of strings, binaries, arrays and maps so a broken stream can not allocate everything
+const maxMsgpackLength = 64 << 20
+
+// maxMsgpackDepth limits the nesting of arrays and maps so a sender can not overflow the stack
+const maxMsgpackDepth = 64
+
+// msgpackDecoder reads msgpack values. Maps are returned as map[string]interface{},
+// str as string, bin as []byte, signed integers as int64 and unsigned as uint64
+type msgpackDecoder struct {
+	r io.Reader
+}
+
+func newMsgpackDecoder(r io.Reader) *msgpackDecoder {
+	return &msgpackDecoder{r: r}
+}
+
+func (d *msgpackDecoder) read(n uint64) ([]byte, error) {
+	if n > maxMsgpackLength {
+		return nil, fmt.Errorf("msgpack value too long: %d", n)
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(d.r, buf)
+	return buf, err
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	buf, err := d.read(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(buf)), nil
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// Decode reads the next value
+func (d *msgpackDecoder) Decode() (interface{}, error) {
+	return d.decode(0)
+}
+
+// decode reads the next value nested inside depth arrays or maps
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxMsgpackDepth {
+		return nil, fmt.Errorf("msgpack value nested deeper than %d", maxMsgpackDepth)
+	}
+	head, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	b := head[0]
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.decodeMap(uint64(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return d.decodeArray(uint64(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return d.decodeString(uint64(b & 0x1f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readUint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.read(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readUint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		n, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readUint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.readUint(1 << (b - 0xcc))
+	case 0xd0:
+		n, err := d.readUint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.readUint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.readUint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.readUint(8)
+		return int64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readUint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readUint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.readUint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+	}
+	return nil, fmt.Errorf("unknown msgpack type 0x%x", b)
+}
+
+func (d *msgpackDecoder) decodeString(n uint64) (interface{}, error) {
+	buf, err := d.read(n)
+	return string(buf), err
+}
+
+func (d *msgpackDecoder) decodeExt(n uint64) (interface{}, error) {
+	typ, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.read(n)
+	return msgpackExt{Type: int8(typ[0]), Data: data}, err
+}
+
+func (d *msgpackDecoder) decodeArray(n uint64, depth int) (interface{}, error) {
+	if n > maxMsgpackLength {
+		return nil, fmt.Errorf("msgpack array too long: %d", n)
+	}
+	res := make([]interface{}, 0, minLength(n))
+	for i := uint64(0); i < n; i++ {
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, value)
+	}
+	return res, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n uint64, depth int) (interface{}, error) {
+	if n > maxMsgpackLength {
+		return nil, fmt.Errorf("msgpack map too long: %d", n)
+	}
+	res := make(map[string]interface{}, minLength(n))
+	for i := uint64(0); i < n; i++ {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		res[toString(key)] = value
+	}
+	return res, nil
+}
+
+// minLength limits the preallocation, the real length is only known after reading
+func minLength(n uint64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
+
+// toString returns str and bin values as string
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// encodeMsgpack encodes the values used by the forward protocol answers
+func encodeMsgpack(value interface{}) ([]byte, error) {
+	var res []byte
+	err := appendMsgpack(&res, value)
+	return res, err
+}
+
+func appendLength(buf *[]byte, n int, fix, fixMax byte, codes [3]byte) {
+	switch {
+	case fixMax > 0 && n <= int(fixMax):
+		*buf = append(*buf, fix|byte(n))
+	case codes[0] != 0 && n <= math.MaxUint8:
+		*buf = append(*buf, codes[0], byte(n))
+	case n <= math.MaxUint16:
+		*buf = append(*buf, codes[1], byte(n>>8), byte(n))
+	default:
+		*buf = append(*buf, codes[2], byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpack(buf *[]byte, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*buf = append(*buf, 0xc0)
+	case bool:
+		if v {
+			*buf = append(*buf, 0xc3)
+		} else {
+			*buf = append(*buf, 0xc2)
+		}
+	case int:
+		return appendMsgpack(buf, int64(v))
+	case int64:
+		if v >= 0 && v <= 0x7f {
+			*buf = append(*buf, byte(v))
+			return nil
+		}
+		*buf = append(*buf, 0xd3)
+		*buf = append(*buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64((*buf)[len(*buf)-8:], uint64(v))
+	case string:
+		appendLength(buf, len(v), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+		*buf = append(*buf, v...)
+	case []byte:
+		appendLength(buf, len(v), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+		*buf = append(*buf, v...)
+	case []interface{}:
+		appendLength(buf, len(v), 0x90, 15, [3]byte{0, 0xdc, 0xdd})
+		for _, one := range v {
+			if err := appendMsgpack(buf, one); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		appendLength(buf, len(v), 0x80, 15, [3]byte{0, 0xde, 0xdf})
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			appendMsgpack(buf, key)
+			if err := appendMsgpack(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("msgpack can not encode " + fmt.Sprintf("%T", value))
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package netinput
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fasibio/funk_agent/logger"
+)
+
+// maxSyslogMessage limits the length of a syslog message received by tcp
+const maxSyslogMessage = 1 << 20
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// ParseSyslog reads a RFC5424 or RFC3164 syslog message.
+// The fields are message, hostname, appname, procid, msgid, facility, level (the syslog severity) and structured_data.
+// Messages without a readable timestamp get the time now
+func ParseSyslog(msg string, now time.Time) (Record, error) {
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	if !strings.HasPrefix(msg, "<") {
+		return Record{}, errors.New("syslog message without priority")
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return Record{}, errors.New("syslog message without priority")
+	}
+	priority, err := strconv.Atoi(msg[1:end])
+	if err != nil || priority > 191 {
+		return Record{}, errors.New("syslog message with invalid priority")
+	}
+	fields := map[string]interface{}{
+		"facility": syslogFacilities[priority/8],
+		"level":    priority % 8,
+	}
+	res := Record{Time: now, Fields: fields}
+	rest := msg[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		parseRFC5424(rest[2:], &res)
+	} else {
+		parseRFC3164(rest, &res)
+	}
+	res.Tag, _ = fields["appname"].(string)
+	return res, nil
+}
+
+// nextField returns the text until the next space and the text behind it
+func nextField(text string) (string, string) {
+	if i := strings.IndexByte(text, ' '); i >= 0 {
+		return text[:i], text[i+1:]
+	}
+	return text, ""
+}
+
+func setField(fields map[string]interface{}, key, value string) {
+	if value != "" && value != "-" {
+		fields[key] = value
+	}
+}
+
+// parseRFC5424 reads TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func parseRFC5424(text string, res *Record) {
+	var timestamp, hostname, appname, procid, msgid string
+	timestamp, text = nextField(text)
+	hostname, text = nextField(text)
+	appname, text = nextField(text)
+	procid, text = nextField(text)
+	msgid, text = nextField(text)
+	if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		res.Time = t
+	}
+	setField(res.Fields, "hostname", hostname)
+	setField(res.Fields, "appname", appname)
+	setField(res.Fields, "procid", procid)
+	setField(res.Fields, "msgid", msgid)
+	if strings.HasPrefix(text, "-") {
+		text = strings.TrimPrefix(text[1:], " ")
+	} else if strings.HasPrefix(text, "[") {
+		var data map[string]interface{}
+		data, text = parseStructuredData(text)
+		if len(data) != 0 {
+			res.Fields["structured_data"] = data
+		}
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+	setField(res.Fields, "message", text)
+}
+
+// parseStructuredData reads [id key="value" ...][id2 ...] and returns the text behind it
+func parseStructuredData(text string) (map[string]interface{}, string) {
+	res := map[string]interface{}{}
+	for strings.HasPrefix(text, "[") {
+		end := strings.IndexAny(text, " ]")
+		if end < 0 {
+			return res, ""
+		}
+		params := map[string]interface{}{}
+		res[text[1:end]] = params
+		text = text[end:]
+		for strings.HasPrefix(text, " ") {
+			text = strings.TrimLeft(text, " ")
+			eq := strings.Index(text, "=\"")
+			if eq < 0 {
+				return res, ""
+			}
+			name := text[:eq]
+			text = text[eq+2:]
+			var value strings.Builder
+			for len(text) > 0 && text[0] != '"' {
+				if text[0] == '\\' && len(text) > 1 {
+					text = text[1:]
+				}
+				r, size := utf8.DecodeRuneInString(text)
+				value.WriteRune(r)
+				text = text[size:]
+			}
+			params[name] = value.String()
+			text = strings.TrimPrefix(text, "\"")
+		}
+		text = strings.TrimPrefix(text, "]")
+	}
+	return res, strings.TrimPrefix(text, " ")
+}
+
+// parseRFC3164 reads Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG.
+// The year is missing at RFC3164 so the year of now is used
+func parseRFC3164(text string, res *Record) {
+	if len(text) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, text[:len(time.Stamp)], res.Time.Location()); err == nil {
+			t = t.AddDate(res.Time.Year(), 0, 0)
+			if t.After(res.Time.AddDate(0, 1, 0)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			res.Time = t
+			var hostname string
+			hostname, text = nextField(strings.TrimPrefix(text[len(time.Stamp):], " "))
+			setField(res.Fields, "hostname", hostname)
+		}
+	}
+	if colon := strings.Index(text, ": "); colon > 0 && !strings.ContainsAny(text[:colon], " ") {
+		tag := text[:colon]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			setField(res.Fields, "procid", tag[open+1:len(tag)-1])
+			tag = tag[:open]
+		}
+		setField(res.Fields, "appname", tag)
+		text = text[colon+2:]
+	}
+	setField(res.Fields, "message", text)
+}
+
+// SyslogServer receives RFC5424 and RFC3164 syslog messages by udp and tcp (octet counting or newline separated)
+type SyslogServer struct {
+	dualListener
+	handler func(Record)
+}
+
+// NewSyslogServer creates a SyslogServer listening at addr which calls handler for each received message
+func NewSyslogServer(addr string, handler func(Record)) *SyslogServer {
+	return &SyslogServer{
+		dualListener: dualListener{addr: addr},
+		handler:      handler,
+	}
+}
+
+// Listen opens the udp and tcp listener
+func (s *SyslogServer) Listen() error {
+	return s.listen()
+}
+
+// Serve receives messages until the listeners are closed
+func (s *SyslogServer) Serve() {
+	s.serve(func(data []byte, from string) {
+		s.handle(string(data), from)
+	}, s.handleConn)
+}
+
+func (s *SyslogServer) handle(msg, from string) {
+	record, err := ParseSyslog(msg, time.Now())
+	if err != nil {
+		logger.Get().Debugw("Error by reading syslog message: "+err.Error(), "remote", from)
+		return
+	}
+	record.Sender = from
+	s.handler(record)
+}
+
+func (s *SyslogServer) handleConn(conn net.Conn) {
+	from := remoteIP(conn.RemoteAddr())
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := readSyslogFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				logger.Get().Warnw("Error by reading syslog stream: "+err.Error(), "remote", from)
+			}
+			return
+		}
+		if strings.TrimSpace(msg) != "" {
+			s.handle(msg, from)
+		}
+	}
+}
+
+// readSyslogFrame reads one message framed by octet counting (RFC6587 "123 <34>...") or by newline
+func readSyslogFrame(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil || n > maxSyslogMessage {
+			return "", errors.New("invalid syslog frame length " + length)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	var line []byte
+	for {
+		part, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > maxSyslogMessage {
+			return "", errors.New("syslog message too long")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package netinput
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2020, time.January, 10, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		msg     string
+		want    Record
+		wantErr bool
+	}{
+		{
+			name: "RFC5424 with structured data",
+			msg:  `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Appli\"cation"][origin ip="192.0.2.1"] ` + "\ufeff" + `An application event log entry...`,
+			want: Record{
+				Tag:  "evntslog",
+				Time: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Fields: map[string]interface{}{
+					"facility": "local4",
+					"level":    5,
+					"hostname": "mymachine.example.com",
+					"appname":  "evntslog",
+					"msgid":    "ID47",
+					"structured_data": map[string]interface{}{
+						"exampleSDID@32473": map[string]interface{}{"iut": "3", "eventSource": `Appli"cation`},
+						"origin":            map[string]interface{}{"ip": "192.0.2.1"},
+					},
+					"message": "An application event log entry...",
+				},
+			},
+		},
+		{
+			name: "RFC5424 without structured data",
+			msg:  "<34>1 2003-10-11T22:14:15.003Z mymachine su 123 - - 'su root' failed\n",
+			want: Record{
+				Tag:  "su",
+				Time: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Fields: map[string]interface{}{
+					"facility": "auth",
+					"level":    2,
+					"hostname": "mymachine",
+					"appname":  "su",
+					"procid":   "123",
+					"message":  "'su root' failed",
+				},
+			},
+		},
+		{
+			name: "RFC3164 of the docker log driver syslog",
+			msg:  "<30>Jan  9 22:14:15 dockerhost 0123456789ab[42]: hello world",
+			want: Record{
+				Tag:  "0123456789ab",
+				Time: time.Date(2020, time.January, 9, 22, 14, 15, 0, time.UTC),
+				Fields: map[string]interface{}{
+					"facility": "daemon",
+					"level":    6,
+					"hostname": "dockerhost",
+					"appname":  "0123456789ab",
+					"procid":   "42",
+					"message":  "hello world",
+				},
+			},
+		},
+		{
+			name: "RFC3164 of last year",
+			msg:  "<13>Dec 31 23:59:59 router kernel: link down",
+			want: Record{
+				Tag:  "kernel",
+				Time: time.Date(2019, time.December, 31, 23, 59, 59, 0, time.UTC),
+				Fields: map[string]interface{}{
+					"facility": "user",
+					"level":    5,
+					"hostname": "router",
+					"appname":  "kernel",
+					"message":  "link down",
+				},
+			},
+		},
+		{
+			name: "RFC3164 without timestamp",
+			msg:  "<13>just a message",
+			want: Record{
+				Time: now,
+				Fields: map[string]interface{}{
+					"facility": "user",
+					"level":    5,
+					"message":  "just a message",
+				},
+			},
+		},
+		{
+			name:    "no priority",
+			msg:     "hello",
+			wantErr: true,
+		},
+		{
+			name:    "invalid priority",
+			msg:     "<999>hello",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSyslog(tt.msg, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSyslog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Tag != tt.want.Tag || !got.Time.Equal(tt.want.Time) || !reflect.DeepEqual(got.Fields, tt.want.Fields) {
+				t.Errorf("ParseSyslog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readSyslogFrame(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("11 <13>a\nb c d<13>newline\n<13>last"))
+	for _, want := range []string{"<13>a\nb c d", "<13>newline"} {
+		got, err := readSyslogFrame(reader)
+		if err != nil || got != want {
+			t.Errorf("readSyslogFrame() = %q, %v want %q", got, err, want)
+		}
+	}
+	if got, err := readSyslogFrame(reader); err != nil || got != "<13>last" {
+		t.Errorf("readSyslogFrame() = %q, %v want the last line", got, err)
+	}
+}
+
+func TestSyslogServer(t *testing.T) {
+	records := make(chan Record, 10)
+	server := NewSyslogServer("127.0.0.1:0", func(r Record) {
+		records <- r
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	udp, err := net.Dial("udp", server.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	udp.Write([]byte("<13>Jan  9 22:14:15 router kernel: by udp"))
+	if got := receive(t, records); got.Fields["message"] != "by udp" || got.Sender != "127.0.0.1" {
+		t.Errorf("udp got %v", got)
+	}
+
+	tcp, err := net.Dial("tcp", server.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	tcp.Write([]byte("<13>Jan  9 22:14:15 router kernel: by tcp\n"))
+	if got := receive(t, records); got.Fields["message"] != "by tcp" || got.Sender != "127.0.0.1" {
+		t.Errorf("tcp got %v", got)
+	}
+}
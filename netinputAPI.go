@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logger"
+	"github.com/fasibio/funk_agent/netinput"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+const (
+	// recordBufferSize is the count of records the network inputs receive while the trackers are locked (like during the upload)
+	recordBufferSize = 10000
+	// maxNetworkTrackers is the count of trackers the network inputs create at most, every sender and tag of syslog and gelf gets its own
+	maxNetworkTrackers = 1000
+	// networkTrackerIdle is the time without loglines after a tracker of the network inputs is removed
+	networkTrackerIdle = time.Hour
+	// containerIndexInterval is the time the index of the container names is not built again after a miss
+	containerIndexInterval = time.Second
+)
+
+// networkInputs are the prefixes of the keys of the trackers created by the network inputs
+var networkInputs = []string{"fluentd:", "syslog:", "gelf:"}
+
+// containerIndex finds the tracked containers by short id or name without looking at all trackers for each record
+type containerIndex struct {
+	ids     map[string]string
+	builtAt time.Time
+}
+
+// bufferRecords returns a handler for the records of a network input which queues them, so the listener does not wait for the lock of trackingContainers.
+// push is called with the lock held, all records in the queue are pushed at one lock. If the queue is full the handler waits
+func bufferRecords(mu *sync.Mutex, push func(record netinput.Record)) func(record netinput.Record) {
+	records := make(chan netinput.Record, recordBufferSize)
+	go func() {
+		for record := range records {
+			mu.Lock()
+			push(record)
+			for i := len(records); i > 0; i-- {
+				push(<-records)
+			}
+			mu.Unlock()
+		}
+	}()
+	return func(record netinput.Record) {
+		records <- record
+	}
+}
+
+// StartForwardInput listens for the fluentd forward protocol (docker log driver fluentd, fluent-bit, fluentd).
+// The records are given to the tracker of the container named in the record
+func (w *Holder) StartForwardInput(cfg netinput.ForwardConfig, mu *sync.Mutex) error {
+	server := netinput.NewForwardServer(cfg, bufferRecords(mu, w.pushForwardRecord))
+	if err := server.Listen(); err != nil {
+		return err
+	}
+	logger.Get().Infow("Listen for fluentd forward protocol", "addr", server.Addr().String())
+	go server.Serve()
+	return nil
+}
+
+// StartSyslogInput listens for RFC5424 and RFC3164 syslog messages by udp and tcp at addr.
+// Messages of senders which are no tracked container are send to searchIndex
+func (w *Holder) StartSyslogInput(addr, searchIndex string, mu *sync.Mutex) error {
+	server := netinput.NewSyslogServer(addr, bufferRecords(mu, func(record netinput.Record) {
+		w.pushSyslogRecord(record, searchIndex)
+	}))
+	if err := server.Listen(); err != nil {
+		return err
+	}
+	logger.Get().Infow("Listen for syslog", "udp", server.UDPAddr().String(), "tcp", server.TCPAddr().String())
+	go server.Serve()
+	return nil
+}
+
+// StartGELFInput listens for gelf messages by udp and tcp at addr.
+// Messages of senders which are no tracked container are send to searchIndex
+func (w *Holder) StartGELFInput(addr, searchIndex string, mu *sync.Mutex) error {
+	server := netinput.NewGELFServer(addr, bufferRecords(mu, func(record netinput.Record) {
+		w.pushGELFRecord(record, searchIndex)
+	}))
+	if err := server.Listen(); err != nil {
+		return err
+	}
+	logger.Get().Infow("Listen for gelf", "udp", server.UDPAddr().String(), "tcp", server.TCPAddr().String())
+	go server.Serve()
+	return nil
+}
+
+// pushForwardRecord maps the fields container_id and container_name (set by the docker log driver fluentd) or the tag to a container.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) pushForwardRecord(record netinput.Record) {
+	containerID, _ := record.Fields["container_id"].(string)
+	containerName, _ := record.Fields["container_name"].(string)
+	key, container := w.recordContainer("fluentd", containerID, record.Tag, getFilledValue(containerName, "/"+record.Tag), "")
+	w.pushRecord(key, container, record, forwardLogline(record.Fields))
+}
+
+// pushSyslogRecord maps the appname to a tracked container (the docker log driver syslog uses the short container id as default tag).
+// Other messages get a container per sender and appname.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) pushSyslogRecord(record netinput.Record, searchIndex string) {
+	hostname, _ := record.Fields["hostname"].(string)
+	name := getFilledValue(record.Tag, getFilledValue(hostname, record.Sender))
+	key, container := w.recordContainer("syslog", w.findContainerID(record.Tag), record.Sender+"/"+hostname+"/"+record.Tag, "/"+name, searchIndex)
+	w.pushRecord(key, container, record, jsonLogline(record.Fields))
+}
+
+// pushGELFRecord maps the field container_id (set by the docker log driver gelf) to a container.
+// Other messages get a container per sender and tag.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) pushGELFRecord(record netinput.Record, searchIndex string) {
+	hostname, _ := record.Fields["hostname"].(string)
+	containerID, _ := record.Fields["container_id"].(string)
+	containerName, _ := record.Fields["container_name"].(string)
+	name := getFilledValue(containerName, getFilledValue(record.Tag, getFilledValue(hostname, record.Sender)))
+	key, container := w.recordContainer("gelf", containerID, record.Sender+"/"+hostname+"/"+record.Tag, "/"+strings.TrimPrefix(name, "/"), searchIndex)
+	w.pushRecord(key, container, record, jsonLogline(record.Fields))
+}
+
+// recordContainer returns the key of the PushTracker and the container of a record received by input.
+// A tracked container with containerID is used with its labels and metadata. Else a container with name and searchIndex is created.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) recordContainer(input, containerID, fallbackID, name, searchIndex string) (string, types.Container) {
+	container := types.Container{
+		ID:     input + ":" + fallbackID,
+		Names:  []string{name},
+		Labels: map[string]string{},
+	}
+	if searchIndex != "" {
+		container.Labels["funk.searchindex"] = searchIndex
+	}
+	if containerID != "" {
+		container.ID = containerID
+		if known, exist := w.trackingContainers[containerID]; exist {
+			container = known.GetContainer()
+			container.Labels = copyLabels(container.Labels)
+		}
+		return input + ":" + containerID, container
+	}
+	return container.ID, container
+}
+
+// findContainerID returns the id of the tracked container with the (short) id or name.
+// The index is built again on a miss, but at most each containerIndexInterval.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) findContainerID(idOrName string) string {
+	if idOrName == "" {
+		return ""
+	}
+	if res := w.lookupContainerIndex(idOrName); res != "" || time.Since(w.containerIndex.builtAt) < containerIndexInterval {
+		return res
+	}
+	w.buildContainerIndex()
+	return w.lookupContainerIndex(idOrName)
+}
+
+// lookupContainerIndex returns the id of idOrName found at the index if the container is tracked yet
+func (w *Holder) lookupContainerIndex(idOrName string) string {
+	key := "/" + idOrName
+	if len(idOrName) >= shortContainerIDLength {
+		key = idOrName[:shortContainerIDLength]
+	}
+	res, exist := w.containerIndex.ids[key]
+	if !exist || (key != "/"+idOrName && !strings.HasPrefix(res, idOrName)) {
+		if res, exist = w.containerIndex.ids["/"+idOrName]; !exist {
+			return ""
+		}
+	}
+	if _, tracked := w.trackingContainers[res]; !tracked {
+		return ""
+	}
+	return res
+}
+
+// buildContainerIndex indexes the tracked containers by short id and names, the trackers of the network inputs are skipped
+func (w *Holder) buildContainerIndex() {
+	ids := make(map[string]string)
+	for key, v := range w.trackingContainers {
+		container := v.GetContainer()
+		if key != container.ID {
+			continue
+		}
+		if len(container.ID) >= shortContainerIDLength {
+			ids[container.ID[:shortContainerIDLength]] = container.ID
+		}
+		for _, name := range container.Names {
+			ids[name] = container.ID
+		}
+	}
+	w.containerIndex = containerIndex{ids: ids, builtAt: time.Now()}
+}
+
+// pushRecord gives the logline of record to the PushTracker saved at key.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) pushRecord(key string, container types.Container, record netinput.Record, line string) {
+	container.Labels["funk.log.stats"] = "false"
+	pushTracker := w.getPushTracker(key, container)
+	hostname, _ := record.Fields["hostname"].(string)
+	pushTracker.SetSender(tracker.Sender{Host: hostname, IP: record.Sender})
+	pushTracker.Push(record.Time, "", line)
+}
+
+// getPushTracker returns the PushTracker saved at key or creates it for container.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) getPushTracker(key string, container types.Container) *tracker.PushTracker {
+	if existing, ok := w.trackingContainers[key].(*tracker.PushTracker); ok {
+		return existing
+	}
+	w.evictNetworkTrackers(time.Now())
+	res := tracker.NewPushTracker(container, w.Props.TrackerOptions)
+	w.trackingContainers[key] = res
+	return res
+}
+
+func isNetworkTrackerKey(key string) bool {
+	for _, prefix := range networkInputs {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// evictNetworkTrackers removes the trackers of the network inputs without loglines since networkTrackerIdle
+// and the least recently pushed ones, so one more tracker can be added without having more than maxNetworkTrackers.
+// The caller has to hold the lock of trackingContainers
+func (w *Holder) evictNetworkTrackers(now time.Time) {
+	var active []*tracker.PushTracker
+	keys := make(map[*tracker.PushTracker]string)
+	for key, v := range w.trackingContainers {
+		pushTracker, ok := v.(*tracker.PushTracker)
+		if !ok || !isNetworkTrackerKey(key) {
+			continue
+		}
+		if now.Sub(pushTracker.LastPush()) > networkTrackerIdle {
+			delete(w.trackingContainers, key)
+			continue
+		}
+		active = append(active, pushTracker)
+		keys[pushTracker] = key
+	}
+	if len(active) < maxNetworkTrackers {
+		return
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastPush().Before(active[j].LastPush())
+	})
+	for _, one := range active[:len(active)-maxNetworkTrackers+1] {
+		logger.Get().Warnw("Too many senders at the network inputs, remove the least recently used tracker", "key", keys[one])
+		delete(w.trackingContainers, keys[one])
+	}
+}
+
+// forwardLogline returns the field log (written by the docker log driver fluentd) or the whole record as json
+func forwardLogline(fields map[string]interface{}) string {
+	if line, ok := fields["log"].(string); ok {
+		return strings.TrimRight(line, "\r\n")
+	}
+	return jsonLogline(fields)
+}
+
+func jsonLogline(fields map[string]interface{}) string {
+	res, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(res)
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	res := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
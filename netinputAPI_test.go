@@ -0,0 +1,245 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/netinput"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+func TestHolder_pushForwardRecord(t *testing.T) {
+	at := time.Date(2019, time.August, 12, 12, 49, 59, 0, time.UTC)
+	tests := []struct {
+		name      string
+		known     map[string]tracker.TrackElement
+		record    netinput.Record
+		wantKey   string
+		wantID    string
+		wantName  string
+		wantLabel string
+		wantLog   string
+	}{
+		{
+			name:     "docker log driver fluentd of unknown container",
+			record:   netinput.Record{Tag: "docker.web", Time: at, Fields: map[string]interface{}{"container_id": "abc", "container_name": "/web", "log": "hello\n"}},
+			wantKey:  "fluentd:abc",
+			wantID:   "abc",
+			wantName: "/web",
+			wantLog:  `{"message":"2019-08-12T12:49:59Z hello"}`,
+		},
+		{
+			name: "docker log driver fluentd of known container",
+			known: map[string]tracker.TrackElement{
+				"abc": &TrackerMock{Con: types.Container{ID: "abc", Names: []string{"/known"}, Labels: map[string]string{"funk.searchindex": "known"}}},
+			},
+			record:    netinput.Record{Tag: "docker.web", Time: at, Fields: map[string]interface{}{"container_id": "abc", "container_name": "/web", "log": "hello"}},
+			wantKey:   "fluentd:abc",
+			wantID:    "abc",
+			wantName:  "/known",
+			wantLabel: "known",
+			wantLog:   `{"message":"2019-08-12T12:49:59Z hello"}`,
+		},
+		{
+			name:     "record without container uses the tag",
+			record:   netinput.Record{Tag: "app.access", Time: at, Fields: map[string]interface{}{"message": "hello"}},
+			wantKey:  "fluentd:app.access",
+			wantID:   "fluentd:app.access",
+			wantName: "/app.access",
+			wantLog:  `{"message":"hello"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Holder{trackingContainers: make(map[string]tracker.TrackElement)}
+			for k, v := range tt.known {
+				w.trackingContainers[k] = v
+			}
+			w.pushForwardRecord(tt.record)
+			got, ok := w.trackingContainers[tt.wantKey].(*tracker.PushTracker)
+			if !ok {
+				t.Fatalf("no PushTracker at %v", tt.wantKey)
+			}
+			container := got.GetContainer()
+			if container.ID != tt.wantID || container.Names[0] != tt.wantName || container.Labels["funk.searchindex"] != tt.wantLabel || container.Labels["funk.log.stats"] != "false" {
+				t.Errorf("pushForwardRecord() container = %v", container)
+			}
+			if known, exist := tt.known[tt.wantID]; exist && known.GetContainer().Labels["funk.log.stats"] != "" {
+				t.Errorf("pushForwardRecord() changed the labels of the known container")
+			}
+			logs := got.GetLogs()
+			if len(logs) != 1 || string(logs[0]) != tt.wantLog {
+				t.Errorf("pushForwardRecord() logs = %v, want %v", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestHolder_pushSyslogRecord(t *testing.T) {
+	at := time.Date(2020, time.January, 9, 22, 14, 15, 0, time.UTC)
+	tests := []struct {
+		name      string
+		known     map[string]tracker.TrackElement
+		record    netinput.Record
+		wantKey   string
+		wantID    string
+		wantName  string
+		wantIndex string
+	}{
+		{
+			name:      "appliance",
+			record:    netinput.Record{Tag: "kernel", Time: at, Sender: "10.0.0.1", Fields: map[string]interface{}{"hostname": "router", "appname": "kernel", "message": "link down"}},
+			wantKey:   "syslog:10.0.0.1/router/kernel",
+			wantID:    "syslog:10.0.0.1/router/kernel",
+			wantName:  "/kernel",
+			wantIndex: "syslog",
+		},
+		{
+			name: "docker log driver syslog with short container id as tag",
+			known: map[string]tracker.TrackElement{
+				"0123456789abcdef": &TrackerMock{Con: types.Container{ID: "0123456789abcdef", Names: []string{"/web"}, Labels: map[string]string{"funk.searchindex": "web"}}},
+			},
+			record:    netinput.Record{Tag: "0123456789ab", Time: at, Sender: "127.0.0.1", Fields: map[string]interface{}{"hostname": "dockerhost", "appname": "0123456789ab", "message": "hello"}},
+			wantKey:   "syslog:0123456789abcdef",
+			wantID:    "0123456789abcdef",
+			wantName:  "/web",
+			wantIndex: "web",
+		},
+		{
+			name: "docker log driver syslog with container name as tag",
+			known: map[string]tracker.TrackElement{
+				"0123456789abcdef": &TrackerMock{Con: types.Container{ID: "0123456789abcdef", Names: []string{"/web"}}},
+			},
+			record:    netinput.Record{Tag: "web", Time: at, Sender: "127.0.0.1", Fields: map[string]interface{}{"hostname": "dockerhost", "appname": "web", "message": "hello"}},
+			wantKey:   "syslog:0123456789abcdef",
+			wantID:    "0123456789abcdef",
+			wantName:  "/web",
+			wantIndex: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Holder{trackingContainers: make(map[string]tracker.TrackElement)}
+			for k, v := range tt.known {
+				w.trackingContainers[k] = v
+			}
+			w.pushSyslogRecord(tt.record, "syslog")
+			got, ok := w.trackingContainers[tt.wantKey].(*tracker.PushTracker)
+			if !ok {
+				t.Fatalf("no PushTracker at %v", tt.wantKey)
+			}
+			container := got.GetContainer()
+			if container.ID != tt.wantID || container.Names[0] != tt.wantName || container.Labels["funk.searchindex"] != tt.wantIndex {
+				t.Errorf("pushSyslogRecord() container = %v", container)
+			}
+			attributes := getFilledMessageAttributes(w, got)
+			if attributes.Sender != tt.record.Sender || attributes.SenderHost != tt.record.Fields["hostname"] {
+				t.Errorf("pushSyslogRecord() attributes = %v", attributes)
+			}
+			if logs := got.GetLogs(); len(logs) != 1 {
+				t.Errorf("pushSyslogRecord() logs = %v", logs)
+			}
+		})
+	}
+}
+
+func TestHolder_pushGELFRecord(t *testing.T) {
+	at := time.Date(2020, time.January, 9, 22, 14, 15, 0, time.UTC)
+	w := &Holder{trackingContainers: make(map[string]tracker.TrackElement)}
+	w.pushGELFRecord(netinput.Record{Tag: "abc", Time: at, Sender: "10.0.0.2", Fields: map[string]interface{}{
+		"hostname":       "dockerhost",
+		"container_id":   "abc",
+		"container_name": "web",
+		"level":          float64(3),
+		"message":        "hello",
+	}}, "gelf")
+	got, ok := w.trackingContainers["gelf:abc"].(*tracker.PushTracker)
+	if !ok {
+		t.Fatalf("no PushTracker for the container abc")
+	}
+	if container := got.GetContainer(); container.ID != "abc" || container.Names[0] != "/web" || got.SearchIndex() != "gelf" {
+		t.Errorf("pushGELFRecord() container = %v", container)
+	}
+	want := `{"container_id":"abc","container_name":"web","hostname":"dockerhost","level":"error","message":"hello"}`
+	if logs := got.GetLogs(); len(logs) != 1 || string(logs[0]) != want {
+		t.Errorf("pushGELFRecord() logs = %v, want %v", logs, want)
+	}
+}
+
+func Test_bufferRecords(t *testing.T) {
+	mu := sync.Mutex{}
+	pushed := make(chan netinput.Record, 2)
+	handler := bufferRecords(&mu, func(record netinput.Record) {
+		pushed <- record
+	})
+	mu.Lock()
+	handler(netinput.Record{Tag: "first"})
+	handler(netinput.Record{Tag: "second"})
+	if len(pushed) != 0 {
+		t.Errorf("bufferRecords() has pushed without the lock")
+	}
+	mu.Unlock()
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-pushed:
+			if got.Tag != want {
+				t.Errorf("bufferRecords() pushed %v, want %v", got.Tag, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("bufferRecords() has not pushed %v", want)
+		}
+	}
+}
+
+func TestHolder_evictNetworkTrackers(t *testing.T) {
+	w := &Holder{trackingContainers: make(map[string]tracker.TrackElement)}
+	at := time.Date(2020, time.January, 9, 22, 14, 15, 0, time.UTC)
+	w.pushSyslogRecord(netinput.Record{Tag: "old", Time: at, Sender: "10.0.0.1", Fields: map[string]interface{}{"message": "hello"}}, "syslog")
+	w.trackingContainers["plugin"] = tracker.NewPushTracker(types.Container{ID: "plugin", Names: []string{"/plugin"}}, tracker.Options{})
+	w.evictNetworkTrackers(time.Now().Add(networkTrackerIdle + time.Minute))
+	if _, exist := w.trackingContainers["syslog:10.0.0.1//old"]; exist {
+		t.Errorf("evictNetworkTrackers() keeps the idle tracker")
+	}
+	if _, exist := w.trackingContainers["plugin"]; !exist {
+		t.Errorf("evictNetworkTrackers() removed a tracker of no network input")
+	}
+
+	for i := 0; i <= maxNetworkTrackers; i++ {
+		w.pushSyslogRecord(netinput.Record{Tag: strconv.Itoa(i), Time: at, Sender: "10.0.0.1", Fields: map[string]interface{}{"message": "hello"}}, "syslog")
+	}
+	if len(w.trackingContainers) != maxNetworkTrackers+1 {
+		t.Errorf("trackingContainers has %v trackers, want %v network trackers and the plugin", len(w.trackingContainers), maxNetworkTrackers)
+	}
+	if _, exist := w.trackingContainers["syslog:10.0.0.1//0"]; exist {
+		t.Errorf("evictNetworkTrackers() keeps the least recently used tracker")
+	}
+	if _, exist := w.trackingContainers["syslog:10.0.0.1//"+strconv.Itoa(maxNetworkTrackers)]; !exist {
+		t.Errorf("evictNetworkTrackers() has not added the newest tracker")
+	}
+}
+
+func TestHolder_findContainerID(t *testing.T) {
+	w := &Holder{trackingContainers: map[string]tracker.TrackElement{
+		"0123456789abcdef": &TrackerMock{Con: types.Container{ID: "0123456789abcdef", Names: []string{"/web"}}},
+	}}
+	for idOrName, want := range map[string]string{
+		"web":              "0123456789abcdef",
+		"0123456789ab":     "0123456789abcdef",
+		"0123456789abcdef": "0123456789abcdef",
+		"0123456789abcdee": "",
+		"0123":             "",
+		"db":               "",
+	} {
+		if got := w.findContainerID(idOrName); got != want {
+			t.Errorf("findContainerID(%v) = %v, want %v", idOrName, got, want)
+		}
+	}
+	w.trackingContainers["fedcba9876543210"] = &TrackerMock{Con: types.Container{ID: "fedcba9876543210", Names: []string{"/db"}}}
+	w.containerIndex.builtAt = time.Time{}
+	if got := w.findContainerID("db"); got != "fedcba9876543210" {
+		t.Errorf("findContainerID() of a new container = %v, want fedcba9876543210", got)
+	}
+}
@@ -0,0 +1,278 @@
+// Package nodestats collects the stats of the host (load, memory, filesystems, network, uptime) from /proc and statfs
+package nodestats
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// Stats are the stats of the host
+type Stats struct {
+	UptimeSeconds      float64          `json:"uptime_seconds"`
+	Load1              float64          `json:"load1"`
+	Load5              float64          `json:"load5"`
+	Load15             float64          `json:"load15"`
+	CPUCount           int              `json:"cpu_count"`
+	CPUUsagePercent    float64          `json:"cpu_usage_percent"` // CPUUsagePercent is the usage of all cpus since the last collect (100 is one busy cpu)
+	MemoryTotalMb      float64          `json:"memory_total_mb"`
+	MemoryFreeMb       float64          `json:"memory_free_mb"`
+	MemoryAvailableMb  float64          `json:"memory_available_mb"`
+	MemoryUsedMb       float64          `json:"memory_used_mb"` // MemoryUsedMb is the memory without the available one (free and reclaimable cache)
+	MemoryUsagePercent float64          `json:"memory_usage_percent"`
+	SwapTotalMb        float64          `json:"swap_total_mb"`
+	SwapUsedMb         float64          `json:"swap_used_mb"`
+	Filesystems        []Filesystem     `json:"filesystems,omitempty"`
+	NetIOReceiveMb     float64          `json:"net_io_receive_mb"`
+	NetIOTransmitMb    float64          `json:"net_io_transmit_mb"`
+	Networks           tracker.Networks `json:"networks,omitempty"`
+}
+
+// Filesystem is the disk and inode usage of one mount
+type Filesystem struct {
+	Mount              string  `json:"mount"`
+	Device             string  `json:"device"`
+	Type               string  `json:"type"`
+	TotalMb            float64 `json:"total_mb"`
+	UsedMb             float64 `json:"used_mb"`
+	AvailableMb        float64 `json:"available_mb"` // AvailableMb is the free space for not root users
+	UsagePercent       float64 `json:"usage_percent"`
+	Inodes             uint64  `json:"inodes"`
+	InodesUsed         uint64  `json:"inodes_used"`
+	InodesFree         uint64  `json:"inodes_free"`
+	InodesUsagePercent float64 `json:"inodes_usage_percent"`
+}
+
+// Usage is the result of statfs in bytes and inodes
+type Usage struct {
+	Total, Free, Available uint64
+	Inodes, InodesFree     uint64
+}
+
+// ignoredTypes are the filesystems without disk
+var ignoredTypes = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true, "configfs": true,
+	"debugfs": true, "devpts": true, "devtmpfs": true, "efivarfs": true, "fusectl": true, "hugetlbfs": true,
+	"mqueue": true, "nsfs": true, "overlay": true, "proc": true, "pstore": true, "ramfs": true,
+	"rpc_pipefs": true, "securityfs": true, "selinuxfs": true, "squashfs": true, "sysfs": true, "tracefs": true,
+	"tmpfs": true,
+}
+
+// ignoredMounts are the places of the mounts of the containers and the pseudo filesystems
+var ignoredMounts = []string{"/proc", "/sys", "/dev", "/run/docker", "/var/lib/docker", "/var/lib/containerd", "/var/lib/kubelet/pods", "/snap"}
+
+// Collector reads the stats of the host
+type Collector struct {
+	root    string // root is the place of the host filesystem inside the agent
+	proc    string
+	statfs  func(path string) (Usage, error)
+	cpuBusy int64
+	cpuAll  int64
+}
+
+// NewCollector creates a Collector for the host filesystem mounted at hostRoot (empty if the agent sees the host filesystem)
+func NewCollector(hostRoot string) *Collector {
+	return &Collector{
+		root:   filepath.Join("/", hostRoot),
+		proc:   filepath.Join("/", hostRoot, "proc"),
+		statfs: statfs,
+	}
+}
+
+// Collect reads the current stats, missing files are left empty
+func (c *Collector) Collect() Stats {
+	var res Stats
+	c.readUptime(&res)
+	c.readLoad(&res)
+	c.readCPU(&res)
+	c.readMemory(&res)
+	res.Filesystems = c.readFilesystems()
+	res.Networks = c.readNetworks()
+	for _, one := range res.Networks {
+		res.NetIOReceiveMb += float64(one.RxBytes) / 1000000
+		res.NetIOTransmitMb += float64(one.TxBytes) / 1000000
+	}
+	return res
+}
+
+// readFirst returns the content of the first existing file. The files of pid 1 are the ones of the host if the agent runs with pid: host
+func (c *Collector) readFirst(paths ...string) string {
+	for _, one := range paths {
+		if data, err := ioutil.ReadFile(filepath.Join(c.proc, one)); err == nil {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+func parseFloat(value string) float64 {
+	res, _ := strconv.ParseFloat(value, 64)
+	return res
+}
+
+func parseInt(value string) int64 {
+	res, _ := strconv.ParseInt(value, 10, 64)
+	return res
+}
+
+func percent(value, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return value / total * 100
+}
+
+func (c *Collector) readUptime(res *Stats) {
+	if fields := strings.Fields(c.readFirst("uptime")); len(fields) > 0 {
+		res.UptimeSeconds = parseFloat(fields[0])
+	}
+}
+
+func (c *Collector) readLoad(res *Stats) {
+	if fields := strings.Fields(c.readFirst("loadavg")); len(fields) >= 3 {
+		res.Load1 = parseFloat(fields[0])
+		res.Load5 = parseFloat(fields[1])
+		res.Load15 = parseFloat(fields[2])
+	}
+}
+
+// readCPU counts the cpus and takes the usage since the last call of the cpu line of /proc/stat
+func (c *Collector) readCPU(res *Stats) {
+	var busy, all int64
+	for _, line := range strings.Split(c.readFirst("stat"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			res.CPUCount++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			value := parseInt(fields[i])
+			all += value
+			if i != 4 && i != 5 {
+				busy += value
+			}
+		}
+	}
+	if all > c.cpuAll && busy >= c.cpuBusy && c.cpuAll > 0 {
+		res.CPUUsagePercent = percent(float64(busy-c.cpuBusy), float64(all-c.cpuAll)) * float64(res.CPUCount)
+	}
+	c.cpuBusy, c.cpuAll = busy, all
+}
+
+func (c *Collector) readMemory(res *Stats) {
+	values := make(map[string]float64)
+	for _, line := range strings.Split(c.readFirst("meminfo"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			// the values are in kB
+			values[strings.TrimSuffix(fields[0], ":")] = parseFloat(fields[1]) * 1024 / 1000000
+		}
+	}
+	available, exist := values["MemAvailable"]
+	if !exist {
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	res.MemoryTotalMb = values["MemTotal"]
+	res.MemoryFreeMb = values["MemFree"]
+	res.MemoryAvailableMb = available
+	res.MemoryUsedMb = res.MemoryTotalMb - available
+	res.MemoryUsagePercent = percent(res.MemoryUsedMb, res.MemoryTotalMb)
+	res.SwapTotalMb = values["SwapTotal"]
+	res.SwapUsedMb = values["SwapTotal"] - values["SwapFree"]
+}
+
+func ignoredMount(mount, fsType string) bool {
+	if ignoredTypes[fsType] {
+		return true
+	}
+	for _, one := range ignoredMounts {
+		if mount == one || strings.HasPrefix(mount, one+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeMount replaces the octal escapes of /proc/mounts like \040 for space
+func unescapeMount(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var res strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if code, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				res.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		res.WriteByte(value[i])
+	}
+	return res.String()
+}
+
+// readFilesystems returns the usage of the mounts with a disk sorted by mount
+func (c *Collector) readFilesystems() []Filesystem {
+	var res []Filesystem
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(c.readFirst("1/mounts", "mounts"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		device, mount, fsType := unescapeMount(fields[0]), unescapeMount(fields[1]), fields[2]
+		if seen[mount] || ignoredMount(mount, fsType) {
+			continue
+		}
+		seen[mount] = true
+		usage, err := c.statfs(filepath.Join(c.root, mount))
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		used := usage.Total - usage.Free
+		one := Filesystem{
+			Mount:       mount,
+			Device:      device,
+			Type:        fsType,
+			TotalMb:     float64(usage.Total) / 1000000,
+			UsedMb:      float64(used) / 1000000,
+			AvailableMb: float64(usage.Available) / 1000000,
+			// like df the reserved blocks of root are not part of the usage
+			UsagePercent: percent(float64(used), float64(used+usage.Available)),
+			Inodes:       usage.Inodes,
+			InodesFree:   usage.InodesFree,
+		}
+		if usage.Inodes >= usage.InodesFree {
+			one.InodesUsed = usage.Inodes - usage.InodesFree
+			one.InodesUsagePercent = percent(float64(one.InodesUsed), float64(usage.Inodes))
+		}
+		res = append(res, one)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Mount < res[j].Mount
+	})
+	return res
+}
+
+// readNetworks reads the counters of the network interfaces of the host without loopback
+func (c *Collector) readNetworks() tracker.Networks {
+	return tracker.ParseNetDev(c.readFirst("1/net/dev", "net/dev"))
+}
+
+// Run collects the stats at each tick and gives them to send
+func (c *Collector) Run(ticker *time.Ticker, send func(Stats)) {
+	c.Collect()
+	for range ticker.C {
+		send(c.Collect())
+	}
+}
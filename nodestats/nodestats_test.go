@@ -0,0 +1,116 @@
+package nodestats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+func fakeRoot(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "funk_node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+const mounts = `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+tmpfs /run tmpfs rw,nosuid,nodev 0 0
+/dev/sdb1 /mnt/my\040data xfs rw,relatime 0 0
+/dev/sda1 /var/lib/docker/overlay2 ext4 rw,relatime 0 0
+overlay /var/lib/docker/overlay2/abc/merged overlay rw 0 0
+/dev/sdc1 /broken ext4 rw 0 0
+`
+
+func TestCollector_Collect(t *testing.T) {
+	root := fakeRoot(t, map[string]string{
+		"/proc/uptime":   "3600.50 7000.00\n",
+		"/proc/loadavg":  "0.50 0.40 0.30 1/100 1234\n",
+		"/proc/stat":     "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 50 0 50 350 50 0 0 0 0 0\ncpu1 50 0 50 350 50 0 0 0 0 0\nintr 1\n",
+		"/proc/meminfo":  "MemTotal:        1000000 kB\nMemFree:          200000 kB\nMemAvailable:     500000 kB\nSwapTotal:        100000 kB\nSwapFree:          50000 kB\n",
+		"/proc/1/mounts": mounts,
+		"/proc/1/net/dev": `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0: 2000000      20    1    2    0     0          0         0  1000000      10    3    4    0     0       0          0
+`,
+	})
+	defer os.RemoveAll(root)
+
+	c := NewCollector(root)
+	var statfsPaths []string
+	c.statfs = func(path string) (Usage, error) {
+		statfsPaths = append(statfsPaths, path)
+		switch path {
+		case filepath.Join(root, "/"):
+			return Usage{Total: 100000000, Free: 50000000, Available: 50000000, Inodes: 1000, InodesFree: 750}, nil
+		case filepath.Join(root, "/mnt/my data"):
+			return Usage{Total: 2000000, Free: 2000000, Available: 2000000}, nil
+		}
+		return Usage{}, errors.New("not mounted")
+	}
+	got := c.Collect()
+	want := Stats{
+		UptimeSeconds:      3600.5,
+		Load1:              0.5,
+		Load5:              0.4,
+		Load15:             0.3,
+		CPUCount:           2,
+		MemoryTotalMb:      1024,
+		MemoryFreeMb:       204.8,
+		MemoryAvailableMb:  512,
+		MemoryUsedMb:       512,
+		MemoryUsagePercent: 50,
+		SwapTotalMb:        102.4,
+		SwapUsedMb:         51.2,
+		Filesystems: []Filesystem{
+			{Mount: "/", Device: "/dev/sda1", Type: "ext4", TotalMb: 100, UsedMb: 50, AvailableMb: 50, UsagePercent: 50, Inodes: 1000, InodesUsed: 250, InodesFree: 750, InodesUsagePercent: 25},
+			{Mount: "/mnt/my data", Device: "/dev/sdb1", Type: "xfs", TotalMb: 2, AvailableMb: 2},
+		},
+		NetIOReceiveMb:  2,
+		NetIOTransmitMb: 1,
+		Networks: tracker.Networks{
+			"eth0": {RxBytes: 2000000, RxPackets: 20, RxErrors: 1, RxDropped: 2, TxBytes: 1000000, TxPackets: 10, TxErrors: 3, TxDropped: 4},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %+v, want %+v", got, want)
+	}
+	if len(statfsPaths) != 3 {
+		t.Errorf("statfs is called for %v, want /, /mnt/my data and /broken", statfsPaths)
+	}
+
+	ioutil.WriteFile(filepath.Join(root, "/proc/stat"), []byte("cpu  150 0 150 800 100 0 0 0 0 0\ncpu0 0\ncpu1 0\n"), 0644)
+	if got := c.Collect(); got.CPUUsagePercent != 100 {
+		t.Errorf("Collect() CPUUsagePercent = %v, want 100 (half of 2 cpus)", got.CPUUsagePercent)
+	}
+}
+
+func TestCollector_Collect_missingFiles(t *testing.T) {
+	root := fakeRoot(t, map[string]string{
+		"/proc/meminfo": "MemTotal:        1000000 kB\nMemFree:          250000 kB\nBuffers:          125000 kB\nCached:           125000 kB\n",
+	})
+	defer os.RemoveAll(root)
+	got := NewCollector(root).Collect()
+	want := Stats{MemoryTotalMb: 1024, MemoryFreeMb: 256, MemoryAvailableMb: 512, MemoryUsedMb: 512, MemoryUsagePercent: 50}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %+v, want %+v", got, want)
+	}
+}
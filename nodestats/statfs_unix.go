@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package nodestats
+
+import "syscall"
+
+func statfs(path string) (Usage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Usage{}, err
+	}
+	size := uint64(stat.Bsize)
+	return Usage{
+		Total:      uint64(stat.Blocks) * size,
+		Free:       uint64(stat.Bfree) * size,
+		Available:  uint64(stat.Bavail) * size,
+		Inodes:     uint64(stat.Files),
+		InodesFree: uint64(stat.Ffree),
+	}, nil
+}
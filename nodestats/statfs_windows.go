@@ -0,0 +1,8 @@
+package nodestats
+
+import "errors"
+
+// statfs is not supported at windows, no filesystems are send
+func statfs(path string) (Usage, error) {
+	return Usage{}, errors.New("statfs is not supported at windows")
+}
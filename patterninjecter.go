@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fasibio/funk_agent/logger"
+	"github.com/fasibio/funk_agent/logpattern"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// PatternIDField is the field where the id of the template of the message will be written to
+const PatternIDField = "pattern_id"
+
+// DefaultPatternMessageFields are the fields looked up for the message, the first found is taken
+var DefaultPatternMessageFields = []string{"message", "msg"}
+
+// PatternInjecter groups the messages of each container into templates and writes the pattern_id to the loglines
+type PatternInjecter struct {
+	enabled bool // enabled is the default of label funk.log.patterns
+	miners  map[string]*logpattern.Miner
+}
+
+// NewPatternInjecter creates a PatternInjecter, enabled is the default for containers without label funk.log.patterns
+func NewPatternInjecter(enabled bool) *PatternInjecter {
+	return &PatternInjecter{enabled: enabled, miners: make(map[string]*logpattern.Miner)}
+}
+
+// miner returns the miner of the container, nil if the patterns are disabled
+func (p *PatternInjecter) miner(v tracker.TrackElement) *logpattern.Miner {
+	if p == nil {
+		return nil
+	}
+	container := v.GetContainer()
+	label := container.Labels["funk.log.patterns"]
+	if label == "false" || (label != "true" && !p.enabled) {
+		delete(p.miners, container.ID)
+		return nil
+	}
+	res, exist := p.miners[container.ID]
+	if !exist {
+		res = logpattern.NewMiner()
+		p.miners[container.ID] = res
+	}
+	return res
+}
+
+// Prune removes the miners of the containers which are not tracked anymore
+func (p *PatternInjecter) Prune(tracked map[string]bool) {
+	if p == nil {
+		return
+	}
+	for id := range p.miners {
+		if !tracked[id] {
+			delete(p.miners, id)
+		}
+	}
+}
+
+// injectPattern adds the message of the logline to the miner and writes the id of its template to pattern_id
+func injectPattern(miner *logpattern.Miner, value string, now time.Time) (string, error) {
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil || values == nil {
+		return value, errors.New("Logline is not a json object")
+	}
+	for _, field := range DefaultPatternMessageFields {
+		message, ok := values[field].(string)
+		if !ok || message == "" {
+			continue
+		}
+		values[PatternIDField] = miner.Add(message, now).ID
+		res, err := json.Marshal(values)
+		if err != nil {
+			return value, err
+		}
+		return string(res), nil
+	}
+	return value, errors.New("Logline has no message")
+}
+
+// getPatternInfo returns the stats of the templates of the container seen since the last stats
+func (w *Holder) getPatternInfo(v tracker.TrackElement) *Message {
+	miner := w.PatternInjecter.miner(v)
+	if miner == nil {
+		return nil
+	}
+	stoutlog := getLoggerWithContainerInformation(logger.Get(), v.GetContainer())
+	var data []string
+	for _, stats := range miner.Take() {
+		if stats.New {
+			stoutlog.Debugw("New log pattern", "pattern_id", stats.PatternID, "template", stats.Template)
+		}
+		b, err := json.Marshal(stats)
+		if err != nil {
+			stoutlog.Warnw("Error by Marshal pattern stats:"+err.Error(), "stats", stats)
+			continue
+		}
+		data = append(data, string(b))
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return &Message{
+		Time:          time.Now(),
+		Type:          MessageTypeStats,
+		SubType:       MessageSubTypePatterns,
+		Data:          data,
+		Attributes:    getFilledMessageAttributes(w, v),
+		SearchIndex:   v.SearchIndex() + "_patterns",
+		StaticContent: getStaticContent(v),
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logpattern"
+	"github.com/gorilla/websocket"
+)
+
+func Test_injectPattern(t *testing.T) {
+	miner := logpattern.NewMiner()
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "message", value: `{"message": "user 1 logged in", "level": "info"}`},
+		{name: "msg", value: `{"msg": "user 2 logged in", "id": 12345678901234567890}`},
+		{name: "no message", value: `{"level": "info"}`, wantErr: true},
+		{name: "no json", value: `user 3 logged in`, wantErr: true},
+	}
+	var ids []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := injectPattern(miner, tt.value, time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("injectPattern() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got != tt.value {
+					t.Errorf("injectPattern() = %v, want the unchanged logline", got)
+				}
+				return
+			}
+			var values map[string]interface{}
+			if err := json.Unmarshal([]byte(got), &values); err != nil {
+				t.Fatal(err)
+			}
+			id, _ := values[PatternIDField].(string)
+			if id == "" {
+				t.Errorf("injectPattern() = %v, want a %v", got, PatternIDField)
+			}
+			ids = append(ids, id)
+		})
+	}
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("injectPattern() ids = %v, want the same id for the same template", ids)
+	}
+	if got, _ := injectPattern(miner, `{"message": "x", "id": 12345678901234567890}`, time.Now()); !json.Valid([]byte(got)) || !strings.Contains(got, "12345678901234567890") {
+		t.Errorf("injectPattern() = %v, want big numbers unchanged", got)
+	}
+}
+
+func TestHolder_getPatternInfo(t *testing.T) {
+	var got []Message
+	w := &Holder{
+		Props:           Props{LogStats: StatsLogNo},
+		itSelfNamedHost: "test_unit",
+		PatternInjecter: NewPatternInjecter(false),
+		writeToServer: func(con *websocket.Conn, msg []Message) error {
+			got = msg
+			return nil
+		},
+	}
+	v := &TrackerMock{
+		Log: `{"message": "job 42 done"}`,
+		Con: types.Container{ID: "id", Names: []string{"mockContainer"}, Labels: map[string]string{"funk.log.patterns": "true"}},
+	}
+	w.SaveTrackingInfo(v)
+	if len(got) != 1 || len(got[0].Data) == 0 {
+		t.Fatalf("SaveTrackingInfo() = %+v, want the logline", got)
+	}
+	var line map[string]interface{}
+	json.Unmarshal([]byte(got[0].Data[len(got[0].Data)-1]), &line)
+	if line[PatternIDField] == nil {
+		t.Errorf("SaveTrackingInfo() = %v, want a %v", got[0].Data, PatternIDField)
+	}
+
+	w.SaveStatsInfo(v)
+	if len(got) != 1 || got[0].SubType != MessageSubTypePatterns || got[0].SearchIndex != "MockIndex_patterns" || len(got[0].Data) != 1 {
+		t.Fatalf("SaveStatsInfo() = %+v, want one patterns message", got)
+	}
+	var stats logpattern.Stats
+	if err := json.Unmarshal([]byte(got[0].Data[0]), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.PatternID != line[PatternIDField] || stats.Template != "job <*> done" || stats.Count != 1 || !stats.New {
+		t.Errorf("SaveStatsInfo() stats = %+v, want the new template of the logline", stats)
+	}
+
+	v.Con.Labels["funk.log.patterns"] = "false"
+	got = nil
+	w.SaveStatsInfo(v)
+	if got != nil {
+		t.Errorf("SaveStatsInfo() with funk.log.patterns=false = %+v, want nothing", got)
+	}
+}
+
+func TestPatternInjecter_Prune(t *testing.T) {
+	p := NewPatternInjecter(true)
+	for _, id := range []string{"kept", "removed"} {
+		p.miner(&TrackerMock{Con: types.Container{ID: id, Names: []string{"/" + id}}})
+	}
+	p.Prune(map[string]bool{"kept": true})
+	if _, exist := p.miners["removed"]; exist || len(p.miners) != 1 {
+		t.Errorf("Prune() keeps the miners %v", p.miners)
+	}
+	var none *PatternInjecter
+	none.Prune(nil)
+}
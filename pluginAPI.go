@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logplugin"
+	"github.com/fasibio/funk_agent/tracker"
+)
+
+// pluginHandler gives the logs docker sends to the log driver plugin to the trackers
+type pluginHandler struct {
+	holder    *Holder
+	mu        *sync.Mutex
+	sandboxes map[string]types.Container // sandboxes are the pause containers with the pod annotations at KubernetesMode
+}
+
+// StartPluginDriver serves the docker log driver plugin api at socket and keeps historySize loglines per container for docker logs.
+// Will stock the process forever start it in own go routine
+func (w *Holder) StartPluginDriver(socket string, historySize int, mu *sync.Mutex) error {
+	driver := logplugin.NewDriver(&pluginHandler{holder: w, mu: mu, sandboxes: make(map[string]types.Container)}, historySize)
+	return driver.ListenAndServe(socket)
+}
+
+// StartLogging creates the container and its tracker before the first logline is read, so no logline is missed.
+// The sandboxes of KubernetesMode are only kept for their annotations
+func (p *pluginHandler) StartLogging(info logplugin.Info) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	container := pluginContainer(info, p.holder.Props.KubernetesMode, p.sandboxes)
+	if p.holder.Props.KubernetesMode && isKubernetesSandbox(container) {
+		p.sandboxes[info.ContainerID] = container
+		return
+	}
+	if existing, ok := p.holder.trackingContainers[info.ContainerID].(*tracker.PushTracker); ok {
+		existing.SetContainer(container)
+		return
+	}
+	p.holder.trackingContainers[info.ContainerID] = tracker.NewPushTracker(container, p.holder.Props.TrackerOptions)
+}
+
+// Log gives the logline to the tracker created by StartLogging
+func (p *pluginHandler) Log(info logplugin.Info, source string, at time.Time, line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if res, ok := p.holder.trackingContainers[info.ContainerID].(*tracker.PushTracker); ok {
+		res.Push(at, source, line)
+	}
+}
+
+// StopLogging sends the last loglines of the container and removes its tracker
+func (p *pluginHandler) StopLogging(info logplugin.Info) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sandboxes, info.ContainerID)
+	if res, ok := p.holder.trackingContainers[info.ContainerID].(*tracker.PushTracker); ok {
+		res.Flush()
+		p.holder.SaveTrackingInfo(res)
+		delete(p.holder.trackingContainers, info.ContainerID)
+	}
+}
+
+// pluginContainer creates the container of the information docker gives to the log driver plugin.
+// There is no docker api at plugin mode so no stats are send
+func pluginContainer(info logplugin.Info, kubernetesMode bool, sandboxes map[string]types.Container) types.Container {
+	labels := copyLabels(info.ContainerLabels)
+	labels["funk.log.stats"] = "false"
+	res := types.Container{
+		ID:      info.ContainerID,
+		Names:   []string{"/" + strings.TrimPrefix(info.ContainerName, "/")},
+		Image:   info.ContainerImageName,
+		ImageID: info.ContainerImageID,
+		Command: strings.TrimSpace(info.ContainerEntrypoint + " " + strings.Join(info.ContainerArgs, " ")),
+		Created: info.ContainerCreated.Unix(),
+		Labels:  labels,
+		State:   "running",
+	}
+	if kubernetesMode {
+		res = withKubernetesAnnotations(res, sandboxes)
+	}
+	return res
+}
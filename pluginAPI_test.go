@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logplugin"
+	"github.com/fasibio/funk_agent/tracker"
+	"github.com/gorilla/websocket"
+)
+
+func Test_pluginHandler(t *testing.T) {
+	var send []Message
+	w := &Holder{
+		trackingContainers: make(map[string]tracker.TrackElement),
+		writeToServer: func(con *websocket.Conn, msg []Message) error {
+			send = append(send, msg...)
+			return nil
+		},
+	}
+	handler := &pluginHandler{holder: w, mu: &sync.Mutex{}, sandboxes: make(map[string]types.Container)}
+	info := logplugin.Info{
+		ContainerID:        "abc",
+		ContainerName:      "web",
+		ContainerImageName: "nginx:1.17",
+		ContainerImageID:   "sha256:123",
+		ContainerLabels:    map[string]string{"funk.searchindex": "web"},
+	}
+	handler.StartLogging(info)
+	got, ok := w.trackingContainers["abc"].(*tracker.PushTracker)
+	if !ok {
+		t.Fatalf("StartLogging() has not created a PushTracker")
+	}
+	handler.Log(info, "stdout", time.Date(2019, time.August, 12, 12, 49, 59, 0, time.UTC), `{"message":"hello","level":"info"}`)
+	container := got.GetContainer()
+	if container.Names[0] != "/web" || container.Image != "nginx:1.17" || container.Labels["funk.log.stats"] != "false" || got.SearchIndex() != "web" {
+		t.Errorf("pluginHandler container = %v", container)
+	}
+	if info.ContainerLabels["funk.log.stats"] != "" {
+		t.Errorf("pluginHandler changed the labels of the info")
+	}
+	handler.StopLogging(info)
+	if _, exist := w.trackingContainers["abc"]; exist {
+		t.Errorf("StopLogging() has not removed the tracker")
+	}
+	if len(send) != 1 || len(send[0].Data) != 1 || send[0].Data[0] != `{"message":"hello","level":"info"}` {
+		t.Errorf("StopLogging() has send %v, want the last logline", send)
+	}
+	handler.Log(info, "stdout", time.Now(), "after stop")
+	if len(w.trackingContainers) != 0 {
+		t.Errorf("Log() after StopLogging() has created a tracker")
+	}
+}
+
+func Test_pluginHandler_KubernetesSandbox(t *testing.T) {
+	w := &Holder{trackingContainers: make(map[string]tracker.TrackElement), Props: Props{KubernetesMode: true}}
+	handler := &pluginHandler{holder: w, mu: &sync.Mutex{}, sandboxes: make(map[string]types.Container)}
+	handler.StartLogging(logplugin.Info{
+		ContainerID:   "pause",
+		ContainerName: "k8s_POD_web",
+		ContainerLabels: map[string]string{
+			"io.kubernetes.docker.type":   "podsandbox",
+			"annotation.funk.searchindex": "web",
+			"annotation.app.funk.log":     "true",
+		},
+	})
+	if len(w.trackingContainers) != 0 {
+		t.Errorf("StartLogging() tracks the sandbox")
+	}
+	handler.StartLogging(logplugin.Info{
+		ContainerID:   "app",
+		ContainerName: "k8s_app_web",
+		ContainerLabels: map[string]string{
+			"io.kubernetes.docker.type":    "container",
+			"io.kubernetes.container.name": "app",
+			"io.kubernetes.sandbox.id":     "pause",
+		},
+	})
+	got, ok := w.trackingContainers["app"].(*tracker.PushTracker)
+	if !ok {
+		t.Fatalf("StartLogging() has not created a PushTracker")
+	}
+	if labels := got.GetContainer().Labels; got.SearchIndex() != "web" || labels["funk.log"] != "true" {
+		t.Errorf("pluginHandler container labels = %v, want the annotations of the sandbox", labels)
+	}
+}
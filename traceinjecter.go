@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fasibio/funk_agent/jsonpath"
+)
+
+const (
+	// TraceIDField is the field where the found trace id will be written to
+	TraceIDField = "trace.id"
+	// SpanIDField is the field where the found span id will be written to
+	SpanIDField = "span.id"
+)
+
+// DefaultTraceIDFields are the fields looked up for a trace id
+var DefaultTraceIDFields = []string{"trace_id", "traceId", "traceID", "TraceId", "dd.trace_id", "otelTraceID", "x-b3-traceid", "X-B3-TraceId"}
+
+// DefaultSpanIDFields are the fields looked up for a span id
+var DefaultSpanIDFields = []string{"span_id", "spanId", "spanID", "SpanId", "dd.span_id", "otelSpanID", "x-b3-spanid", "X-B3-SpanId"}
+
+// DefaultTraceparentFields are the fields looked up for a W3C traceparent or B3 single header
+var DefaultTraceparentFields = []string{"traceparent", "b3"}
+
+var (
+	traceparentPattern = regexp.MustCompile(`\b[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}\b`)
+	b3Pattern          = regexp.MustCompile(`^([0-9a-fA-F]{16}|[0-9a-fA-F]{32})-([0-9a-fA-F]{16})(?:-.*)?$`)
+	traceTextPattern   = regexp.MustCompile(`(?i)\b(?:trace[._-]?id|dd\.trace_id)\s*[=:]\s*"?([0-9a-f]{8,32})\b`)
+	spanTextPattern    = regexp.MustCompile(`(?i)\b(?:span[._-]?id|dd\.span_id)\s*[=:]\s*"?([0-9a-f]{8,16})\b`)
+)
+
+// TraceExtractor finds trace and span ids inside a logline and writes them to trace.id and span.id
+type TraceExtractor struct {
+	TraceIDFields     []string
+	SpanIDFields      []string
+	TraceparentFields []string
+}
+
+// NewTraceExtractor creates a TraceExtractor with the default fields and the given aliases
+func NewTraceExtractor(traceIDAliases, spanIDAliases []string) *TraceExtractor {
+	return &TraceExtractor{
+		TraceIDFields:     append(append([]string{}, traceIDAliases...), DefaultTraceIDFields...),
+		SpanIDFields:      append(append([]string{}, spanIDAliases...), DefaultSpanIDFields...),
+		TraceparentFields: DefaultTraceparentFields,
+	}
+}
+
+func normaliseID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.ToLower(strings.TrimSpace(v))
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+func firstFilled(values map[string]interface{}, fields []string) string {
+	for _, one := range fields {
+		if value, found := jsonpath.Get(values, one); found {
+			if id := normaliseID(value); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// parseTraceHeader parse a W3C traceparent (00-traceid-spanid-flags) or a B3 single header (traceid-spanid-sampled)
+func parseTraceHeader(value string) (string, string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if sub := traceparentPattern.FindStringSubmatch(value); sub != nil {
+		return sub[1], sub[2]
+	}
+	if sub := b3Pattern.FindStringSubmatch(value); sub != nil {
+		return sub[1], sub[2]
+	}
+	return "", ""
+}
+
+// find returns the trace and span id of a logline
+func (e *TraceExtractor) find(values map[string]interface{}) (string, string) {
+	traceID := firstFilled(values, e.TraceIDFields)
+	spanID := firstFilled(values, e.SpanIDFields)
+	if traceID == "" || spanID == "" {
+		for _, one := range e.TraceparentFields {
+			header, found := jsonpath.Get(values, one)
+			if !found {
+				continue
+			}
+			headerValue, ok := header.(string)
+			if !ok {
+				continue
+			}
+			if headerTrace, headerSpan := parseTraceHeader(headerValue); headerTrace != "" {
+				traceID = getFilledValue(traceID, headerTrace)
+				spanID = getFilledValue(spanID, headerSpan)
+				break
+			}
+		}
+	}
+	if traceID == "" {
+		if message, ok := values["message"].(string); ok {
+			if textTrace, textSpan := parseTraceHeader(message); textTrace != "" {
+				return textTrace, getFilledValue(spanID, textSpan)
+			}
+			if sub := traceTextPattern.FindStringSubmatch(message); sub != nil {
+				traceID = strings.ToLower(sub[1])
+			}
+			if sub := spanTextPattern.FindStringSubmatch(message); sub != nil && spanID == "" {
+				spanID = strings.ToLower(sub[1])
+			}
+		}
+	}
+	return traceID, spanID
+}
+
+// Inject writes the found trace and span id to trace.id and span.id
+// Existing trace.id and span.id fields, dotted or nested like {"trace":{"id":...}}, are not overwritten
+func (e *TraceExtractor) Inject(value string) (string, error) {
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil || values == nil {
+		return value, errors.New("Logline is not a json object")
+	}
+	_, hasTrace := jsonpath.Get(values, TraceIDField)
+	_, hasSpan := jsonpath.Get(values, SpanIDField)
+	if hasTrace && hasSpan {
+		return value, nil
+	}
+	traceID, spanID := e.find(values)
+	if traceID == "" {
+		return value, fmt.Errorf("No trace id found")
+	}
+	if !hasTrace {
+		values[TraceIDField] = traceID
+	}
+	if !hasSpan && spanID != "" {
+		values[SpanIDField] = spanID
+	}
+	res, err := json.Marshal(values)
+	if err != nil {
+		return value, err
+	}
+	return string(res), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTraceExtractor_Inject(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "common field names",
+			value: `{"traceId":"4BF92F3577B34DA6A3CE929D0E0E4736","spanId":"00f067aa0ba902b7"}`,
+			want:  `{"span.id":"00f067aa0ba902b7","spanId":"00f067aa0ba902b7","trace.id":"4bf92f3577b34da6a3ce929d0e0e4736","traceId":"4BF92F3577B34DA6A3CE929D0E0E4736"}`,
+		},
+		{
+			name:  "datadog numeric ids keep precision",
+			value: `{"dd":{"trace_id":1234567890123456789,"span_id":987654321987654321}}`,
+			want:  `{"dd":{"span_id":987654321987654321,"trace_id":1234567890123456789},"span.id":"987654321987654321","trace.id":"1234567890123456789"}`,
+		},
+		{
+			name:  "w3c traceparent",
+			value: `{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`,
+			want:  `{"span.id":"00f067aa0ba902b7","trace.id":"4bf92f3577b34da6a3ce929d0e0e4736","traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`,
+		},
+		{
+			name:  "b3 single header",
+			value: `{"b3":"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"}`,
+			want:  `{"b3":"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1","span.id":"e457b5a2e4d86bd1","trace.id":"80f198ee56343ba864fe8b2a57d3eff7"}`,
+		},
+		{
+			name:  "plain text message with key value",
+			value: `{"message":"request done trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7"}`,
+			want:  `{"message":"request done trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7","span.id":"00f067aa0ba902b7","trace.id":"4bf92f3577b34da6a3ce929d0e0e4736"}`,
+		},
+		{
+			name:  "plain text message with traceparent",
+			value: `{"message":"incoming 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`,
+			want:  `{"message":"incoming 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01","span.id":"00f067aa0ba902b7","trace.id":"4bf92f3577b34da6a3ce929d0e0e4736"}`,
+		},
+		{
+			name:  "alias field",
+			value: `{"ctx":{"tid":"abc123abc123abc1"}}`,
+			want:  `{"ctx":{"tid":"abc123abc123abc1"},"trace.id":"abc123abc123abc1"}`,
+		},
+		{
+			name:  "existing trace.id and span.id are not overwritten",
+			value: `{"trace.id":"a","span.id":"b","traceId":"c"}`,
+			want:  `{"trace.id":"a","span.id":"b","traceId":"c"}`,
+		},
+		{
+			name:  "existing nested trace id and span id are not overwritten",
+			value: `{"trace":{"id":"a"},"span":{"id":"b"},"traceId":"c"}`,
+			want:  `{"trace":{"id":"a"},"span":{"id":"b"},"traceId":"c"}`,
+		},
+		{
+			name:  "existing nested trace id only the span id is added",
+			value: `{"trace":{"id":"a"},"traceId":"c","spanId":"d"}`,
+			want:  `{"span.id":"d","spanId":"d","trace":{"id":"a"},"traceId":"c"}`,
+		},
+		{
+			name:    "no trace id",
+			value:   `{"message":"nothing"}`,
+			want:    `{"message":"nothing"}`,
+			wantErr: true,
+		},
+		{
+			name:    "no json",
+			value:   `plain`,
+			want:    `plain`,
+			wantErr: true,
+		},
+	}
+	e := NewTraceExtractor([]string{".ctx.tid"}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.Inject(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Inject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Inject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package tracker
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsSource is the way the stats of the containers are read
+type StatsSource string
+
+// IsValidate checks if the value is one of the StatsSource constants
+func (s StatsSource) IsValidate() bool {
+	switch s {
+	case StatsSourceDocker, StatsSourceCgroup:
+		return true
+	}
+	return false
+}
+
+const (
+	// StatsSourceDocker streams the stats of each container from the docker api
+	StatsSourceDocker StatsSource = "docker"
+	// StatsSourceCgroup reads the stats from the cgroup and proc filesystem of the host
+	StatsSourceCgroup StatsSource = "cgroup"
+
+	cgroupStatsInterval = time.Second
+	// userHz is the unit of the cpu times of /proc/stat and cpuacct.stat
+	userHz = 100
+)
+
+// cgroupStats reads the stats of one container from /sys/fs/cgroup (v1 and v2) and /proc like the docker daemon does
+type cgroupStats struct {
+	root     string // root is the mount of the cgroup filesystem
+	proc     string // proc is the mount of the proc filesystem of the host
+	id       string
+	pid      int // pid is used to find the cgroup, the network counters are read of the pid given to read
+	v2       bool
+	path     string // path is the cgroup of the container relative to the root (of each controller at v1)
+	previous Stats
+}
+
+// newCgroupStats finds the cgroup of the container. The pid is used to find the cgroup and the network counters, 0 if it is unknown
+func newCgroupStats(hostRoot, containerID string, pid int) (*cgroupStats, error) {
+	res := &cgroupStats{
+		root: filepath.Join("/", hostRoot, "sys", "fs", "cgroup"),
+		proc: filepath.Join("/", hostRoot, "proc"),
+		id:   containerID,
+		pid:  pid,
+	}
+	if _, err := os.Stat(filepath.Join(res.root, "cgroup.controllers")); err == nil {
+		res.v2 = true
+	}
+	path, err := res.findPath()
+	if err != nil {
+		return nil, err
+	}
+	res.path = path
+	return res, nil
+}
+
+// dir returns the directory of the container for a controller (cpu, memory, ...), all controllers share one directory at v2
+func (c *cgroupStats) dir(controller string) string {
+	if c.v2 {
+		return filepath.Join(c.root, c.path)
+	}
+	return filepath.Join(c.root, controller, c.path)
+}
+
+// findPath looks at /proc/<pid>/cgroup, the layouts of the cgroupfs and systemd driver and at last searches the tree for the container id
+func (c *cgroupStats) findPath() (string, error) {
+	base := c.root
+	if !c.v2 {
+		base = filepath.Join(c.root, "memory")
+	}
+	var candidates []string
+	if c.pid > 0 {
+		// the path is relative to the cgroup namespace of the agent, it starts with .. if the agent has an own namespace
+		if path := c.procCgroupPath(); path != "" && !strings.Contains(path, "..") {
+			candidates = append(candidates, path)
+		}
+	}
+	candidates = append(candidates, filepath.Join("system.slice", "docker-"+c.id+".scope"), filepath.Join("docker", c.id))
+	for _, one := range candidates {
+		if info, err := os.Stat(filepath.Join(base, one)); err == nil && info.IsDir() {
+			return one, nil
+		}
+	}
+	var found string
+	errFound := errors.New("found")
+	filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && strings.Contains(info.Name(), c.id) {
+			found, _ = filepath.Rel(base, path)
+			return errFound
+		}
+		return nil
+	})
+	if found == "" {
+		return "", errors.New("no cgroup found for container " + c.id)
+	}
+	return found, nil
+}
+
+// procCgroupPath returns the cgroup of the memory controller (v1) or the unified cgroup (v2) of the pid
+func (c *cgroupStats) procCgroupPath() string {
+	data, err := ioutil.ReadFile(filepath.Join(c.proc, strconv.Itoa(c.pid), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if c.v2 && parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if !c.v2 && controller == "memory" {
+				return parts[2]
+			}
+		}
+	}
+	return ""
+}
+
+// read returns the stats of the container, an error means the cgroup is removed (container has stopped).
+// The network counters are read of the network namespace of pid, it changes with each restart of the container
+func (c *cgroupStats) read(now time.Time, pid int) (Stats, error) {
+	res := Stats{
+		ID:          c.id,
+		Read:        now.Format(time.RFC3339Nano),
+		Preread:     c.previous.Read,
+		PrecpuStats: c.previous.CPUStats,
+		Networks:    readNetDev(filepath.Join(c.proc, strconv.Itoa(pid), "net", "dev"), pid),
+	}
+	var err error
+	if c.v2 {
+		err = c.readV2(&res)
+	} else {
+		err = c.readV1(&res)
+	}
+	if err != nil {
+		return Stats{}, err
+	}
+	res.CPUStats.SystemCPUUsage, res.CPUStats.OnlineCpus = readProcStat(filepath.Join(c.proc, "stat"))
+	if total := readMemTotal(filepath.Join(c.proc, "meminfo")); total > 0 && (res.MemoryStats.Limit <= 0 || res.MemoryStats.Limit > total) {
+		res.MemoryStats.Limit = total
+	}
+	c.previous = res
+	return res, nil
+}
+
+func (c *cgroupStats) readV2(res *Stats) error {
+	dir := c.dir("")
+	cpu, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	res.CPUStats.CPUUsage.TotalUsage = cpu["usage_usec"] * 1000
+	res.CPUStats.CPUUsage.UsageInUsermode = cpu["user_usec"] * 1000
+	res.CPUStats.CPUUsage.UsageInKernelmode = cpu["system_usec"] * 1000
+	res.CPUStats.ThrottlingData = ThrottlingData{
+		Periods:          cpu["nr_periods"],
+		ThrottledPeriods: cpu["nr_throttled"],
+		ThrottledTime:    cpu["throttled_usec"] * 1000,
+	}
+	res.MemoryStats.Usage = readInt(filepath.Join(dir, "memory.current"))
+	res.MemoryStats.MaxUsage = readInt(filepath.Join(dir, "memory.peak"))
+	res.MemoryStats.Limit = readInt(filepath.Join(dir, "memory.max"))
+	res.MemoryStats.Stats, _ = readKeyValues(filepath.Join(dir, "memory.stat"))
+	res.BlkioStats = readIOStat(filepath.Join(dir, "io.stat"))
+	res.PidsStats = PidsStats{
+		Current: readInt(filepath.Join(dir, "pids.current")),
+		Limit:   uint64(readInt(filepath.Join(dir, "pids.max"))),
+	}
+	return nil
+}
+
+func (c *cgroupStats) readV1(res *Stats) error {
+	usage, err := ioutil.ReadFile(filepath.Join(c.dir("cpuacct"), "cpuacct.usage"))
+	if err != nil {
+		return err
+	}
+	res.CPUStats.CPUUsage.TotalUsage = parseInt(string(usage))
+	if percpu, err := ioutil.ReadFile(filepath.Join(c.dir("cpuacct"), "cpuacct.usage_percpu")); err == nil {
+		for _, one := range strings.Fields(string(percpu)) {
+			res.CPUStats.CPUUsage.PercpuUsage = append(res.CPUStats.CPUUsage.PercpuUsage, parseInt(one))
+		}
+	}
+	times, _ := readKeyValues(filepath.Join(c.dir("cpuacct"), "cpuacct.stat"))
+	res.CPUStats.CPUUsage.UsageInUsermode = times["user"] * (1000000000 / userHz)
+	res.CPUStats.CPUUsage.UsageInKernelmode = times["system"] * (1000000000 / userHz)
+	throttling, _ := readKeyValues(filepath.Join(c.dir("cpu"), "cpu.stat"))
+	res.CPUStats.ThrottlingData = ThrottlingData{
+		Periods:          throttling["nr_periods"],
+		ThrottledPeriods: throttling["nr_throttled"],
+		ThrottledTime:    throttling["throttled_time"],
+	}
+	memory := c.dir("memory")
+	res.MemoryStats.Usage = readInt(filepath.Join(memory, "memory.usage_in_bytes"))
+	res.MemoryStats.MaxUsage = readInt(filepath.Join(memory, "memory.max_usage_in_bytes"))
+	res.MemoryStats.Limit = readInt(filepath.Join(memory, "memory.limit_in_bytes"))
+	res.MemoryStats.Stats, _ = readKeyValues(filepath.Join(memory, "memory.stat"))
+	blkio := c.dir("blkio")
+	res.BlkioStats.IoServiceBytesRecursive = readBlkio(blkio, "blkio.io_service_bytes_recursive", "blkio.throttle.io_service_bytes")
+	res.BlkioStats.IoServicedRecursive = readBlkio(blkio, "blkio.io_serviced_recursive", "blkio.throttle.io_serviced")
+	res.PidsStats = PidsStats{
+		Current: readInt(filepath.Join(c.dir("pids"), "pids.current")),
+		Limit:   uint64(readInt(filepath.Join(c.dir("pids"), "pids.max"))),
+	}
+	return nil
+}
+
+func parseInt(value string) int64 {
+	res, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return res
+}
+
+// readInt reads a file with one number, 0 if it is missing or max (no limit)
+func readInt(path string) int64 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return parseInt(string(data))
+}
+
+// readKeyValues reads the files with lines like "key value" (memory.stat, cpu.stat)
+func readKeyValues(path string) (map[string]int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]int64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			res[fields[0]] = parseInt(fields[1])
+		}
+	}
+	return res, nil
+}
+
+// readBlkio reads the lines like "8:0 Read 4096" of the first of the files with values. The recursive files are empty without the CFQ scheduler
+func readBlkio(dir string, files ...string) []BlkioStatEntry {
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+		var res []BlkioStatEntry
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			major, minor := parseDevice(fields[0])
+			res = append(res, BlkioStatEntry{Major: major, Minor: minor, Op: fields[1], Value: parseInt(fields[2])})
+		}
+		if len(res) > 0 {
+			return res
+		}
+	}
+	return nil
+}
+
+// readIOStat reads the io.stat of cgroup v2 with lines like "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0"
+func readIOStat(path string) BlkioStats {
+	var res BlkioStats
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return res
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		major, minor := parseDevice(fields[0])
+		for _, one := range fields[1:] {
+			parts := strings.SplitN(one, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			entry := BlkioStatEntry{Major: major, Minor: minor, Value: parseInt(parts[1])}
+			switch parts[0] {
+			case "rbytes":
+				entry.Op = "read"
+				res.IoServiceBytesRecursive = append(res.IoServiceBytesRecursive, entry)
+			case "wbytes":
+				entry.Op = "write"
+				res.IoServiceBytesRecursive = append(res.IoServiceBytesRecursive, entry)
+			case "rios":
+				entry.Op = "read"
+				res.IoServicedRecursive = append(res.IoServicedRecursive, entry)
+			case "wios":
+				entry.Op = "write"
+				res.IoServicedRecursive = append(res.IoServicedRecursive, entry)
+			}
+		}
+	}
+	return res
+}
+
+func parseDevice(device string) (int64, int64) {
+	parts := strings.SplitN(device, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	return parseInt(parts[0]), parseInt(parts[1])
+}
+
+// readNetDev reads the counters of the network interfaces of the container without loopback
+func readNetDev(path string, pid int) Networks {
+	if pid <= 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return ParseNetDev(string(data))
+}
+
+// ParseNetDev returns the counters of the network interfaces of a /proc/net/dev file without loopback, nil if there is none
+func ParseNetDev(data string) Networks {
+	res := make(Networks)
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if name == "lo" || len(fields) < 12 {
+			continue
+		}
+		res[name] = NetworkStats{
+			RxBytes:   parseInt(fields[0]),
+			RxPackets: parseInt(fields[1]),
+			RxErrors:  parseInt(fields[2]),
+			RxDropped: parseInt(fields[3]),
+			TxBytes:   parseInt(fields[8]),
+			TxPackets: parseInt(fields[9]),
+			TxErrors:  parseInt(fields[10]),
+			TxDropped: parseInt(fields[11]),
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// readProcStat returns the cpu time of the host in nanoseconds and the count of cpus
+func readProcStat(path string) (int64, int64) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	var total, cpus int64
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal, guest is part of user
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			total += parseInt(fields[i])
+		}
+	}
+	return total * (1000000000 / userHz), cpus
+}
+
+// readMemTotal returns the memory of the host in bytes
+func readMemTotal(path string) int64 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			return parseInt(fields[1]) * 1024
+		}
+	}
+	return 0
+}
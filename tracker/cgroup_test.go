@@ -0,0 +1,208 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const procFiles = "/proc"
+
+// fakeHost creates the files below a temporary host root
+func fakeHost(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "funk_cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+var fakeProc = map[string]string{
+	procFiles + "/stat":    "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 50 0 50 350 50 0 0 0 0 0\ncpu1 50 0 50 350 50 0 0 0 0 0\nintr 1\n",
+	procFiles + "/meminfo": "MemTotal:        1000000 kB\nMemFree:          500000 kB\n",
+	procFiles + "/42/net/dev": `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0: 2000000      20    1    2    0     0          0         0  1000000      10    3    4    0     0       0          0
+  eth1: 1000000      10    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+`,
+}
+
+func withProc(files map[string]string) map[string]string {
+	res := make(map[string]string)
+	for k, v := range fakeProc {
+		res[k] = v
+	}
+	for k, v := range files {
+		res[k] = v
+	}
+	return res
+}
+
+func Test_cgroupStats_v2(t *testing.T) {
+	dir := "/sys/fs/cgroup/system.slice/docker-abc.scope"
+	root := fakeHost(t, withProc(map[string]string{
+		"/sys/fs/cgroup/cgroup.controllers": "cpu io memory pids",
+		procFiles + "/42/cgroup":            "0::/system.slice/docker-abc.scope\n",
+		dir + "/cpu.stat":                   "usage_usec 2000000\nuser_usec 1500000\nsystem_usec 500000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 3000\n",
+		dir + "/memory.current":             "30000000\n",
+		dir + "/memory.max":                 "max\n",
+		dir + "/memory.stat":                "anon 20000000\ninactive_file 10000000\n",
+		dir + "/io.stat":                    "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n",
+		dir + "/pids.current":               "7\n",
+		dir + "/pids.max":                   "max\n",
+	}))
+	defer os.RemoveAll(root)
+
+	c, err := newCgroupStats(root, "abc", 42)
+	if err != nil {
+		t.Fatalf("newCgroupStats() error = %v", err)
+	}
+	if !c.v2 || c.path != "/system.slice/docker-abc.scope" {
+		t.Errorf("newCgroupStats() v2 = %v, path = %v", c.v2, c.path)
+	}
+	now := time.Date(2019, time.August, 12, 12, 49, 59, 0, time.UTC)
+	got, err := c.read(now, 42)
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	want := Stats{
+		ID:   "abc",
+		Read: "2019-08-12T12:49:59Z",
+		CPUStats: CPUStats{
+			CPUUsage:       CPUUsage{TotalUsage: 2000000000, UsageInUsermode: 1500000000, UsageInKernelmode: 500000000},
+			SystemCPUUsage: 10000000000,
+			OnlineCpus:     2,
+			ThrottlingData: ThrottlingData{Periods: 10, ThrottledPeriods: 2, ThrottledTime: 3000000},
+		},
+		MemoryStats: MemoryStats{
+			Usage: 30000000,
+			Limit: 1024000000,
+			Stats: map[string]int64{"anon": 20000000, "inactive_file": 10000000},
+		},
+		BlkioStats: BlkioStats{
+			IoServiceBytesRecursive: []BlkioStatEntry{{Major: 8, Op: "read", Value: 4096}, {Major: 8, Op: "write", Value: 8192}},
+			IoServicedRecursive:     []BlkioStatEntry{{Major: 8, Op: "read", Value: 1}, {Major: 8, Op: "write", Value: 2}},
+		},
+		PidsStats: PidsStats{Current: 7},
+		Networks: Networks{
+			"eth0": {RxBytes: 2000000, RxPackets: 20, RxErrors: 1, RxDropped: 2, TxBytes: 1000000, TxPackets: 10, TxErrors: 3, TxDropped: 4},
+			"eth1": {RxBytes: 1000000, RxPackets: 10},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read() = %+v, want %+v", got, want)
+	}
+
+	next, _ := c.read(now.Add(time.Second), 42)
+	if next.Preread != want.Read || !reflect.DeepEqual(next.PrecpuStats, want.CPUStats) {
+		t.Errorf("second read() has not the previous cpu stats Preread = %v", next.Preread)
+	}
+	// the container was restarted and has a new pid
+	restarted := filepath.Join(root, procFiles, "43", "net", "dev")
+	os.MkdirAll(filepath.Dir(restarted), 0755)
+	ioutil.WriteFile(restarted, []byte("  eth0:     500       5    0    0    0     0          0         0      300       3    0    0    0     0       0          0\n"), 0644)
+	if after, _ := c.read(now.Add(2*time.Second), 43); !reflect.DeepEqual(after.Networks, Networks{"eth0": {RxBytes: 500, RxPackets: 5, TxBytes: 300, TxPackets: 3}}) {
+		t.Errorf("read() after restart networks = %v, want the ones of the new pid", after.Networks)
+	}
+	if cumulated := CumulateStatsInfo(got); cumulated.RamUsageMb != 30 || cumulated.RamWorkingSetMb != 20 || cumulated.NetIOReceiveMb != 3 || cumulated.BlockIOWriteOps != 2 {
+		t.Errorf("CumulateStatsInfo() = %+v", cumulated)
+	}
+
+	os.RemoveAll(filepath.Join(root, dir))
+	if _, err := c.read(now, 42); err == nil {
+		t.Errorf("read() of removed cgroup has no error")
+	}
+}
+
+func Test_cgroupStats_v1(t *testing.T) {
+	root := fakeHost(t, withProc(map[string]string{
+		"/sys/fs/cgroup/cpuacct/docker/abc/cpuacct.usage":                     "3000000000\n",
+		"/sys/fs/cgroup/cpuacct/docker/abc/cpuacct.usage_percpu":              "1000000000 2000000000 \n",
+		"/sys/fs/cgroup/cpuacct/docker/abc/cpuacct.stat":                      "user 200\nsystem 100\n",
+		"/sys/fs/cgroup/cpu/docker/abc/cpu.stat":                              "nr_periods 5\nnr_throttled 1\nthrottled_time 1000\n",
+		"/sys/fs/cgroup/memory/docker/abc/memory.usage_in_bytes":              "50000000\n",
+		"/sys/fs/cgroup/memory/docker/abc/memory.max_usage_in_bytes":          "60000000\n",
+		"/sys/fs/cgroup/memory/docker/abc/memory.limit_in_bytes":              "100000000\n",
+		"/sys/fs/cgroup/memory/docker/abc/memory.stat":                        "cache 5000000\ntotal_inactive_file 20000000\n",
+		"/sys/fs/cgroup/blkio/docker/abc/blkio.io_service_bytes_recursive":    "Total 0\n",
+		"/sys/fs/cgroup/blkio/docker/abc/blkio.throttle.io_service_bytes":     "8:0 Read 100\n8:0 Write 200\n8:0 Total 300\nTotal 300\n",
+		"/sys/fs/cgroup/blkio/docker/abc/blkio.throttle.io_serviced":          "8:0 Read 1\n8:0 Write 2\n",
+		"/sys/fs/cgroup/pids/docker/abc/pids.current":                         "3\n",
+		"/sys/fs/cgroup/pids/docker/abc/pids.max":                             "100\n",
+		"/sys/fs/cgroup/memory/kubepods/burstable/podxyz/abc/memory.stat":     "",
+		"/sys/fs/cgroup/memory/kubepods/burstable/podxyz/other/memory.stat":   "",
+		"/sys/fs/cgroup/memory/kubepods/burstable/podxyz/abcdef/memory.stat":  "",
+		"/sys/fs/cgroup/memory/system.slice/containerd.service/memory.stat":   "",
+		"/sys/fs/cgroup/cpuacct/kubepods/burstable/podxyz/abcd/cpuacct.usage": "1\n",
+	}))
+	defer os.RemoveAll(root)
+
+	c, err := newCgroupStats(root, "abc", 0)
+	if err != nil {
+		t.Fatalf("newCgroupStats() error = %v", err)
+	}
+	if c.v2 || c.path != "docker/abc" {
+		t.Errorf("newCgroupStats() v2 = %v, path = %v", c.v2, c.path)
+	}
+	got, err := c.read(time.Date(2019, time.August, 12, 12, 49, 59, 0, time.UTC), 0)
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	want := Stats{
+		ID:   "abc",
+		Read: "2019-08-12T12:49:59Z",
+		CPUStats: CPUStats{
+			CPUUsage:       CPUUsage{TotalUsage: 3000000000, PercpuUsage: []int64{1000000000, 2000000000}, UsageInUsermode: 2000000000, UsageInKernelmode: 1000000000},
+			SystemCPUUsage: 10000000000,
+			OnlineCpus:     2,
+			ThrottlingData: ThrottlingData{Periods: 5, ThrottledPeriods: 1, ThrottledTime: 1000},
+		},
+		MemoryStats: MemoryStats{
+			Usage:    50000000,
+			MaxUsage: 60000000,
+			Limit:    100000000,
+			Stats:    map[string]int64{"cache": 5000000, "total_inactive_file": 20000000},
+		},
+		BlkioStats: BlkioStats{
+			IoServiceBytesRecursive: []BlkioStatEntry{{Major: 8, Op: "Read", Value: 100}, {Major: 8, Op: "Write", Value: 200}, {Major: 8, Op: "Total", Value: 300}},
+			IoServicedRecursive:     []BlkioStatEntry{{Major: 8, Op: "Read", Value: 1}, {Major: 8, Op: "Write", Value: 2}},
+		},
+		PidsStats: PidsStats{Current: 3, Limit: 100},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_cgroupStats_findPath(t *testing.T) {
+	root := fakeHost(t, withProc(map[string]string{
+		"/sys/fs/cgroup/cgroup.controllers":                                    "",
+		"/sys/fs/cgroup/kubepods.slice/pod1/cri-containerd-abc.scope/cpu.stat": "",
+		procFiles + "/42/cgroup":                                               "0::/../../kubepods.slice/pod1/cri-containerd-abc.scope\n",
+	}))
+	defer os.RemoveAll(root)
+
+	c, err := newCgroupStats(root, "abc", 42)
+	if err != nil {
+		t.Fatalf("newCgroupStats() error = %v", err)
+	}
+	if c.path != "kubepods.slice/pod1/cri-containerd-abc.scope" {
+		t.Errorf("newCgroupStats() path = %v", c.path)
+	}
+	if _, err := newCgroupStats(root, "unknown", 0); err == nil {
+		t.Errorf("newCgroupStats() of unknown container has no error")
+	}
+}
@@ -0,0 +1,102 @@
+package tracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint is the read position of a file
+type Checkpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+// Checkpoints store the read positions of the followed files by their inode.
+// So a file is read on after an agent restart or if it is renamed by the log rotation
+type Checkpoints struct {
+	path    string
+	mu      sync.Mutex
+	files   map[string]Checkpoint
+	changed bool
+}
+
+// LoadCheckpoints loads the checkpoints saved at path. A missing or broken file starts without checkpoints
+func LoadCheckpoints(path string) *Checkpoints {
+	res := &Checkpoints{
+		path:  path,
+		files: make(map[string]Checkpoint),
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &res.files)
+	}
+	return res
+}
+
+// Get returns the checkpoint of the file with id
+func (c *Checkpoints) Get(id string) (Checkpoint, bool) {
+	if c == nil || id == "" {
+		return Checkpoint{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res, exist := c.files[id]
+	return res, exist
+}
+
+// Set updates the checkpoint of the file with id
+func (c *Checkpoints) Set(id string, checkpoint Checkpoint) {
+	if c == nil || id == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files[id] != checkpoint {
+		c.files[id] = checkpoint
+		c.changed = true
+	}
+}
+
+// Remove deletes the checkpoint of the file with id
+func (c *Checkpoints) Remove(id string) {
+	if c == nil || id == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exist := c.files[id]; exist {
+		delete(c.files, id)
+		c.changed = true
+	}
+}
+
+// Save writes the checkpoints if they are changed since last save.
+// The file is written to a temp file and renamed so it is never half written
+func (c *Checkpoints) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+	data, err := json.Marshal(c.files)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
@@ -0,0 +1,106 @@
+package tracker
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// pathMapping maps a directory inside the container to the directory at the host
+type pathMapping struct {
+	container string
+	host      string
+}
+
+// containerPathMappings returns the mounted volumes (most specific first) and the merged filesystem (overlay2 MergedDir) of the container.
+// hostRoot is put in front of the host paths if the agent sees the host filesystem at another place (like /host)
+func containerPathMappings(inspect *types.ContainerJSON, hostRoot string) []pathMapping {
+	if inspect == nil {
+		return nil
+	}
+	var res []pathMapping
+	for _, one := range inspect.Mounts {
+		if one.Source == "" || one.Destination == "" {
+			continue
+		}
+		res = append(res, pathMapping{
+			container: filepath.Clean(one.Destination),
+			host:      filepath.Join(hostRoot, one.Source),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return len(res[i].container) > len(res[j].container)
+	})
+	if inspect.ContainerJSONBase != nil {
+		if merged := inspect.GraphDriver.Data["MergedDir"]; merged != "" {
+			res = append(res, pathMapping{
+				container: "/",
+				host:      filepath.Join(hostRoot, merged),
+			})
+		}
+	}
+	return res
+}
+
+// isInside returns the part of path behind dir and true if path is inside dir
+func isInside(path, dir string) (string, bool) {
+	if dir == "/" {
+		return path, strings.HasPrefix(path, "/")
+	}
+	if path == dir {
+		return "", true
+	}
+	if strings.HasPrefix(path, dir+"/") {
+		return strings.TrimPrefix(path, dir), true
+	}
+	return "", false
+}
+
+// resolveContainerPath returns the host path (or glob) of path (or glob) inside the container
+func resolveContainerPath(mappings []pathMapping, path string) (string, bool) {
+	path = filepath.Clean(path)
+	for _, one := range mappings {
+		if rest, ok := isInside(path, one.container); ok {
+			return filepath.Join(one.host, rest), true
+		}
+	}
+	return "", false
+}
+
+// containerPath returns the path inside the container of a host path found by resolveContainerPath
+func containerPath(mappings []pathMapping, hostPath string) string {
+	for _, one := range mappings {
+		if rest, ok := isInside(hostPath, one.host); ok {
+			return filepath.Join(one.container, rest)
+		}
+	}
+	return hostPath
+}
+
+// newContainerFileFollower follows the files of label funk.log.files (comma separated globs inside the container).
+// It returns nil if the label is not set or no path can be resolved
+func newContainerFileFollower(container types.Container, inspect *types.ContainerJSON, processor *logProcessor, opts Options) *fileFollower {
+	mappings := containerPathMappings(inspect, opts.HostRoot)
+	var paths []string
+	for _, one := range strings.Split(container.Labels["funk.log.files"], ",") {
+		if one = strings.TrimSpace(one); one == "" {
+			continue
+		}
+		hostPath, ok := resolveContainerPath(mappings, one)
+		if !ok {
+			processor.logs.Errorw("Can not resolve funk.log.files path, no volume or merged filesystem found", "path", one)
+			continue
+		}
+		paths = append(paths, hostPath)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	res := newFileFollower(FileInput{Paths: paths}, processor, opts.Checkpoints)
+	res.sourcePath = func(path string) string {
+		return containerPath(mappings, path)
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+package tracker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func getInspectWithFilesystem(merged string, mounts ...types.MountPoint) *types.ContainerJSON {
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			GraphDriver: types.GraphDriverData{
+				Name: "overlay2",
+				Data: map[string]string{"MergedDir": merged},
+			},
+		},
+		Mounts: mounts,
+	}
+}
+
+func Test_resolveContainerPath(t *testing.T) {
+	mappings := containerPathMappings(getInspectWithFilesystem("/var/lib/docker/overlay2/abc/merged",
+		types.MountPoint{Source: "/var/lib/docker/volumes/logs/_data", Destination: "/var/log"},
+		types.MountPoint{Source: "/srv/app-logs", Destination: "/var/log/app/"},
+	), "/host")
+	tests := []struct {
+		name string
+		path string
+		want string
+		ok   bool
+	}{
+		{
+			name: "most specific volume wins",
+			path: "/var/log/app/*.log",
+			want: "/host/srv/app-logs/*.log",
+			ok:   true,
+		},
+		{
+			name: "volume",
+			path: "/var/log/syslog",
+			want: "/host/var/lib/docker/volumes/logs/_data/syslog",
+			ok:   true,
+		},
+		{
+			name: "no volume so the merged filesystem is used",
+			path: "/opt/app/logs/*.log",
+			want: "/host/var/lib/docker/overlay2/abc/merged/opt/app/logs/*.log",
+			ok:   true,
+		},
+		{
+			name: "only a prefix of the directory name is no match",
+			path: "/var/logging/app.log",
+			want: "/host/var/lib/docker/overlay2/abc/merged/var/logging/app.log",
+			ok:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveContainerPath(mappings, tt.path)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("resolveContainerPath() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+	if got := containerPath(mappings, "/host/srv/app-logs/error.log"); got != "/var/log/app/error.log" {
+		t.Errorf("containerPath() = %v, want /var/log/app/error.log", got)
+	}
+	if _, ok := resolveContainerPath(containerPathMappings(&types.ContainerJSON{}, ""), "/var/log/app.log"); ok {
+		t.Errorf("resolveContainerPath() without filesystem information want no path")
+	}
+}
+
+func Test_newContainerFileFollower(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	merged := filepath.Join(root, "merged")
+	volume := filepath.Join(root, "volume")
+	for _, one := range []string{filepath.Join(merged, "opt", "app"), volume} {
+		if err := os.MkdirAll(one, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	container := types.Container{
+		Names: []string{"mocktest0"},
+		Labels: map[string]string{
+			"funk.log.files": "/opt/app/*.log, /var/log/app/*.log",
+		},
+	}
+	inspect := getInspectWithFilesystem(merged, types.MountPoint{Source: volume, Destination: "/var/log/app"})
+	files := newContainerFileFollower(container, inspect, newLogProcessor(container, Options{}), Options{})
+	if files == nil {
+		t.Fatal("newContainerFileFollower() = nil, want a follower")
+	}
+	files.scan(true)
+	appendFile(t, filepath.Join(merged, "opt", "app", "app.log"), "{\"merged\":true}\n")
+	appendFile(t, filepath.Join(volume, "error.log"), "{\"volume\":true}\n")
+	files.poll()
+	want := map[TrackerLogs]bool{
+		`{"log.file.path":"/opt/app/app.log","merged":true}`:       true,
+		`{"log.file.path":"/var/log/app/error.log","volume":true}`: true,
+	}
+	got := files.takeLogs()
+	if len(got) != len(want) {
+		t.Fatalf("fileFollower.takeLogs() = %v, want %v", got, want)
+	}
+	for _, one := range got {
+		if !want[one] {
+			t.Errorf("fileFollower.takeLogs() unexpected logline %v", one)
+		}
+	}
+	if got := newContainerFileFollower(types.Container{Names: []string{"mocktest0"}}, inspect, newLogProcessor(container, Options{}), Options{}); got != nil {
+		t.Errorf("newContainerFileFollower() without label = %v, want nil", got)
+	}
+}
+
+func TestTracker_followFiles_EndsWithContainer(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := types.Container{
+		ID:     "abc",
+		Names:  []string{"/mocktest0"},
+		Labels: map[string]string{"funk.log.files": "/opt/app/*.log"},
+	}
+	tr := &Tracker{
+		ctx:       context.Background(),
+		container: container,
+		client:    &MockDockerClient{},
+		processor: newLogProcessor(container, Options{}),
+		inspect:   getInspectWithFilesystem(root),
+	}
+	done := make(chan bool)
+	go func() {
+		tr.followFiles()
+		close(done)
+	}()
+	tr.readLogs()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("followFiles() has not ended with the logs of the container")
+	}
+}
+
+func TestTracker_GetLogs_Files(t *testing.T) {
+	files := newFileFollower(FileInput{}, &logProcessor{}, nil)
+	files.logs = []TrackerLogs{`{"file":true}`}
+	tr := &Tracker{
+		logs:  []TrackerLogs{`{"stdout":true}`},
+		files: files,
+	}
+	want := []TrackerLogs{`{"stdout":true}`, `{"file":true}`}
+	if got := tr.GetLogs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tracker.GetLogs() = %v, want %v", got, want)
+	}
+}
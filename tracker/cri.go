@@ -0,0 +1,345 @@
+package tracker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logger"
+)
+
+// CRILine is one line of a CRI log file like
+// 2016-10-06T00:17:09.669794202Z stdout F the logline
+type CRILine struct {
+	Time    string
+	Stream  string
+	Partial bool // Partial is true for tag P, the logline goes on at the next line of this stream
+	Content string
+}
+
+// ParseCRILine parse a line of a CRI log file (containerd, CRI-O)
+func ParseCRILine(line string) (CRILine, error) {
+	parts := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 4)
+	if len(parts) < 3 {
+		return CRILine{}, errors.New("No CRI logline: " + line)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return CRILine{}, errors.New("No CRI logline timestamp: " + parts[0])
+	}
+	res := CRILine{
+		Time:    parts[0],
+		Stream:  parts[1],
+		Partial: strings.Split(parts[2], ":")[0] == "P",
+	}
+	if len(parts) == 4 {
+		res.Content = parts[3]
+	}
+	return res, nil
+}
+
+// maxCRILineLength is the maximum length of a reassembled logline, longer ones are send in pieces
+const maxCRILineLength = 1 << 20
+
+// criLineJoiner reassemble the partial (P) lines of each stream
+type criLineJoiner struct {
+	partial map[string]*CRILine
+}
+
+func newCRILineJoiner() *criLineJoiner {
+	return &criLineJoiner{partial: make(map[string]*CRILine)}
+}
+
+// join returns the complete line and true if line finish a logline.
+// The time of the first piece is used
+func (j *criLineJoiner) join(line CRILine) (CRILine, bool) {
+	if existing, ok := j.partial[line.Stream]; ok {
+		existing.Content += line.Content
+		line.Time = existing.Time
+		line.Content = existing.Content
+	}
+	if line.Partial && len(line.Content) < maxCRILineLength {
+		j.partial[line.Stream] = &line
+		return line, false
+	}
+	delete(j.partial, line.Stream)
+	line.Partial = false
+	return line, true
+}
+
+// currentCRILogFile returns the log file of the last start (0.log, 1.log, ...) inside dir.
+// It returns an empty path if there is no log file yet and an error if dir is removed
+func currentCRILogFile(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return "", err
+	}
+	res, restart := "", -1
+	for _, one := range files {
+		count, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(one), ".log"))
+		if err != nil {
+			continue
+		}
+		if count > restart {
+			res, restart = one, count
+		}
+	}
+	return res, nil
+}
+
+// CRIConfig is one entry of the CRI config like
+// {"namespace": "shop", "pod": "web-*", "labels": {"funk.log.minlevel": "warn"}}
+// The CRI log files have no labels, so this config gives the funk labels to the containers
+type CRIConfig struct {
+	Namespace string            `json:"namespace,omitempty"` // Namespace is a pattern (like web-*) of the namespace, empty for all
+	Pod       string            `json:"pod,omitempty"`       // Pod is a pattern of the pod name, empty for all
+	Container string            `json:"container,omitempty"` // Container is a pattern of the container name, empty for all
+	Labels    map[string]string `json:"labels"`              // Labels are the funk labels like funk.log.minlevel
+}
+
+// LoadCRIConfig reads the CRI config, a json list of CRIConfig
+func LoadCRIConfig(file string) ([]CRIConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var res []CRIConfig
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	for _, one := range res {
+		for _, pattern := range []string{one.Namespace, one.Pod, one.Container} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, errors.New("Invalid pattern " + pattern + " at CRI config: " + err.Error())
+			}
+		}
+	}
+	return res, nil
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	res, _ := path.Match(pattern, value)
+	return res
+}
+
+// matches returns true if the entry is used for the container of the pod
+func (c CRIConfig) matches(namespace, pod, container string) bool {
+	return matchPattern(c.Namespace, namespace) && matchPattern(c.Pod, pod) && matchPattern(c.Container, container)
+}
+
+// DiscoverCRIContainers returns all containers with a log directory like <namespace>_<pod>_<uid>/<container> inside root (/var/log/pods).
+// The id is the directory relative to root and the kubernetes labels are filled like dockershim does it.
+// The labels of all matching config entries are added, later entries win.
+// Containers with funk.log=false are skipped. funk.log.stats is false because there are no stats at this input
+func DiscoverCRIContainers(root string, config []CRIConfig) ([]types.Container, error) {
+	pods, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var res []types.Container
+	for _, pod := range pods {
+		podInfo := strings.SplitN(pod.Name(), "_", 3)
+		if !pod.IsDir() || len(podInfo) != 3 {
+			continue
+		}
+		containers, err := ioutil.ReadDir(filepath.Join(root, pod.Name()))
+		if err != nil {
+			continue
+		}
+		for _, container := range containers {
+			if !container.IsDir() {
+				continue
+			}
+			labels := make(map[string]string)
+			for _, one := range config {
+				if one.matches(podInfo[0], podInfo[1], container.Name()) {
+					for key, value := range one.Labels {
+						labels[key] = value
+					}
+				}
+			}
+			if labels["funk.log"] == "false" {
+				continue
+			}
+			labels["io.kubernetes.pod.namespace"] = podInfo[0]
+			labels["io.kubernetes.pod.name"] = podInfo[1]
+			labels["io.kubernetes.pod.uid"] = podInfo[2]
+			labels["io.kubernetes.container.name"] = container.Name()
+			labels["funk.log.stats"] = "false"
+			res = append(res, types.Container{
+				ID:     pod.Name() + "/" + container.Name(),
+				Names:  []string{"/" + podInfo[1] + "/" + container.Name()},
+				Labels: labels,
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// CRITracker tracks the logs of a container by its CRI log files
+type CRITracker struct {
+	container types.Container
+	dir       string
+	processor *logProcessor
+	opts      Options
+	logs      []TrackerLogs
+	interval  time.Duration
+	mu        sync.Mutex
+}
+
+// NewCRITracker starts to follow the log files of container (found by DiscoverCRIContainers) inside root
+func NewCRITracker(root string, container types.Container, opts Options) *CRITracker {
+	res := &CRITracker{
+		container: container,
+		dir:       filepath.Join(root, container.ID),
+		processor: newLogProcessor(container, opts),
+		opts:      opts,
+		interval:  time.Second,
+	}
+	go res.readLogs()
+	return res
+}
+
+func (t *CRITracker) readLogs() {
+	container := t.GetContainer()
+	logs := getLoggerWithContainerInformation(logger.Get(), &container)
+	tailer := newFileTailer(func() (string, error) {
+		return currentCRILogFile(t.dir)
+	})
+	joiner := newCRILineJoiner()
+	multiline := make(map[string]*multilineJoiner)
+	processor := t.getProcessor()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		if current := t.getProcessor(); current != processor {
+			for _, one := range multiline {
+				t.appendLogs(processor, one.flush(time.Now(), true))
+			}
+			processor, multiline = current, make(map[string]*multilineJoiner)
+		}
+		lines, err := tailer.poll()
+		for _, one := range lines {
+			t.handleLine(processor, joiner, multiline, one)
+		}
+		for _, one := range multiline {
+			t.appendLogs(processor, one.flush(time.Now(), os.IsNotExist(err)))
+		}
+		if os.IsNotExist(err) {
+			logs.Infow("Log directory removed stop tracking")
+			return
+		}
+		if err != nil {
+			logs.Errorw("Error Read CRI logfile:" + err.Error())
+		}
+		<-ticker.C
+	}
+}
+
+// getProcessor returns the logProcessor of the current labels
+func (t *CRITracker) getProcessor() *logProcessor {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.processor
+}
+
+func (t *CRITracker) handleLine(processor *logProcessor, joiner *criLineJoiner, multiline map[string]*multilineJoiner, text string) {
+	line, err := ParseCRILine(text)
+	if err != nil {
+		processor.logs.Errorw(err.Error())
+		return
+	}
+	line, complete := joiner.join(line)
+	if !complete {
+		return
+	}
+	if created, err := time.Parse(time.RFC3339Nano, line.Time); err == nil && created.Before(startDate) {
+		return
+	}
+	stream, exist := multiline[line.Stream]
+	if !exist {
+		stream = processor.newMultiline()
+		multiline[line.Stream] = stream
+	}
+	t.appendLogs(processor, stream.add(line.Time+" "+line.Content, time.Now()))
+}
+
+func (t *CRITracker) appendLogs(processor *logProcessor, lines []string) {
+	tracks := processor.processAll(lines)
+	if len(tracks) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logs = append(t.logs, tracks...)
+}
+
+func (t *CRITracker) SearchIndex() string {
+	return searchIndex(t.GetContainer())
+}
+
+// GetStats returns empty stats, the CRI log files have no stats information
+func (t *CRITracker) GetStats() Stats {
+	return Stats{}
+}
+
+// GetCumulateStats returns empty stats
+func (t *CRITracker) GetCumulateStats() CumulateStats {
+	return CumulateStats{}
+}
+
+func (t *CRITracker) GetLogs() []TrackerLogs {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := t.logs
+	t.logs = make([]TrackerLogs, 0)
+	return res
+}
+
+func (t *CRITracker) GetContainer() types.Container {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.container
+}
+
+// SetContainer saves the container with its changed labels (like the ones of the CRI config).
+// If a label used by the processing changed (funk.log.minlevel, filters, format or multiline) the loglines are processed with the new labels
+func (t *CRITracker) SetContainer(con types.Container) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if processorChanged(t.container, con) {
+		t.processor = newLogProcessor(con, t.opts)
+	}
+	t.container = con
+}
+
+func (t *CRITracker) GetStaticContent() string {
+	return t.GetContainer().Labels["funk.log.staticcontent"]
+}
+
+// GetFilterCounter returns the count of filtered logs since last call
+func (t *CRITracker) GetFilterCounter() FilterCounter {
+	return t.getProcessor().filter.Counter()
+}
+
+// GetInspect returns nil, there is no container inspect at this input
+func (t *CRITracker) GetInspect() *types.ContainerJSON {
+	return nil
+}
@@ -0,0 +1,230 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestParseCRILine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    CRILine
+		wantErr bool
+	}{
+		{
+			name: "full line",
+			line: "2016-10-06T00:17:09.669794202Z stdout F {\"mock\":true}\n",
+			want: CRILine{Time: "2016-10-06T00:17:09.669794202Z", Stream: "stdout", Content: `{"mock":true}`},
+		},
+		{
+			name: "partial line keeps the spaces of the content",
+			line: "2016-10-06T00:17:09.669794202+02:00 stderr P  part one ",
+			want: CRILine{Time: "2016-10-06T00:17:09.669794202+02:00", Stream: "stderr", Partial: true, Content: " part one "},
+		},
+		{
+			name: "empty line",
+			line: "2016-10-06T00:17:09.669794202Z stdout F",
+			want: CRILine{Time: "2016-10-06T00:17:09.669794202Z", Stream: "stdout"},
+		},
+		{
+			name:    "no timestamp",
+			line:    "stdout F message",
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			line:    "2016-10-06T00:17:09.669794202Z stdout",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCRILine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCRILine() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCRILine() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_criLineJoiner(t *testing.T) {
+	joiner := newCRILineJoiner()
+	lines := []CRILine{
+		{Time: "1", Stream: "stdout", Partial: true, Content: "hello "},
+		{Time: "2", Stream: "stderr", Content: "error"},
+		{Time: "3", Stream: "stdout", Partial: true, Content: "big "},
+		{Time: "4", Stream: "stdout", Content: "world"},
+	}
+	var got []CRILine
+	for _, one := range lines {
+		if res, ok := joiner.join(one); ok {
+			got = append(got, res)
+		}
+	}
+	want := []CRILine{
+		{Time: "2", Stream: "stderr", Content: "error"},
+		{Time: "1", Stream: "stdout", Content: "hello big world"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("criLineJoiner.join() = %v, want %v", got, want)
+	}
+}
+
+func appendFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverCRIContainers(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, one := range []string{"default_web-5d9f7c-x2x7q_6f1e2b54/app", "default_web-5d9f7c-x2x7q_6f1e2b54/sidecar", "no-pod-dir/app"} {
+		if err := os.MkdirAll(filepath.Join(root, one), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := []CRIConfig{
+		{Labels: map[string]string{"funk.log.minlevel": "info", "funk.searchindex": "default"}},
+		{Namespace: "default", Pod: "web-*", Labels: map[string]string{"funk.searchindex": "web", "funk.log.stats": "true"}},
+		{Container: "sidecar", Labels: map[string]string{"funk.log": "false"}},
+	}
+	got, err := DiscoverCRIContainers(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("DiscoverCRIContainers() found %d containers, want 1 (the sidecar has funk.log=false)", len(got))
+	}
+	want := types.Container{
+		ID:    "default_web-5d9f7c-x2x7q_6f1e2b54/app",
+		Names: []string{"/web-5d9f7c-x2x7q/app"},
+		Labels: map[string]string{
+			"io.kubernetes.pod.namespace":  "default",
+			"io.kubernetes.pod.name":       "web-5d9f7c-x2x7q",
+			"io.kubernetes.pod.uid":        "6f1e2b54",
+			"io.kubernetes.container.name": "app",
+			"funk.log.stats":               "false",
+			"funk.log.minlevel":            "info",
+			"funk.searchindex":             "web",
+		},
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("DiscoverCRIContainers() = %v, want %v", got[0], want)
+	}
+}
+
+func TestLoadCRIConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funk_cri_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "valid.json")
+	ioutil.WriteFile(valid, []byte(`[{"namespace":"shop","pod":"web-*","labels":{"funk.log.minlevel":"warn"}}]`), 0644)
+	got, err := LoadCRIConfig(valid)
+	want := []CRIConfig{{Namespace: "shop", Pod: "web-*", Labels: map[string]string{"funk.log.minlevel": "warn"}}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadCRIConfig() = %v, %v want %v", got, err, want)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	ioutil.WriteFile(invalid, []byte(`[{"pod":"web-[","labels":{}}]`), 0644)
+	if _, err := LoadCRIConfig(invalid); err == nil {
+		t.Errorf("LoadCRIConfig() no error for an invalid pattern")
+	}
+}
+
+func TestCRITracker_Logs(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := types.Container{
+		ID:     "default_web_6f1e2b54/app",
+		Names:  []string{"/web/app"},
+		Labels: map[string]string{"funk.log.minlevel": "info"},
+	}
+	dir := filepath.Join(root, container.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Add(time.Second).Format(time.RFC3339Nano)
+	appendFile(t, filepath.Join(dir, "0.log"),
+		"2019-08-12T12:52:07.123Z stdout F {\"old\":true}\n"+
+			now+" stdout P {\"mock\":\n"+
+			now+" stdout F true}\n"+
+			now+" stderr F {\"level\":\"debug\"}\n"+
+			now+" stderr F plain text\n")
+
+	tr := &CRITracker{
+		container: container,
+		dir:       dir,
+		processor: newLogProcessor(container, Options{}),
+		interval:  10 * time.Millisecond,
+	}
+	go tr.readLogs()
+	time.Sleep(60 * time.Millisecond)
+	want := []TrackerLogs{`{"mock":true}`, TrackerLogs(`{"message":"` + now + ` plain text"}`)}
+	if got := tr.GetLogs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CRITracker.GetLogs() = %v, want %v", got, want)
+	}
+	if got := tr.GetFilterCounter().DroppedByLevel; got != 1 {
+		t.Errorf("CRITracker.GetFilterCounter().DroppedByLevel = %v, want 1", got)
+	}
+}
+
+func TestCRITracker_SetContainer(t *testing.T) {
+	root, err := ioutil.TempDir("", "funk_pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := types.Container{
+		ID:     "default_web_6f1e2b54/app",
+		Names:  []string{"/web/app"},
+		Labels: map[string]string{"funk.log.minlevel": "info"},
+	}
+	dir := filepath.Join(root, container.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tr := &CRITracker{
+		container: container,
+		dir:       dir,
+		processor: newLogProcessor(container, Options{}),
+		interval:  10 * time.Millisecond,
+	}
+	go tr.readLogs()
+	processor := tr.getProcessor()
+	tr.SetContainer(types.Container{ID: container.ID, Names: container.Names, Labels: map[string]string{"funk.log.minlevel": "info", "funk.searchindex": "web"}})
+	if tr.getProcessor() != processor || tr.SearchIndex() != "web" {
+		t.Errorf("SetContainer() without changed processing labels has not kept the processor or has not saved the container")
+	}
+	tr.SetContainer(types.Container{ID: container.ID, Names: container.Names, Labels: map[string]string{"funk.log.minlevel": "error"}})
+	time.Sleep(30 * time.Millisecond)
+	appendFile(t, filepath.Join(dir, "0.log"), time.Now().UTC().Add(time.Second).Format(time.RFC3339Nano)+" stdout F {\"level\":\"warn\"}\n")
+	time.Sleep(60 * time.Millisecond)
+	if got := tr.GetLogs(); len(got) != 0 {
+		t.Errorf("CRITracker.GetLogs() = %v, want the warning dropped by the new funk.log.minlevel", got)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of a file, it stays the same if the file is renamed
+func fileID(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
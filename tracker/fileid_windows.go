@@ -0,0 +1,8 @@
+package tracker
+
+import "os"
+
+// fileID returns an empty id, there are no inodes at windows so no checkpoints are used
+func fileID(info os.FileInfo) string {
+	return ""
+}
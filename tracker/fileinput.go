@@ -0,0 +1,326 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/fasibio/funk_agent/logger"
+)
+
+// FileSourceField is the field of each logline with the path of the file it is read from
+const FileSourceField = "log.file.path"
+
+// FileInput is one entry of the file input config like
+// {"paths": ["/var/log/nginx/*.log"], "searchindex": "nginx", "formatRegex": "..."}
+type FileInput struct {
+	Paths         []string          `json:"paths"`
+	Exclude       []string          `json:"exclude,omitempty"`       // Exclude are patterns of paths (or filenames) which are not followed
+	SearchIndex   string            `json:"searchindex,omitempty"`   // SearchIndex like label funk.searchindex
+	StaticContent json.RawMessage   `json:"staticcontent,omitempty"` // StaticContent like label funk.log.staticcontent
+	FormatRegex   string            `json:"formatRegex,omitempty"`   // FormatRegex like label funk.log.formatRegex
+	Multiline     string            `json:"multiline,omitempty"`     // Multiline like label funk.log.multiline
+	Labels        map[string]string `json:"labels,omitempty"`        // Labels are all other funk labels like funk.log.minlevel
+}
+
+// LoadFileInputs reads the file input config, a json list of FileInput
+func LoadFileInputs(path string) ([]FileInput, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var res []FileInput
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Container returns a container for the input so it takes the same way as container logs.
+// The settings are the labels and funk.log.stats is false because files have no stats
+func (f FileInput) Container(index int) types.Container {
+	labels := make(map[string]string)
+	for key, value := range f.Labels {
+		labels[key] = value
+	}
+	setLabel := func(key, value string) {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	setLabel("funk.searchindex", f.SearchIndex)
+	setLabel("funk.log.staticcontent", string(f.StaticContent))
+	setLabel("funk.log.formatRegex", f.FormatRegex)
+	setLabel("funk.log.multiline", f.Multiline)
+	labels["funk.log.stats"] = "false"
+	return types.Container{
+		ID:     "file:" + strconv.Itoa(index),
+		Names:  []string{"/file:" + strings.Join(f.Paths, ",")},
+		Labels: labels,
+	}
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isGzipFile returns true for gzip compressed (rotated) files
+func isGzipFile(path string) bool {
+	if strings.HasSuffix(path, ".gz") {
+		return true
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, len(gzipMagic))
+	if _, err := file.Read(head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, gzipMagic)
+}
+
+func (f FileInput) isExcluded(path string) bool {
+	for _, pattern := range f.Exclude {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// findFiles returns all regular files matching the paths of the input
+func (f FileInput) findFiles() []string {
+	found := make(map[string]bool)
+	for _, pattern := range f.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, one := range matches {
+			info, err := os.Stat(one)
+			if err != nil || !info.Mode().IsRegular() || f.isExcluded(one) || isGzipFile(one) {
+				continue
+			}
+			found[one] = true
+		}
+	}
+	res := make([]string, 0, len(found))
+	for one := range found {
+		res = append(res, one)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// followedFile is one file of a fileFollower
+type followedFile struct {
+	tailer    *fileTailer
+	multiline *multilineJoiner
+}
+
+// fileFollower follows all files of a FileInput and process their lines
+type fileFollower struct {
+	input       FileInput
+	processor   *logProcessor
+	checkpoints *Checkpoints
+	files       map[string]*followedFile
+	sourcePath  func(path string) string // sourcePath returns the path written to log.file.path
+	logs        []TrackerLogs
+	mu          sync.Mutex
+}
+
+func newFileFollower(input FileInput, processor *logProcessor, checkpoints *Checkpoints) *fileFollower {
+	return &fileFollower{
+		input:       input,
+		processor:   processor,
+		checkpoints: checkpoints,
+		files:       make(map[string]*followedFile),
+		sourcePath: func(path string) string {
+			return path
+		},
+	}
+}
+
+// run follows the files until stop is closed. Files existing at start without checkpoint are read from their end
+func (t *fileFollower) run(interval time.Duration, stop <-chan struct{}) {
+	t.scan(true)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.poll()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// scan starts to follow new files
+func (t *fileFollower) scan(startAtEnd bool) {
+	for _, path := range t.input.findFiles() {
+		if _, exist := t.files[path]; exist {
+			continue
+		}
+		filePath := path
+		tailer := newFileTailer(func() (string, error) {
+			if _, err := os.Stat(filePath); err != nil {
+				return "", err
+			}
+			return filePath, nil
+		})
+		tailer.checkpoints = t.checkpoints
+		tailer.startAtEnd = startAtEnd
+		t.files[path] = &followedFile{
+			tailer:    tailer,
+			multiline: t.processor.newMultiline(),
+		}
+	}
+}
+
+// poll reads the new lines of all files and saves the checkpoints
+func (t *fileFollower) poll() {
+	t.scan(false)
+	for path, one := range t.files {
+		lines, err := one.tailer.poll()
+		now := time.Now()
+		for _, line := range lines {
+			t.appendLogs(path, one.multiline.add(now.UTC().Format(time.RFC3339Nano)+" "+line, now))
+		}
+		t.appendLogs(path, one.multiline.flush(now, os.IsNotExist(err)))
+		if os.IsNotExist(err) {
+			t.checkpoints.Remove(one.tailer.id)
+			delete(t.files, path)
+			continue
+		}
+		if err != nil {
+			t.processor.logs.Errorw("Error Read logfile:"+err.Error(), "file", path)
+		}
+	}
+	if err := t.checkpoints.Save(); err != nil {
+		t.processor.logs.Errorw("Error by saving file checkpoints:" + err.Error())
+	}
+}
+
+func (t *fileFollower) appendLogs(path string, lines []string) {
+	tracks := t.processor.processAll(lines)
+	if len(tracks) == 0 {
+		return
+	}
+	for i, one := range tracks {
+		tracks[i] = withField(one, FileSourceField, t.sourcePath(path))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logs = append(t.logs, tracks...)
+}
+
+// takeLogs returns the loglines since last call
+func (t *fileFollower) takeLogs() []TrackerLogs {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := t.logs
+	t.logs = make([]TrackerLogs, 0)
+	return res
+}
+
+// withField set key to value inside the json logline
+func withField(track TrackerLogs, key, value string) TrackerLogs {
+	d := json.NewDecoder(strings.NewReader(string(track)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil || values == nil {
+		return track
+	}
+	values[key] = value
+	res, err := json.Marshal(values)
+	if err != nil {
+		return track
+	}
+	return TrackerLogs(res)
+}
+
+// FileTracker tracks the logs of the files of a FileInput
+type FileTracker struct {
+	*fileFollower
+	container types.Container
+	interval  time.Duration
+}
+
+// NewFileTracker starts to follow the files of input. Files existing at start without checkpoint are read from their end
+func NewFileTracker(input FileInput, index int, checkpoints *Checkpoints, opts Options) *FileTracker {
+	res := newFileTracker(input, index, checkpoints, opts)
+	go res.run(res.interval, nil)
+	return res
+}
+
+func newFileTracker(input FileInput, index int, checkpoints *Checkpoints, opts Options) *FileTracker {
+	container := input.Container(index)
+	return &FileTracker{
+		fileFollower: newFileFollower(input, newLogProcessor(container, opts), checkpoints),
+		container:    container,
+		interval:     time.Second,
+	}
+}
+
+func (t *FileTracker) SearchIndex() string {
+	return searchIndex(t.container)
+}
+
+// GetStats returns empty stats, files have no stats information
+func (t *FileTracker) GetStats() Stats {
+	return Stats{}
+}
+
+// GetCumulateStats returns empty stats
+func (t *FileTracker) GetCumulateStats() CumulateStats {
+	return CumulateStats{}
+}
+
+func (t *FileTracker) GetLogs() []TrackerLogs {
+	return t.takeLogs()
+}
+
+func (t *FileTracker) GetContainer() types.Container {
+	return t.container
+}
+
+// SetContainer does nothing, the container of a file input never changes
+func (t *FileTracker) SetContainer(con types.Container) {
+}
+
+func (t *FileTracker) GetStaticContent() string {
+	return t.container.Labels["funk.log.staticcontent"]
+}
+
+// GetFilterCounter returns the count of filtered logs since last call
+func (t *FileTracker) GetFilterCounter() FilterCounter {
+	return t.processor.filter.Counter()
+}
+
+// GetInspect returns nil, files have no container inspect
+func (t *FileTracker) GetInspect() *types.ContainerJSON {
+	return nil
+}
+
+// StartFileInputs creates a FileTracker for each input
+func StartFileInputs(inputs []FileInput, checkpoints *Checkpoints, opts Options) []*FileTracker {
+	var res []*FileTracker
+	for i, one := range inputs {
+		tracker := NewFileTracker(one, i, checkpoints, opts)
+		logger.Get().Infow("Follow files", "paths", one.Paths, "searchindex", tracker.SearchIndex())
+		res = append(res, tracker)
+	}
+	return res
+}
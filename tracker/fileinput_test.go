@@ -0,0 +1,114 @@
+package tracker
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestFileInput_Container(t *testing.T) {
+	input := FileInput{
+		Paths:         []string{"/var/log/nginx/*.log"},
+		SearchIndex:   "nginx",
+		StaticContent: json.RawMessage(`{"stage":"dev"}`),
+		FormatRegex:   "(?P<message>.*)",
+		Labels: map[string]string{
+			"funk.log.minlevel": "warn",
+		},
+	}
+	want := types.Container{
+		ID:    "file:1",
+		Names: []string{"/file:/var/log/nginx/*.log"},
+		Labels: map[string]string{
+			"funk.searchindex":       "nginx",
+			"funk.log.staticcontent": `{"stage":"dev"}`,
+			"funk.log.formatRegex":   "(?P<message>.*)",
+			"funk.log.minlevel":      "warn",
+			"funk.log.stats":         "false",
+		},
+	}
+	if got := input.Container(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("FileInput.Container() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadFileInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funk_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "inputs.json")
+	if err := ioutil.WriteFile(config, []byte(`[{"paths": ["/var/log/syslog"], "searchindex": "host", "exclude": ["*.1"]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadFileInputs(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileInput{{Paths: []string{"/var/log/syslog"}, SearchIndex: "host", Exclude: []string{"*.1"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadFileInputs() = %v, want %v", got, want)
+	}
+}
+
+func TestFileTracker_poll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funk_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "existing.log")
+	appendFile(t, existing, "{\"before\":\"start\"}\n")
+	compressed, err := os.Create(filepath.Join(dir, "rotated.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(compressed)
+	gz.Write([]byte("{\"compressed\":true}\n"))
+	gz.Close()
+	compressed.Close()
+
+	tr := newFileTracker(FileInput{
+		Paths:     []string{filepath.Join(dir, "*.log")},
+		Exclude:   []string{"skip.log"},
+		Multiline: `^\{`,
+	}, 0, LoadCheckpoints(filepath.Join(dir, "checkpoints.json")), Options{})
+	tr.scan(true)
+	tr.poll()
+
+	created := filepath.Join(dir, "created.log")
+	appendFile(t, existing, "{\"after\":\n\"start\"}\n")
+	appendFile(t, created, "{\"new\":true}\n")
+	appendFile(t, filepath.Join(dir, "skip.log"), "{\"skip\":true}\n")
+	tr.poll()
+	tr.poll()
+	for _, one := range tr.files {
+		one.multiline.last = time.Time{}
+	}
+	tr.poll()
+
+	want := map[TrackerLogs]bool{
+		TrackerLogs(`{"log.file.path":"` + created + `","new":true}`):       true,
+		TrackerLogs(`{"after":"start","log.file.path":"` + existing + `"}`): true,
+	}
+	got := tr.GetLogs()
+	if len(got) != len(want) {
+		t.Fatalf("FileTracker.GetLogs() = %v, want %v", got, want)
+	}
+	for _, one := range got {
+		if !want[one] {
+			t.Errorf("FileTracker.GetLogs() unexpected logline %v, want %v", one, want)
+		}
+	}
+	if _, exist := tr.checkpoints.Get(tr.files[existing].tailer.id); !exist {
+		t.Errorf("no checkpoint for %v", existing)
+	}
+}
@@ -0,0 +1,299 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fasibio/funk_agent/jsonpath"
+)
+
+// FilterCounter counts the loglines which are not send to the server
+type FilterCounter struct {
+	DroppedByKeep   int64 `json:"dropped_by_keep"`
+	DroppedByDrop   int64 `json:"dropped_by_drop"`
+	DroppedBySample int64 `json:"dropped_by_sample"`
+	DroppedByLevel  int64 `json:"dropped_by_level"`
+}
+
+// Total returns the sum of all dropped lines
+func (f FilterCounter) Total() int64 {
+	return f.DroppedByKeep + f.DroppedByDrop + f.DroppedBySample + f.DroppedByLevel
+}
+
+type filterOperator string
+
+const (
+	filterOperatorEqual       filterOperator = "="
+	filterOperatorNotEqual    filterOperator = "!="
+	filterOperatorMatch       filterOperator = "=~"
+	filterOperatorNotMatch    filterOperator = "!~"
+	filterExpressionSeparator                = ";"
+
+	// maxSampleKeys is the count of 1-in-N@path keys, the sequences start again if more keys are seen
+	maxSampleKeys = 10000
+)
+
+// FilterExpression is one condition like status=200 or message=~^GET /health
+type FilterExpression struct {
+	Field    string
+	Operator filterOperator
+	Value    string
+	pattern  *regexp.Regexp
+}
+
+// ParseFilterExpressions parse a label value of funk.log.drop or funk.log.keep.
+// Expressions are separated by ; and one of them have to match.
+func ParseFilterExpressions(value string) ([]FilterExpression, error) {
+	var res []FilterExpression
+	for _, one := range strings.Split(value, filterExpressionSeparator) {
+		one = strings.TrimSpace(one)
+		if one == "" {
+			continue
+		}
+		exp, err := parseFilterExpression(one)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, exp)
+	}
+	return res, nil
+}
+
+func parseFilterExpression(value string) (FilterExpression, error) {
+	for i := 0; i < len(value); i++ {
+		var op filterOperator
+		switch {
+		case strings.HasPrefix(value[i:], string(filterOperatorNotEqual)):
+			op = filterOperatorNotEqual
+		case strings.HasPrefix(value[i:], string(filterOperatorNotMatch)):
+			op = filterOperatorNotMatch
+		case strings.HasPrefix(value[i:], string(filterOperatorMatch)):
+			op = filterOperatorMatch
+		case strings.HasPrefix(value[i:], string(filterOperatorEqual)):
+			op = filterOperatorEqual
+		default:
+			continue
+		}
+		exp := FilterExpression{
+			Field:    strings.TrimSpace(value[:i]),
+			Operator: op,
+			Value:    strings.TrimSpace(value[i+len(op):]),
+		}
+		if exp.Field == "" {
+			return exp, errors.New("Filterexpression without field: " + value)
+		}
+		if op == filterOperatorMatch || op == filterOperatorNotMatch {
+			pattern, err := regexp.Compile(exp.Value)
+			if err != nil {
+				return exp, errors.New("Error by Parsing Filterexpression " + value + ": " + err.Error())
+			}
+			exp.pattern = pattern
+		}
+		return exp, nil
+	}
+	return FilterExpression{}, errors.New("Filterexpression without operator: " + value)
+}
+
+// Matches check the expression against a parsed logline
+func (f FilterExpression) Matches(line map[string]interface{}) bool {
+	value, found := jsonpath.Get(line, f.Field)
+	str := ""
+	if found {
+		str = fieldToString(value)
+	}
+	switch f.Operator {
+	case filterOperatorEqual:
+		return found && str == f.Value
+	case filterOperatorNotEqual:
+		return !found || str != f.Value
+	case filterOperatorMatch:
+		return found && f.pattern.MatchString(str)
+	case filterOperatorNotMatch:
+		return !found || !f.pattern.MatchString(str)
+	}
+	return false
+}
+
+// DecodeLogline parses a json logline for the filters. Numbers are kept as json.Number,
+// so big integers like ids or nanosecond timestamps are compared exactly
+func DecodeLogline(line string) (map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader([]byte(line)))
+	d.UseNumber()
+	var values map[string]interface{}
+	err := d.Decode(&values)
+	return values, err
+}
+
+func fieldToString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+func matchesOne(expressions []FilterExpression, line map[string]interface{}) bool {
+	for _, one := range expressions {
+		if one.Matches(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sampler describe funk.log.sample. Rate is used for probabilistic sampling (0.1 keeps 10%)
+// Every is used for 1-in-N sampling (1/10 keeps every tenth line per key)
+type Sampler struct {
+	Rate  float64
+	Every int64
+	Key   string
+}
+
+// ParseSampler parse a label value of funk.log.sample like 0.1, 1/10 or 1/10@path
+func ParseSampler(value string) (*Sampler, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	res := Sampler{}
+	if parts := strings.SplitN(value, "@", 2); len(parts) == 2 {
+		value = strings.TrimSpace(parts[0])
+		res.Key = strings.TrimSpace(parts[1])
+	}
+	if parts := strings.SplitN(value, "/", 2); len(parts) == 2 {
+		if strings.TrimSpace(parts[0]) != "1" {
+			return nil, errors.New("Sample have to look like 1/N: " + value)
+		}
+		every, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || every < 1 {
+			return nil, errors.New("Sample have to look like 1/N: " + value)
+		}
+		res.Every = every
+		return &res, nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return nil, errors.New("Samplerate have to be between 0 and 1: " + value)
+	}
+	res.Rate = rate
+	return &res, nil
+}
+
+// LogFilter decide which loglines of a container will be send to the server
+// It is configured by the labels funk.log.drop, funk.log.keep and funk.log.sample
+type LogFilter struct {
+	Keep    []FilterExpression
+	Drop    []FilterExpression
+	Sample  *Sampler
+	random  func() float64
+	mu      sync.Mutex
+	seen    map[string]int64
+	counter FilterCounter
+}
+
+// NewLogFilter creates a LogFilter by the given containerlabels.
+// Without filter labels set it allows all lines
+func NewLogFilter(labels map[string]string) (*LogFilter, error) {
+	keep, err := ParseFilterExpressions(labels["funk.log.keep"])
+	if err != nil {
+		return nil, err
+	}
+	drop, err := ParseFilterExpressions(labels["funk.log.drop"])
+	if err != nil {
+		return nil, err
+	}
+	sample, err := ParseSampler(labels["funk.log.sample"])
+	if err != nil {
+		return nil, err
+	}
+	return &LogFilter{
+		Keep:   keep,
+		Drop:   drop,
+		Sample: sample,
+		random: rand.Float64,
+		seen:   make(map[string]int64),
+	}, nil
+}
+
+// Allow returns true if the logline have to be send
+func (f *LogFilter) Allow(line TrackerLogs) bool {
+	if f == nil || (len(f.Keep) == 0 && len(f.Drop) == 0 && f.Sample == nil) {
+		return true
+	}
+	values, _ := DecodeLogline(string(line))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Keep) != 0 && !matchesOne(f.Keep, values) {
+		f.counter.DroppedByKeep++
+		return false
+	}
+	if matchesOne(f.Drop, values) {
+		f.counter.DroppedByDrop++
+		return false
+	}
+	if !f.sample(values) {
+		f.counter.DroppedBySample++
+		return false
+	}
+	return true
+}
+
+func (f *LogFilter) countLevel() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counter.DroppedByLevel++
+}
+
+func (f *LogFilter) sample(values map[string]interface{}) bool {
+	if f.Sample == nil {
+		return true
+	}
+	if f.Sample.Every == 0 {
+		return f.random() < f.Sample.Rate
+	}
+	key := ""
+	if f.Sample.Key != "" {
+		value, _ := jsonpath.Get(values, f.Sample.Key)
+		key = fieldToString(value)
+	}
+	count, exist := f.seen[key]
+	if !exist && len(f.seen) >= maxSampleKeys {
+		f.seen = make(map[string]int64)
+	}
+	f.seen[key] = count + 1
+	return count%f.Sample.Every == 0
+}
+
+// Counter returns the current counter and reset them.
+// The 1-in-N sample sequences go on, so keys with few lines are not always kept as the first of N
+func (f *LogFilter) Counter() FilterCounter {
+	if f == nil {
+		return FilterCounter{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := f.counter
+	f.counter = FilterCounter{}
+	return res
+}
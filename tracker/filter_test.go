@@ -0,0 +1,177 @@
+package tracker
+
+import (
+	"testing"
+)
+
+func TestLogFilter_Allow(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		lines       []TrackerLogs
+		wantAllowed int
+		wantCounter FilterCounter
+	}{
+		{
+			name:        "No filter labels so all lines will be allowed",
+			labels:      map[string]string{},
+			lines:       []TrackerLogs{`{"path":"/health"}`, `{"path":"/api"}`},
+			wantAllowed: 2,
+		},
+		{
+			name: "Drop lines where field is equal",
+			labels: map[string]string{
+				"funk.log.drop": "path=/health",
+			},
+			lines:       []TrackerLogs{`{"path":"/health"}`, `{"path":"/api"}`, `{"path":"/health"}`},
+			wantAllowed: 1,
+			wantCounter: FilterCounter{DroppedByDrop: 2},
+		},
+		{
+			name: "Drop lines where nested field or message matches regex",
+			labels: map[string]string{
+				"funk.log.drop": ".request.path=/health; message=~^GET /metrics",
+			},
+			lines: []TrackerLogs{
+				`{"request":{"path":"/health"}}`,
+				`{"message":"GET /metrics 200"}`,
+				`{"message":"POST /metrics 200"}`,
+			},
+			wantAllowed: 1,
+			wantCounter: FilterCounter{DroppedByDrop: 2},
+		},
+		{
+			name: "Keep only lines matching one expression",
+			labels: map[string]string{
+				"funk.log.keep": "status=~^5;level=error",
+			},
+			lines: []TrackerLogs{
+				`{"status":500}`,
+				`{"status":200}`,
+				`{"level":"error"}`,
+				`{"message":"plain text"}`,
+			},
+			wantAllowed: 2,
+			wantCounter: FilterCounter{DroppedByKeep: 2},
+		},
+		{
+			name: "Big integers are compared exactly",
+			labels: map[string]string{
+				"funk.log.drop": "id=9007199254740993",
+			},
+			lines: []TrackerLogs{
+				`{"id":9007199254740993}`,
+				`{"id":9007199254740992}`,
+			},
+			wantAllowed: 1,
+			wantCounter: FilterCounter{DroppedByDrop: 1},
+		},
+		{
+			name: "1 in N sampling per key",
+			labels: map[string]string{
+				"funk.log.sample": "1/2@path",
+			},
+			lines: []TrackerLogs{
+				`{"path":"/a"}`,
+				`{"path":"/a"}`,
+				`{"path":"/a"}`,
+				`{"path":"/b"}`,
+			},
+			wantAllowed: 3,
+			wantCounter: FilterCounter{DroppedBySample: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewLogFilter(tt.labels)
+			if err != nil {
+				t.Fatalf("NewLogFilter() error = %v", err)
+			}
+			allowed := 0
+			for _, one := range tt.lines {
+				if f.Allow(one) {
+					allowed++
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("LogFilter.Allow() allowed %v lines, want %v", allowed, tt.wantAllowed)
+			}
+			if got := f.Counter(); got != tt.wantCounter {
+				t.Errorf("LogFilter.Counter() = %v, want %v", got, tt.wantCounter)
+			}
+			if got := f.Counter(); got.Total() != 0 {
+				t.Errorf("LogFilter.Counter() is not reseted got %v", got)
+			}
+		})
+	}
+}
+
+func TestLogFilter_SampleGoesOnAfterCounter(t *testing.T) {
+	f, err := NewLogFilter(map[string]string{"funk.log.sample": "1/3@path"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := 0
+	for i := 0; i < 6; i++ {
+		if f.Allow(`{"path":"/rare"}`) {
+			allowed++
+		}
+		f.Counter()
+	}
+	if allowed != 2 {
+		t.Errorf("LogFilter.Allow() allowed %v of 6 lines with a report after each line, want 2", allowed)
+	}
+}
+
+func TestLogFilter_ProbabilisticSample(t *testing.T) {
+	f, err := NewLogFilter(map[string]string{"funk.log.sample": "0.5"})
+	if err != nil {
+		t.Fatalf("NewLogFilter() error = %v", err)
+	}
+	randoms := []float64{0.1, 0.7, 0.4, 0.9}
+	f.random = func() float64 {
+		res := randoms[0]
+		randoms = randoms[1:]
+		return res
+	}
+	allowed := 0
+	for i := 0; i < 4; i++ {
+		if f.Allow(`{"mock":true}`) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("LogFilter.Allow() allowed %v lines, want 2", allowed)
+	}
+}
+
+func TestNewLogFilter_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{
+			name:   "Expression without operator",
+			labels: map[string]string{"funk.log.drop": "path"},
+		},
+		{
+			name:   "Expression with invalid regex",
+			labels: map[string]string{"funk.log.keep": "message=~(("},
+		},
+		{
+			name:   "Samplerate bigger than 1",
+			labels: map[string]string{"funk.log.sample": "2"},
+		},
+		{
+			name:   "Sample not 1/N",
+			labels: map[string]string{"funk.log.sample": "2/10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLogFilter(tt.labels); err == nil {
+				t.Errorf("NewLogFilter() want error got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// LogLevel is the canonical level of a logline
+type LogLevel int
+
+const (
+	// LogLevelUnknown the logline has no level or it could not be parsed
+	LogLevelUnknown LogLevel = iota
+	// LogLevelTrace trace
+	LogLevelTrace
+	// LogLevelDebug debug
+	LogLevelDebug
+	// LogLevelInfo info
+	LogLevelInfo
+	// LogLevelWarn warn
+	LogLevelWarn
+	// LogLevelError error
+	LogLevelError
+	// LogLevelFatal fatal
+	LogLevelFatal
+)
+
+// LevelField is the field where the normalised level will be written to
+const LevelField = "level"
+
+// LevelFieldAliases are the fields where frameworks write their level to. The first found wins
+var LevelFieldAliases = []string{"level", "lvl", "severity", "LogLevel", "loglevel", "log_level", "levelname", "log.level"}
+
+var levelNames = map[LogLevel]string{
+	LogLevelTrace: "trace",
+	LogLevelDebug: "debug",
+	LogLevelInfo:  "info",
+	LogLevelWarn:  "warn",
+	LogLevelError: "error",
+	LogLevelFatal: "fatal",
+}
+
+var levelsByName = map[string]LogLevel{
+	"trace":         LogLevelTrace,
+	"trc":           LogLevelTrace,
+	"t":             LogLevelTrace,
+	"verbose":       LogLevelTrace,
+	"finest":        LogLevelTrace,
+	"debug":         LogLevelDebug,
+	"dbg":           LogLevelDebug,
+	"d":             LogLevelDebug,
+	"fine":          LogLevelDebug,
+	"info":          LogLevelInfo,
+	"inf":           LogLevelInfo,
+	"i":             LogLevelInfo,
+	"information":   LogLevelInfo,
+	"informational": LogLevelInfo,
+	"notice":        LogLevelInfo,
+	"warn":          LogLevelWarn,
+	"warning":       LogLevelWarn,
+	"wrn":           LogLevelWarn,
+	"w":             LogLevelWarn,
+	"error":         LogLevelError,
+	"err":           LogLevelError,
+	"e":             LogLevelError,
+	"severe":        LogLevelError,
+	"fatal":         LogLevelFatal,
+	"f":             LogLevelFatal,
+	"crit":          LogLevelFatal,
+	"critical":      LogLevelFatal,
+	"c":             LogLevelFatal,
+	"alert":         LogLevelFatal,
+	"emerg":         LogLevelFatal,
+	"emergency":     LogLevelFatal,
+	"panic":         LogLevelFatal,
+	"dpanic":        LogLevelFatal,
+}
+
+func (l LogLevel) String() string {
+	return levelNames[l]
+}
+
+// ParseLogLevel normalise a level value like WARN, warning, W or 30 to a LogLevel
+func ParseLogLevel(value interface{}) LogLevel {
+	switch v := value.(type) {
+	case string:
+		name := strings.ToLower(strings.TrimSpace(v))
+		if level, exist := levelsByName[name]; exist {
+			return level
+		}
+		if number, err := strconv.ParseFloat(name, 64); err == nil {
+			return levelByNumber(number)
+		}
+	case float64:
+		return levelByNumber(v)
+	case json.Number:
+		if number, err := v.Float64(); err == nil {
+			return levelByNumber(number)
+		}
+	}
+	return LogLevelUnknown
+}
+
+// levelByNumber use syslog severity for values lower than 10 (0 emergency ... 7 debug)
+// and the bunyan/pino levels (10 trace ... 60 fatal) for the others
+func levelByNumber(number float64) LogLevel {
+	if number < 0 {
+		return LogLevelUnknown
+	}
+	if number < 10 {
+		switch {
+		case number <= 2:
+			return LogLevelFatal
+		case number <= 3:
+			return LogLevelError
+		case number <= 4:
+			return LogLevelWarn
+		case number <= 6:
+			return LogLevelInfo
+		}
+		return LogLevelDebug
+	}
+	switch {
+	case number < 20:
+		return LogLevelTrace
+	case number < 30:
+		return LogLevelDebug
+	case number < 40:
+		return LogLevelInfo
+	case number < 50:
+		return LogLevelWarn
+	case number < 60:
+		return LogLevelError
+	}
+	return LogLevelFatal
+}
+
+// NormaliseLevel looks for a level inside the logline and writes the canonical
+// level to field level. Lines without a parsable level will be returned unchanged.
+// Numbers are kept as they are, so big ids like trace ids are not rounded
+func NormaliseLevel(line TrackerLogs) (TrackerLogs, LogLevel) {
+	d := json.NewDecoder(bytes.NewReader([]byte(line)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil {
+		return line, LogLevelUnknown
+	}
+	for _, field := range LevelFieldAliases {
+		value, exist := values[field]
+		if !exist {
+			continue
+		}
+		level := ParseLogLevel(value)
+		if level == LogLevelUnknown {
+			continue
+		}
+		if values[LevelField] == level.String() {
+			return line, level
+		}
+		values[LevelField] = level.String()
+		res, err := json.Marshal(values)
+		if err != nil {
+			return line, level
+		}
+		return TrackerLogs(res), level
+	}
+	return line, LogLevelUnknown
+}
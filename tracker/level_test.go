@@ -0,0 +1,93 @@
+package tracker
+
+import (
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  LogLevel
+	}{
+		{name: "uppercase name", value: "WARN", want: LogLevelWarn},
+		{name: "long name", value: "warning", want: LogLevelWarn},
+		{name: "single letter", value: "W", want: LogLevelWarn},
+		{name: "pino number", value: float64(30), want: LogLevelInfo},
+		{name: "pino number as string", value: "50", want: LogLevelError},
+		{name: "syslog severity", value: float64(7), want: LogLevelDebug},
+		{name: "critical", value: "CRITICAL", want: LogLevelFatal},
+		{name: "unknown name", value: "something", want: LogLevelUnknown},
+		{name: "no string or number", value: true, want: LogLevelUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseLogLevel(tt.value); got != tt.want {
+				t.Errorf("ParseLogLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormaliseLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      TrackerLogs
+		want      TrackerLogs
+		wantLevel LogLevel
+	}{
+		{
+			name:      "level is already normalised so line is unchanged",
+			line:      `{"level": "info", "msg": "mock"}`,
+			want:      `{"level": "info", "msg": "mock"}`,
+			wantLevel: LogLevelInfo,
+		},
+		{
+			name:      "level will be normalised",
+			line:      `{"level":"WARNING"}`,
+			want:      `{"level":"warn"}`,
+			wantLevel: LogLevelWarn,
+		},
+		{
+			name:      "alias will be written to level",
+			line:      `{"severity":"E"}`,
+			want:      `{"level":"error","severity":"E"}`,
+			wantLevel: LogLevelError,
+		},
+		{
+			name:      "big integers are not rounded",
+			line:      `{"level":"INFO","dd.trace_id":1234567890123456789,"user_id":9007199254740993,"ratio":0.1}`,
+			want:      `{"dd.trace_id":1234567890123456789,"level":"info","ratio":0.1,"user_id":9007199254740993}`,
+			wantLevel: LogLevelInfo,
+		},
+		{
+			name:      "numeric LogLevel",
+			line:      `{"LogLevel":20}`,
+			want:      `{"LogLevel":20,"level":"debug"}`,
+			wantLevel: LogLevelDebug,
+		},
+		{
+			name:      "no level found",
+			line:      `{"message":"mock"}`,
+			want:      `{"message":"mock"}`,
+			wantLevel: LogLevelUnknown,
+		},
+		{
+			name:      "not parsable level",
+			line:      `{"level":"mock"}`,
+			want:      `{"level":"mock"}`,
+			wantLevel: LogLevelUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, level := NormaliseLevel(tt.line)
+			if got != tt.want {
+				t.Errorf("NormaliseLevel() = %v, want %v", got, tt.want)
+			}
+			if level != tt.wantLevel {
+				t.Errorf("NormaliseLevel() level = %v, want %v", level, tt.wantLevel)
+			}
+		})
+	}
+}
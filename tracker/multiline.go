@@ -0,0 +1,65 @@
+package tracker
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// multilineTimeout is the time a multiline entry waits for more lines before it is send
+	multilineTimeout = time.Second
+	// maxMultilineLines is the maximum count of lines joined to one entry
+	maxMultilineLines = 500
+)
+
+// multilineJoiner joins the lines of one source which belong together (like stacktraces).
+// A new entry starts with a line matching the regex of label funk.log.multiline, all other lines are added to the entry before.
+// The lines start with their timestamp, the regex is checked against the text behind it.
+// A nil multilineJoiner returns each line as it is
+type multilineJoiner struct {
+	start   *regexp.Regexp
+	pending string
+	lines   int
+	last    time.Time
+}
+
+func newMultilineJoiner(start *regexp.Regexp) *multilineJoiner {
+	if start == nil {
+		return nil
+	}
+	return &multilineJoiner{start: start}
+}
+
+// add returns the entries which are complete by line
+func (m *multilineJoiner) add(line string, now time.Time) []string {
+	line = strings.TrimRight(line, "\r\n")
+	if m == nil {
+		return []string{line}
+	}
+	content := line
+	if parts := strings.SplitN(line, " ", 2); len(parts) == 2 {
+		content = parts[1]
+	}
+	m.last = now
+	if m.pending != "" && !m.start.MatchString(content) && m.lines < maxMultilineLines {
+		m.pending += "\n" + content
+		m.lines++
+		return nil
+	}
+	res := m.flush(now, true)
+	m.pending = line
+	m.lines = 1
+	return res
+}
+
+// flush returns the pending entry if no line is added since multilineTimeout or force is set
+func (m *multilineJoiner) flush(now time.Time, force bool) []string {
+	if m == nil || m.pending == "" || (!force && now.Sub(m.last) < multilineTimeout) {
+		return nil
+	}
+	res := m.pending
+	m.pending = ""
+	m.lines = 0
+	return []string{res}
+}
@@ -0,0 +1,149 @@
+package tracker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Sender is the system which pushed the loglines
+type Sender struct {
+	Host string // Host is the hostname written by the sender
+	IP   string // IP is the address the loglines are received from
+}
+
+// PushTracker tracks the loglines pushed by a network input (like fluentd forward, syslog or gelf)
+type PushTracker struct {
+	container types.Container
+	processor *logProcessor
+	sender    Sender
+	logs      []TrackerLogs
+	lastPush  time.Time
+	multiline map[string]*multilineJoiner // multiline joins the lines of each stream with label funk.log.multiline
+	flushing  bool                        // flushing is true while a flush of the pending multiline entries is planned
+	mu        sync.Mutex
+}
+
+// NewPushTracker creates a PushTracker for the loglines of container.
+// The loglines take the same way as the container logs so all labels (funk.log.formatRegex, funk.log.minlevel, ...) are used
+func NewPushTracker(container types.Container, opts Options) *PushTracker {
+	return &PushTracker{
+		container: container,
+		processor: newLogProcessor(container, opts),
+		multiline: make(map[string]*multilineJoiner),
+	}
+}
+
+// Push process a logline of stream (like stdout or stderr) written at time at.
+// Lines of one stream are joined with label funk.log.multiline, an entry is send after multilineTimeout without more lines
+func (t *PushTracker) Push(at time.Time, stream, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.lastPush = now
+	joiner, exist := t.multiline[stream]
+	if !exist {
+		joiner = t.processor.newMultiline()
+		t.multiline[stream] = joiner
+	}
+	t.logs = append(t.logs, t.processor.processAll(joiner.add(at.UTC().Format(time.RFC3339Nano)+" "+line, now))...)
+	if joiner != nil && !t.flushing {
+		t.flushing = true
+		time.AfterFunc(multilineTimeout, t.flushPending)
+	}
+}
+
+// flushPending sends the multiline entries without lines since multilineTimeout and plans the next flush while entries are pending
+func (t *PushTracker) flushPending() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushMultiline(time.Now(), false)
+	t.flushing = false
+	for _, one := range t.multiline {
+		if one != nil && one.pending != "" {
+			t.flushing = true
+			time.AfterFunc(multilineTimeout, t.flushPending)
+			return
+		}
+	}
+}
+
+// Flush sends the pending multiline entries, like at the end of the container
+func (t *PushTracker) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushMultiline(time.Now(), true)
+}
+
+// flushMultiline the caller has to hold t.mu
+func (t *PushTracker) flushMultiline(now time.Time, force bool) {
+	for _, one := range t.multiline {
+		t.logs = append(t.logs, t.processor.processAll(one.flush(now, force))...)
+	}
+}
+
+// LastPush returns the time the last logline is pushed, zero if there was none
+func (t *PushTracker) LastPush() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastPush
+}
+
+// SetSender saves the system which pushed the last loglines
+func (t *PushTracker) SetSender(sender Sender) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sender = sender
+}
+
+// GetSender returns the system which pushed the last loglines
+func (t *PushTracker) GetSender() Sender {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sender
+}
+
+func (t *PushTracker) SearchIndex() string {
+	return searchIndex(t.container)
+}
+
+// GetStats returns empty stats, pushed logs have no stats information
+func (t *PushTracker) GetStats() Stats {
+	return Stats{}
+}
+
+// GetCumulateStats returns empty stats
+func (t *PushTracker) GetCumulateStats() CumulateStats {
+	return CumulateStats{}
+}
+
+func (t *PushTracker) GetLogs() []TrackerLogs {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := t.logs
+	t.logs = make([]TrackerLogs, 0)
+	return res
+}
+
+func (t *PushTracker) GetContainer() types.Container {
+	return t.container
+}
+
+func (t *PushTracker) SetContainer(con types.Container) {
+	t.container = con
+}
+
+func (t *PushTracker) GetStaticContent() string {
+	return t.container.Labels["funk.log.staticcontent"]
+}
+
+// GetFilterCounter returns the count of filtered logs since last call
+func (t *PushTracker) GetFilterCounter() FilterCounter {
+	return t.processor.filter.Counter()
+}
+
+// GetInspect returns nil, pushed logs have no container inspect
+func (t *PushTracker) GetInspect() *types.ContainerJSON {
+	return nil
+}
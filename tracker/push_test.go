@@ -0,0 +1,66 @@
+package tracker
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestPushTracker_Push(t *testing.T) {
+	tr := NewPushTracker(types.Container{
+		Names:  []string{"/pushed"},
+		Labels: map[string]string{"funk.log.minlevel": "info", "funk.searchindex": "pushed"},
+	}, Options{})
+	at := time.Date(2019, 8, 12, 12, 52, 7, 0, time.UTC)
+	if !tr.LastPush().IsZero() {
+		t.Errorf("PushTracker.LastPush() = %v before the first logline, want zero", tr.LastPush())
+	}
+	before := time.Now()
+	tr.Push(at, "stdout", `{"level":"debug"}`)
+	tr.Push(at, "stdout", `{"level":"error"}`)
+	tr.Push(at, "stderr", "plain text")
+	want := []TrackerLogs{`{"level":"error"}`, `{"message":"2019-08-12T12:52:07Z plain text"}`}
+	if got := tr.GetLogs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("PushTracker.GetLogs() = %v, want %v", got, want)
+	}
+	if got := tr.SearchIndex(); got != "pushed" {
+		t.Errorf("PushTracker.SearchIndex() = %v, want pushed", got)
+	}
+	if got := tr.GetFilterCounter().DroppedByLevel; got != 1 {
+		t.Errorf("PushTracker.GetFilterCounter().DroppedByLevel = %v, want 1", got)
+	}
+	if got := tr.LastPush(); got.Before(before) {
+		t.Errorf("PushTracker.LastPush() = %v, want the time of the last push", got)
+	}
+}
+
+func TestPushTracker_PushMultiline(t *testing.T) {
+	tr := NewPushTracker(types.Container{
+		Names:  []string{"/pushed"},
+		Labels: map[string]string{"funk.log.multiline": "^\\S"},
+	}, Options{})
+	at := time.Date(2019, 8, 12, 12, 52, 7, 0, time.UTC)
+	tr.Push(at, "stderr", "panic: boom")
+	tr.Push(at, "stdout", "started")
+	tr.Push(at, "stderr", "\tat main.go:12")
+	tr.Push(at, "stdout", "ready")
+	want := []TrackerLogs{`{"message":"2019-08-12T12:52:07Z started"}`}
+	if got := tr.GetLogs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("PushTracker.GetLogs() = %v, want the first complete entry of stdout", got)
+	}
+	time.Sleep(multilineTimeout + 200*time.Millisecond)
+	got := tr.GetLogs()
+	want = []TrackerLogs{`{"message":"2019-08-12T12:52:07Z panic: boom\n\tat main.go:12"}`, `{"message":"2019-08-12T12:52:07Z ready"}`}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PushTracker.GetLogs() after multilineTimeout = %v, want %v", got, want)
+	}
+	tr.Push(at, "stdout", "last")
+	tr.Flush()
+	if got := tr.GetLogs(); len(got) != 1 {
+		t.Errorf("PushTracker.GetLogs() after Flush() = %v, want the pending entry", got)
+	}
+}
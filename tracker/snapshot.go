@@ -0,0 +1,83 @@
+package tracker
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Top are the processes running inside the container like docker top shows them
+type Top struct {
+	ProcessCount int                 `json:"process_count"`
+	Processes    []map[string]string `json:"processes"` // Processes by the lowercase titles of ps like pid, ppid, uid, cmd
+}
+
+// Size is the disk usage of the container
+type Size struct {
+	SizeRwMb     float64 `json:"size_rw_mb"`      // SizeRwMb is the size of the writable layer
+	SizeRootFsMb float64 `json:"size_root_fs_mb"` // SizeRootFsMb is the size of all layers of the container
+}
+
+// Snapshotter is a TrackElement which can take snapshots of the processes (label funk.log.top) and the disk usage (label funk.log.size) of its container.
+// The caller gives the id of the container, so the snapshot can be taken without the lock of the trackers
+type Snapshotter interface {
+	GetTop(containerID string) (*Top, error)
+	GetSize(containerID string) (*Size, error)
+}
+
+// WantsTop returns if label funk.log.top is set to true
+func WantsTop(container types.Container) bool {
+	return container.Labels["funk.log.top"] == "true"
+}
+
+// WantsSize returns if label funk.log.size is set to true
+func WantsSize(container types.Container) bool {
+	return container.Labels["funk.log.size"] == "true"
+}
+
+// GetTop returns the processes of the container
+func (t *Tracker) GetTop(containerID string) (*Top, error) {
+	list, err := t.client.ContainerTop(t.ctx, containerID, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := topOf(list)
+	return &res, nil
+}
+
+func topOf(list types.ContainerProcessList) Top {
+	res := Top{
+		ProcessCount: len(list.Processes),
+		Processes:    make([]map[string]string, 0, len(list.Processes)),
+	}
+	for _, process := range list.Processes {
+		one := make(map[string]string)
+		for i, title := range list.Titles {
+			if i < len(process) {
+				one[strings.ToLower(title)] = process[i]
+			}
+		}
+		res.Processes = append(res.Processes, one)
+	}
+	return res
+}
+
+// GetSize returns the disk usage of the container. Docker has to calculate it, so it is slow for big containers
+func (t *Tracker) GetSize(containerID string) (*Size, error) {
+	inspect, _, err := t.client.ContainerInspectWithRaw(t.ctx, containerID, true)
+	if err != nil {
+		return nil, err
+	}
+	if inspect.SizeRw == nil && inspect.SizeRootFs == nil {
+		return nil, errors.New("docker has not send the size of the container")
+	}
+	var res Size
+	if inspect.SizeRw != nil {
+		res.SizeRwMb = float64(*inspect.SizeRw) / 1000000
+	}
+	if inspect.SizeRootFs != nil {
+		res.SizeRootFsMb = float64(*inspect.SizeRootFs) / 1000000
+	}
+	return &res, nil
+}
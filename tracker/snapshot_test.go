@@ -0,0 +1,63 @@
+package tracker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestTracker_GetTop(t *testing.T) {
+	tr := &Tracker{
+		ctx:       context.Background(),
+		container: types.Container{ID: "abc"},
+		client: &MockDockerClient{ResultTop: types.ContainerProcessList{
+			Titles:    []string{"UID", "PID", "CMD"},
+			Processes: [][]string{{"root", "1", "nginx: master"}, {"www", "7"}},
+		}},
+	}
+	got, err := tr.GetTop("abc")
+	if err != nil {
+		t.Fatalf("GetTop() error = %v", err)
+	}
+	want := &Top{
+		ProcessCount: 2,
+		Processes: []map[string]string{
+			{"uid": "root", "pid": "1", "cmd": "nginx: master"},
+			{"uid": "www", "pid": "7"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTop() = %v, want %v", got, want)
+	}
+}
+
+func TestTracker_GetSize(t *testing.T) {
+	sizeRw := int64(12500000)
+	tests := []struct {
+		name    string
+		sizeRw  *int64
+		want    *Size
+		wantErr bool
+	}{
+		{name: "size is send", sizeRw: &sizeRw, want: &Size{SizeRwMb: 12.5}},
+		{name: "no size", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Tracker{
+				ctx:       context.Background(),
+				container: types.Container{ID: "abc"},
+				client:    &MockDockerClient{ResultSizeRw: tt.sizeRw},
+			}
+			got, err := tr.GetSize("abc")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package tracker
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ContainerState is the health check and restart information of container inspect send with each stats
+type ContainerState struct {
+	Status              string `json:"state,omitempty"`         // Status is created, running, paused, restarting, removing, exited or dead
+	HealthStatus        string `json:"health_status,omitempty"` // HealthStatus is starting, healthy or unhealthy, empty without health check
+	HealthFailingStreak int    `json:"health_failing_streak"`   // HealthFailingStreak is the count of failed health checks in a row
+	HealthOutput        string `json:"health_output,omitempty"` // HealthOutput is the output of the last health check
+	HealthExitCode      int    `json:"health_exit_code"`        // HealthExitCode is the exit code of the last health check
+	RestartCount        int    `json:"restart_count"`           // RestartCount is the count of restarts by the restart policy
+	OOMKilled           bool   `json:"oom_killed"`              // OOMKilled is true if the last run was killed because it was out of memory
+	ExitCode            int    `json:"exit_code"`               // ExitCode is the exit code of the last run
+	FinishedAt          string `json:"finished_at,omitempty"`   // FinishedAt is the end of the last run
+}
+
+// StateOf returns the state of container inspect, nil if the inspect is not loaded
+func StateOf(inspect *types.ContainerJSON) *ContainerState {
+	if inspect == nil || inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return nil
+	}
+	res := &ContainerState{
+		Status:       inspect.State.Status,
+		RestartCount: inspect.RestartCount,
+		OOMKilled:    inspect.State.OOMKilled,
+		ExitCode:     inspect.State.ExitCode,
+	}
+	if inspect.State.FinishedAt != "" && !strings.HasPrefix(inspect.State.FinishedAt, "0001-01-01") {
+		res.FinishedAt = inspect.State.FinishedAt
+	}
+	if health := inspect.State.Health; health != nil {
+		res.HealthStatus = health.Status
+		res.HealthFailingStreak = health.FailingStreak
+		if len(health.Log) > 0 && health.Log[len(health.Log)-1] != nil {
+			last := health.Log[len(health.Log)-1]
+			res.HealthOutput = strings.TrimSpace(last.Output)
+			res.HealthExitCode = last.ExitCode
+		}
+	}
+	return res
+}
+
+// isStopped returns true if the container has ended and will not be restarted by docker
+func isStopped(inspect *types.ContainerJSON) bool {
+	if inspect == nil || inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return false
+	}
+	return !inspect.State.Running && !inspect.State.Restarting && !inspect.State.Paused
+}
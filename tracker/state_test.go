@@ -0,0 +1,99 @@
+package tracker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestStateOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		inspect *types.ContainerJSON
+		want    *ContainerState
+	}{
+		{name: "no inspect"},
+		{name: "no state", inspect: &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{}}},
+		{
+			name: "unhealthy and restarted",
+			inspect: &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+				RestartCount: 3,
+				State: &types.ContainerState{
+					Status:     "running",
+					Running:    true,
+					OOMKilled:  true,
+					ExitCode:   137,
+					FinishedAt: "2019-08-12T12:52:07.123Z",
+					Health: &types.Health{
+						Status:        "unhealthy",
+						FailingStreak: 2,
+						Log: []*types.HealthcheckResult{
+							{ExitCode: 0, Output: "ok"},
+							{ExitCode: 1, Output: "curl: (7) Failed to connect\n"},
+						},
+					},
+				},
+			}},
+			want: &ContainerState{
+				Status:              "running",
+				HealthStatus:        "unhealthy",
+				HealthFailingStreak: 2,
+				HealthOutput:        "curl: (7) Failed to connect",
+				HealthExitCode:      1,
+				RestartCount:        3,
+				OOMKilled:           true,
+				ExitCode:            137,
+				FinishedAt:          "2019-08-12T12:52:07.123Z",
+			},
+		},
+		{
+			name: "never finished without health check",
+			inspect: &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+				State: &types.ContainerState{Status: "running", FinishedAt: "0001-01-01T00:00:00Z"},
+			}},
+			want: &ContainerState{Status: "running"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StateOf(tt.inspect); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StateOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_watchState(t *testing.T) {
+	tr := &Tracker{
+		ctx:       context.Background(),
+		container: types.Container{ID: "abc", Names: []string{"/abc"}},
+		client:    &MockDockerClient{},
+	}
+	ticker := make(chan time.Time, 2)
+	ticker <- time.Now()
+	ticker <- time.Now()
+	done := make(chan bool)
+	go func() {
+		tr.watchState(ticker)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("watchState() has not ended for a stopped container")
+	}
+	if tr.GetInspect() == nil {
+		t.Errorf("watchState() has not inspected the container")
+	}
+	if len(ticker) != 1 {
+		t.Errorf("watchState() has inspected %v times, want 1", 2-len(ticker))
+	}
+	select {
+	case <-tr.getEnded():
+	default:
+		t.Errorf("watchState() has not ended the tracker of a stopped container")
+	}
+}
@@ -0,0 +1,292 @@
+package tracker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func (v *Stats) calculateCPUPercentUnix() float64 {
+	var (
+		cpuPercent = 0.0
+		// calculate the change for the cpu usage of the container in between readings
+		cpuDelta = float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PrecpuStats.CPUUsage.TotalUsage)
+		// calculate the change for the entire system between readings
+		systemDelta = float64(v.CPUStats.SystemCPUUsage) - float64(v.PrecpuStats.SystemCPUUsage)
+	)
+
+	// cgroup v2 has no usage per cpu, docker gives the count of cpus
+	cpus := float64(v.CPUStats.OnlineCpus)
+	if cpus == 0.0 {
+		cpus = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if systemDelta > 0.0 && cpuDelta > 0.0 {
+		cpuPercent = (cpuDelta / systemDelta) * cpus * 100.0
+	}
+	return cpuPercent
+}
+
+// throttledPercent returns the part of the cpu periods between the readings in which the container was throttled
+func (v *Stats) throttledPercent() float64 {
+	periods := v.CPUStats.ThrottlingData.Periods - v.PrecpuStats.ThrottlingData.Periods
+	throttled := v.CPUStats.ThrottlingData.ThrottledPeriods - v.PrecpuStats.ThrottlingData.ThrottledPeriods
+	if periods <= 0 || throttled < 0 {
+		return 0
+	}
+	return float64(throttled) / float64(periods) * 100
+}
+
+func percent(value, limit int64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return float64(value) / float64(limit) * 100
+}
+
+func CumulateStatsInfo(stats Stats) CumulateStats {
+	network := stats.Networks.Total()
+	res := CumulateStats{
+		RamUsageMb:           float64(stats.MemoryStats.Usage) / 1000000,
+		RamUsagePercent:      percent(stats.MemoryStats.Usage, stats.MemoryStats.Limit),
+		RamWorkingSetMb:      float64(stats.MemoryStats.WorkingSet()) / 1000000,
+		RamWorkingSetPercent: percent(stats.MemoryStats.WorkingSet(), stats.MemoryStats.Limit),
+		CPUUsagePercent:      stats.calculateCPUPercentUnix(),
+		CPUThrottledPeriods:  stats.CPUStats.ThrottlingData.ThrottledPeriods,
+		CPUThrottledTimeMs:   float64(stats.CPUStats.ThrottlingData.ThrottledTime) / 1000000,
+		CPUThrottledPercent:  stats.throttledPercent(),
+		RamLimitMb:           float64(stats.MemoryStats.Limit) / 1000000,
+		NetIOReceiveMb:       float64(network.RxBytes) / 1000000,
+		NetIOTransmitMb:      float64(network.TxBytes) / 1000000,
+		NetIOReceivePackets:  network.RxPackets,
+		NetIOTransmitPacket:  network.TxPackets,
+		NetIOErrors:          network.RxErrors + network.TxErrors,
+		NetIODropped:         network.RxDropped + network.TxDropped,
+		Networks:             stats.Networks,
+		BlockIO:              stats.BlkioStats.Devices(),
+		PidsCurrent:          stats.PidsStats.Current,
+		PidsLimit:            stats.PidsStats.Limit,
+	}
+	for _, one := range res.BlockIO {
+		res.BlockIOReadMb += float64(one.ReadBytes) / 1000000
+		res.BlockIOWriteMb += float64(one.WriteBytes) / 1000000
+		res.BlockIOReadOps += one.ReadOps
+		res.BlockIOWriteOps += one.WriteOps
+	}
+	return res
+}
+
+// CumulateStats is the short form of the stats (LOG_STATS cumulated)
+type CumulateStats struct {
+	CPUUsagePercent      float64       `json:"cpu_usage_percent"`
+	CPUThrottledPeriods  int64         `json:"cpu_throttled_periods"`
+	CPUThrottledTimeMs   float64       `json:"cpu_throttled_time_ms"`
+	CPUThrottledPercent  float64       `json:"cpu_throttled_percent"` // CPUThrottledPercent is the part of the periods since the last reading the container was throttled
+	RamUsagePercent      float64       `json:"ram_usage_percent"`
+	RamUsageMb           float64       `json:"ram_usage_mb"`            // RamUsageMb is the usage including the page cache
+	RamWorkingSetPercent float64       `json:"ram_working_set_percent"` // RamWorkingSetPercent is the working set of the limit
+	RamWorkingSetMb      float64       `json:"ram_working_set_mb"`      // RamWorkingSetMb is the usage without the inactive page cache like docker stats shows it
+	RamLimitMb           float64       `json:"ram_limit_mb"`
+	NetIOReceiveMb       float64       `json:"net_io_usage_mb"`
+	NetIOTransmitMb      float64       `json:"net_io_transmit_mb"`
+	NetIOReceivePackets  int64         `json:"net_io_receive_packets"`
+	NetIOTransmitPacket  int64         `json:"net_io_transmit_packets"`
+	NetIOErrors          int64         `json:"net_io_errors"`
+	NetIODropped         int64         `json:"net_io_dropped"`
+	Networks             Networks      `json:"networks,omitempty"`
+	BlockIOReadMb        float64       `json:"block_io_read_mb"`
+	BlockIOWriteMb       float64       `json:"block_io_write_mb"`
+	BlockIOReadOps       int64         `json:"block_io_read_ops"`
+	BlockIOWriteOps      int64         `json:"block_io_write_ops"`
+	BlockIO              []BlockDevice `json:"block_io,omitempty"`
+	PidsCurrent          int64         `json:"pids_current"`
+	PidsLimit            uint64        `json:"pids_limit,omitempty"`
+
+	// the rates and min, avg and max are taken of all samples since the last send stats
+	CPUUsageSecondsPerSecond float64 `json:"cpu_usage_seconds_per_second"` // CPUUsageSecondsPerSecond is the count of used cores
+	CPUUsagePercentMin       float64 `json:"cpu_usage_percent_min"`
+	CPUUsagePercentAvg       float64 `json:"cpu_usage_percent_avg"`
+	CPUUsagePercentMax       float64 `json:"cpu_usage_percent_max"`
+	RamUsageMbMin            float64 `json:"ram_usage_mb_min"`
+	RamUsageMbAvg            float64 `json:"ram_usage_mb_avg"`
+	RamUsageMbMax            float64 `json:"ram_usage_mb_max"`
+	RamWorkingSetMbMin       float64 `json:"ram_working_set_mb_min"`
+	RamWorkingSetMbAvg       float64 `json:"ram_working_set_mb_avg"`
+	RamWorkingSetMbMax       float64 `json:"ram_working_set_mb_max"`
+	NetIOReceiveMbPerSecond  float64 `json:"net_io_receive_mb_per_second"`
+	NetIOTransmitMbPerSecond float64 `json:"net_io_transmit_mb_per_second"`
+	BlockIOReadMbPerSecond   float64 `json:"block_io_read_mb_per_second"`
+	BlockIOWriteMbPerSecond  float64 `json:"block_io_write_mb_per_second"`
+	StatsSamples             int     `json:"stats_samples"`
+
+	*ContainerState // ContainerState is the health and restart information, set by the agent
+}
+
+type Stats struct {
+	Read         string       `json:"read"`
+	Preread      string       `json:"preread"`
+	PidsStats    PidsStats    `json:"pids_stats"`
+	BlkioStats   BlkioStats   `json:"blkio_stats"`
+	NumProcs     int64        `json:"num_procs"`
+	StorageStats StorageStats `json:"storage_stats"`
+	CPUStats     CPUStats     `json:"cpu_stats"`
+	PrecpuStats  CPUStats     `json:"precpu_stats"`
+	MemoryStats  MemoryStats  `json:"memory_stats"`
+	ID           string       `json:"id"`
+	Networks     Networks     `json:"networks"`
+
+	*ContainerState // ContainerState is the health and restart information, set by the agent
+}
+
+// BlkioStats are the block io stats of the docker api
+type BlkioStats struct {
+	IoServiceBytesRecursive []BlkioStatEntry `json:"io_service_bytes_recursive"`
+	IoServicedRecursive     []BlkioStatEntry `json:"io_serviced_recursive"`
+	IoQueueRecursive        []BlkioStatEntry `json:"io_queue_recursive"`
+	IoServiceTimeRecursive  []BlkioStatEntry `json:"io_service_time_recursive"`
+	IoWaitTimeRecursive     []BlkioStatEntry `json:"io_wait_time_recursive"`
+	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive"`
+	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive"`
+	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive"`
+}
+
+// BlkioStatEntry is one value of a device. Op is Read, Write, Sync, Async, Total (cgroup v1) or read, write (cgroup v2)
+type BlkioStatEntry struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Op    string `json:"op"`
+	Value int64  `json:"value"`
+}
+
+// BlockDevice are the read and written bytes and operations of one device
+type BlockDevice struct {
+	Device     string `json:"device"` // Device is major:minor like 8:0
+	ReadBytes  int64  `json:"read_bytes"`
+	WriteBytes int64  `json:"write_bytes"`
+	ReadOps    int64  `json:"read_ops"`
+	WriteOps   int64  `json:"write_ops"`
+}
+
+// Devices flattens the service bytes and serviced operations to one entry per device sorted by device
+func (b BlkioStats) Devices() []BlockDevice {
+	devices := make(map[string]*BlockDevice)
+	add := func(entries []BlkioStatEntry, read, write func(d *BlockDevice, value int64)) {
+		for _, one := range entries {
+			name := fmt.Sprintf("%d:%d", one.Major, one.Minor)
+			device, exist := devices[name]
+			if !exist {
+				device = &BlockDevice{Device: name}
+				devices[name] = device
+			}
+			switch strings.ToLower(one.Op) {
+			case "read":
+				read(device, one.Value)
+			case "write":
+				write(device, one.Value)
+			}
+		}
+	}
+	add(b.IoServiceBytesRecursive,
+		func(d *BlockDevice, value int64) { d.ReadBytes += value },
+		func(d *BlockDevice, value int64) { d.WriteBytes += value })
+	add(b.IoServicedRecursive,
+		func(d *BlockDevice, value int64) { d.ReadOps += value },
+		func(d *BlockDevice, value int64) { d.WriteOps += value })
+	if len(devices) == 0 {
+		return nil
+	}
+	res := make([]BlockDevice, 0, len(devices))
+	for _, one := range devices {
+		res = append(res, *one)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Device < res[j].Device
+	})
+	return res
+}
+
+type CPUStats struct {
+	CPUUsage       CPUUsage       `json:"cpu_usage"`
+	SystemCPUUsage int64          `json:"system_cpu_usage"`
+	OnlineCpus     int64          `json:"online_cpus"`
+	ThrottlingData ThrottlingData `json:"throttling_data"`
+}
+
+type CPUUsage struct {
+	TotalUsage        int64   `json:"total_usage"`
+	PercpuUsage       []int64 `json:"percpu_usage"`
+	UsageInKernelmode int64   `json:"usage_in_kernelmode"`
+	UsageInUsermode   int64   `json:"usage_in_usermode"`
+}
+
+type ThrottlingData struct {
+	Periods          int64 `json:"periods"`
+	ThrottledPeriods int64 `json:"throttled_periods"`
+	ThrottledTime    int64 `json:"throttled_time"` // ThrottledTime is in nanoseconds
+}
+
+type MemoryStats struct {
+	Usage    int64            `json:"usage"`
+	MaxUsage int64            `json:"max_usage"`
+	Stats    map[string]int64 `json:"stats"`
+	Limit    int64            `json:"limit"`
+}
+
+// inactiveFileKeys are the stats of the page cache which can be freed: cgroup v1, cgroup v2 and old docker versions
+var inactiveFileKeys = []string{"total_inactive_file", "inactive_file", "cache"}
+
+// WorkingSet returns the usage without the inactive page cache like docker stats and kubernetes show it
+func (m MemoryStats) WorkingSet() int64 {
+	for _, key := range inactiveFileKeys {
+		if inactive, exist := m.Stats[key]; exist {
+			if inactive > m.Usage {
+				return 0
+			}
+			return m.Usage - inactive
+		}
+	}
+	return m.Usage
+}
+
+// Networks are the stats of all network interfaces by name (eth0, eth1, ...)
+type Networks map[string]NetworkStats
+
+// Total sums the stats of all interfaces
+func (n Networks) Total() NetworkStats {
+	var res NetworkStats
+	for _, one := range n {
+		res.RxBytes += one.RxBytes
+		res.RxPackets += one.RxPackets
+		res.RxErrors += one.RxErrors
+		res.RxDropped += one.RxDropped
+		res.TxBytes += one.TxBytes
+		res.TxPackets += one.TxPackets
+		res.TxErrors += one.TxErrors
+		res.TxDropped += one.TxDropped
+	}
+	return res
+}
+
+// NetworkStats are the stats of one network interface
+type NetworkStats struct {
+	RxBytes   int64 `json:"rx_bytes"`
+	RxPackets int64 `json:"rx_packets"`
+	RxErrors  int64 `json:"rx_errors"`
+	RxDropped int64 `json:"rx_dropped"`
+	TxBytes   int64 `json:"tx_bytes"`
+	TxPackets int64 `json:"tx_packets"`
+	TxErrors  int64 `json:"tx_errors"`
+	TxDropped int64 `json:"tx_dropped"`
+}
+
+type PidsStats struct {
+	Current int64  `json:"current"`
+	Limit   uint64 `json:"limit,omitempty"` // Limit is 0 or the max of uint64 if there is no limit
+}
+
+// StorageStats are the storage stats of windows containers
+type StorageStats struct {
+	ReadCountNormalized  int64 `json:"read_count_normalized,omitempty"`
+	ReadSizeBytes        int64 `json:"read_size_bytes,omitempty"`
+	WriteCountNormalized int64 `json:"write_count_normalized,omitempty"`
+	WriteSizeBytes       int64 `json:"write_size_bytes,omitempty"`
+}
@@ -0,0 +1,136 @@
+package tracker
+
+import (
+	"sync"
+	"time"
+)
+
+// counters are the values of a stats sample which only grow while the container runs
+type counters struct {
+	at      time.Time
+	cpuNs   int64
+	rxBytes int64
+	txBytes int64
+	read    int64
+	write   int64
+}
+
+func countersOf(stats Stats, received time.Time) counters {
+	at, err := time.Parse(time.RFC3339Nano, stats.Read)
+	if err != nil || at.Unix() <= 0 {
+		at = received
+	}
+	network := stats.Networks.Total()
+	res := counters{
+		at:      at,
+		cpuNs:   stats.CPUStats.CPUUsage.TotalUsage,
+		rxBytes: network.RxBytes,
+		txBytes: network.TxBytes,
+	}
+	for _, one := range stats.BlkioStats.Devices() {
+		res.read += one.ReadBytes
+		res.write += one.WriteBytes
+	}
+	return res
+}
+
+// growth returns how much a counter has grown. A smaller value means the counter was reset (restart of the container) and has grown from 0
+func growth(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// minMaxAvg aggregates the values of one intervall
+type minMaxAvg struct {
+	min, max, sum float64
+}
+
+func (m *minMaxAvg) add(value float64, first bool) {
+	if first || value < m.min {
+		m.min = value
+	}
+	if first || value > m.max {
+		m.max = value
+	}
+	m.sum += value
+}
+
+// statsWindow aggregates all stats samples received between two STATSINTERVALL ticks.
+// The rates are taken between consecutive samples, so they go on over the ticks
+type statsWindow struct {
+	mu       sync.Mutex
+	last     Stats
+	previous *counters
+	elapsed  float64 // elapsed seconds between the samples of the intervall
+	grown    counters
+	samples  int
+	cpu      minMaxAvg
+	ram      minMaxAvg
+	workset  minMaxAvg
+}
+
+// add a new sample received at the given time
+func (w *statsWindow) add(stats Stats, received time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	current := countersOf(stats, received)
+	if w.previous != nil {
+		if elapsed := current.at.Sub(w.previous.at).Seconds(); elapsed > 0 {
+			w.elapsed += elapsed
+			w.grown.cpuNs += growth(w.previous.cpuNs, current.cpuNs)
+			w.grown.rxBytes += growth(w.previous.rxBytes, current.rxBytes)
+			w.grown.txBytes += growth(w.previous.txBytes, current.txBytes)
+			w.grown.read += growth(w.previous.read, current.read)
+			w.grown.write += growth(w.previous.write, current.write)
+		}
+	}
+	w.previous = &current
+	w.last = stats
+	w.cpu.add(stats.calculateCPUPercentUnix(), w.samples == 0)
+	w.ram.add(float64(stats.MemoryStats.Usage)/1000000, w.samples == 0)
+	w.workset.add(float64(stats.MemoryStats.WorkingSet())/1000000, w.samples == 0)
+	w.samples++
+}
+
+// take returns the cumulated last sample with the rates and min, avg and max of the intervall and starts a new intervall
+func (w *statsWindow) take() CumulateStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	res := CumulateStatsInfo(w.last)
+	res.StatsSamples = w.samples
+	if w.elapsed > 0 {
+		res.CPUUsageSecondsPerSecond = float64(w.grown.cpuNs) / 1000000000 / w.elapsed
+		res.NetIOReceiveMbPerSecond = float64(w.grown.rxBytes) / 1000000 / w.elapsed
+		res.NetIOTransmitMbPerSecond = float64(w.grown.txBytes) / 1000000 / w.elapsed
+		res.BlockIOReadMbPerSecond = float64(w.grown.read) / 1000000 / w.elapsed
+		res.BlockIOWriteMbPerSecond = float64(w.grown.write) / 1000000 / w.elapsed
+	}
+	if w.samples > 0 {
+		res.CPUUsagePercentMin = w.cpu.min
+		res.CPUUsagePercentAvg = w.cpu.sum / float64(w.samples)
+		res.CPUUsagePercentMax = w.cpu.max
+		res.RamUsageMbMin = w.ram.min
+		res.RamUsageMbAvg = w.ram.sum / float64(w.samples)
+		res.RamUsageMbMax = w.ram.max
+		res.RamWorkingSetMbMin = w.workset.min
+		res.RamWorkingSetMbAvg = w.workset.sum / float64(w.samples)
+		res.RamWorkingSetMbMax = w.workset.max
+	}
+	w.elapsed = 0
+	w.grown = counters{}
+	w.samples = 0
+	w.cpu = minMaxAvg{}
+	w.ram = minMaxAvg{}
+	w.workset = minMaxAvg{}
+	return res
+}
+
+// reset forgets the last sample, the stats stream has ended
+func (w *statsWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = Stats{}
+	w.previous = nil
+}
@@ -0,0 +1,91 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func sample(read string, cpuNs, rxBytes, readBytes, usage int64) Stats {
+	return Stats{
+		Read:        read,
+		Networks:    Networks{"eth0": {RxBytes: rxBytes}},
+		BlkioStats:  BlkioStats{IoServiceBytesRecursive: []BlkioStatEntry{{Major: 8, Op: "Read", Value: readBytes}}},
+		MemoryStats: MemoryStats{Usage: usage},
+		CPUStats: CPUStats{
+			CPUUsage:       CPUUsage{TotalUsage: cpuNs, PercpuUsage: []int64{0, 0}},
+			SystemCPUUsage: cpuNs * 4,
+		},
+		PrecpuStats: CPUStats{SystemCPUUsage: 0},
+	}
+}
+
+func roughly(a, b float64) bool {
+	return math.Abs(a-b) < 0.000001
+}
+
+func Test_statsWindow(t *testing.T) {
+	var w statsWindow
+	received := time.Date(2019, time.August, 12, 12, 0, 0, 0, time.UTC)
+	w.add(sample("2019-08-12T12:00:00Z", 1000000000, 1000000, 5000000, 10000000), received)
+	w.add(sample("2019-08-12T12:00:01Z", 1500000000, 3000000, 6000000, 30000000), received)
+	w.add(sample("2019-08-12T12:00:02Z", 2000000000, 5000000, 7000000, 20000000), received)
+
+	got := w.take()
+	if got.StatsSamples != 3 {
+		t.Errorf("StatsSamples = %v, want 3", got.StatsSamples)
+	}
+	if !roughly(got.CPUUsageSecondsPerSecond, 0.5) {
+		t.Errorf("CPUUsageSecondsPerSecond = %v, want 0.5", got.CPUUsageSecondsPerSecond)
+	}
+	if !roughly(got.NetIOReceiveMbPerSecond, 2) {
+		t.Errorf("NetIOReceiveMbPerSecond = %v, want 2", got.NetIOReceiveMbPerSecond)
+	}
+	if !roughly(got.BlockIOReadMbPerSecond, 1) {
+		t.Errorf("BlockIOReadMbPerSecond = %v, want 1", got.BlockIOReadMbPerSecond)
+	}
+	if got.RamUsageMbMin != 10 || got.RamUsageMbMax != 30 || !roughly(got.RamUsageMbAvg, 20) {
+		t.Errorf("RamUsageMb min, avg, max = %v, %v, %v, want 10, 20, 30", got.RamUsageMbMin, got.RamUsageMbAvg, got.RamUsageMbMax)
+	}
+	if got.RamWorkingSetMbMin != 10 || got.RamWorkingSetMbMax != 30 || !roughly(got.RamWorkingSetMbAvg, 20) {
+		t.Errorf("RamWorkingSetMb min, avg, max = %v, %v, %v, want 10, 20, 30", got.RamWorkingSetMbMin, got.RamWorkingSetMbAvg, got.RamWorkingSetMbMax)
+	}
+	if got.CPUUsagePercentMin != 50 || got.CPUUsagePercentMax != 50 || !roughly(got.CPUUsagePercentAvg, 50) {
+		t.Errorf("CPUUsagePercent min, avg, max = %v, %v, %v, want 50", got.CPUUsagePercentMin, got.CPUUsagePercentAvg, got.CPUUsagePercentMax)
+	}
+	if got.RamUsageMb != 20 || got.NetIOReceiveMb != 5 {
+		t.Errorf("last sample is not cumulated RamUsageMb = %v, NetIOReceiveMb = %v", got.RamUsageMb, got.NetIOReceiveMb)
+	}
+
+	// the container was restarted, the counters start at 0 again
+	w.add(sample("2019-08-12T12:00:04Z", 400000000, 1000000, 0, 20000000), received)
+	got = w.take()
+	if got.StatsSamples != 1 {
+		t.Errorf("StatsSamples after take = %v, want 1", got.StatsSamples)
+	}
+	if !roughly(got.CPUUsageSecondsPerSecond, 0.2) || !roughly(got.NetIOReceiveMbPerSecond, 0.5) || got.BlockIOReadMbPerSecond != 0 {
+		t.Errorf("rates after counter reset = %v, %v, %v, want 0.2, 0.5, 0", got.CPUUsageSecondsPerSecond, got.NetIOReceiveMbPerSecond, got.BlockIOReadMbPerSecond)
+	}
+
+	got = w.take()
+	if got.StatsSamples != 0 || got.NetIOReceiveMbPerSecond != 0 || got.RamUsageMbMax != 0 {
+		t.Errorf("take without samples = %+v", got)
+	}
+	if got.NetIOReceiveMb != 1 {
+		t.Errorf("take without samples has not the last sample NetIOReceiveMb = %v", got.NetIOReceiveMb)
+	}
+	w.reset()
+	if got := w.take(); got.NetIOReceiveMb != 0 {
+		t.Errorf("take after reset NetIOReceiveMb = %v, want 0", got.NetIOReceiveMb)
+	}
+}
+
+func Test_statsWindow_receivedTime(t *testing.T) {
+	var w statsWindow
+	received := time.Date(2019, time.August, 12, 12, 0, 0, 0, time.UTC)
+	w.add(sample("", 0, 0, 0, 0), received)
+	w.add(sample("0001-01-01T00:00:00Z", 0, 4000000, 0, 0), received.Add(2*time.Second))
+	if got := w.take(); !roughly(got.NetIOReceiveMbPerSecond, 2) {
+		t.Errorf("NetIOReceiveMbPerSecond = %v, want 2", got.NetIOReceiveMbPerSecond)
+	}
+}
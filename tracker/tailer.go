@@ -0,0 +1,145 @@
+package tracker
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// fileTailer follows the file returned by current.
+// If the file is rotated (renamed and created again), truncated (copytruncate) or current returns another file
+// the rest of the old file is read and it goes on with the new one.
+// current returns an empty path if there is nothing to read yet and an error if the source is removed
+type fileTailer struct {
+	current     func() (string, error)
+	checkpoints *Checkpoints
+	startAtEnd  bool // startAtEnd skips the content of the first opened file if there is no checkpoint
+	path        string
+	id          string
+	file        *os.File
+	reader      *bufio.Reader
+	offset      int64
+	pending     string
+}
+
+func newFileTailer(current func() (string, error)) *fileTailer {
+	return &fileTailer{current: current}
+}
+
+func (f *fileTailer) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.close()
+	f.path = path
+	f.id = fileID(info)
+	f.file = file
+	f.offset = 0
+	f.pending = ""
+	if checkpoint, exist := f.checkpoints.Get(f.id); exist && checkpoint.Offset <= info.Size() {
+		f.offset = checkpoint.Offset
+	} else if f.startAtEnd {
+		f.offset = info.Size()
+	}
+	f.startAtEnd = false
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		return err
+	}
+	f.reader = bufio.NewReader(file)
+	return nil
+}
+
+func (f *fileTailer) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// readLines returns all complete lines written since last call
+func (f *fileTailer) readLines() ([]string, error) {
+	var res []string
+	defer f.savePosition()
+	for {
+		line, err := f.reader.ReadString('\n')
+		f.offset += int64(len(line))
+		if err == io.EOF {
+			f.pending += line
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		res = append(res, f.pending+line)
+		f.pending = ""
+	}
+}
+
+// savePosition set the checkpoint behind the last complete line
+func (f *fileTailer) savePosition() {
+	f.checkpoints.Set(f.id, Checkpoint{Path: f.path, Offset: f.offset - int64(len(f.pending))})
+}
+
+// poll returns all new lines. The error of current is returned if the source is removed
+func (f *fileTailer) poll() ([]string, error) {
+	current, err := f.current()
+	if err != nil {
+		var res []string
+		if f.file != nil {
+			res, _ = f.readLines()
+			f.close()
+		}
+		return res, err
+	}
+	if f.file == nil {
+		if current == "" {
+			return nil, nil
+		}
+		if err := f.open(current); err != nil {
+			return nil, err
+		}
+	}
+	res, err := f.readLines()
+	if err != nil || current == "" {
+		return res, err
+	}
+	openStats, err := f.file.Stat()
+	if err != nil {
+		return res, err
+	}
+	currentStats, err := os.Stat(current)
+	if err != nil {
+		return res, nil
+	}
+	switch {
+	case current != f.path || !os.SameFile(openStats, currentStats):
+		rest, err := f.readLines()
+		res = append(res, rest...)
+		if err != nil {
+			return res, err
+		}
+		if err := f.open(current); err != nil {
+			return res, err
+		}
+		rest, err = f.readLines()
+		res = append(res, rest...)
+		return res, err
+	case currentStats.Size() < f.offset:
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return res, err
+		}
+		f.reader.Reset(f.file)
+		f.offset = 0
+		f.pending = ""
+		rest, err := f.readLines()
+		res = append(res, rest...)
+		return res, err
+	}
+	return res, nil
+}
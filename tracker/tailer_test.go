@@ -0,0 +1,118 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_fileTailer_poll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funk_cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	current := filepath.Join(dir, "0.log")
+	tailer := newFileTailer(func() (string, error) {
+		return currentCRILogFile(dir)
+	})
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{
+			name:   "no file yet",
+			change: func() {},
+		},
+		{
+			name:   "new file with an incomplete line",
+			change: func() { appendFile(t, current, "a\nb") },
+			want:   []string{"a\n"},
+		},
+		{
+			name:   "line is completed",
+			change: func() { appendFile(t, current, "c\n") },
+			want:   []string{"bc\n"},
+		},
+		{
+			name: "rotation read the rest of the old file and the new file",
+			change: func() {
+				appendFile(t, current, "d\n")
+				if err := os.Rename(current, current+".20191019-105426"); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, current, "e\nee\n")
+			},
+			want: []string{"d\n", "e\n", "ee\n"},
+		},
+		{
+			name: "truncate starts at the beginning",
+			change: func() {
+				if err := ioutil.WriteFile(current, []byte("f\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"f\n"},
+		},
+		{
+			name:   "container restart use the next log file",
+			change: func() { appendFile(t, filepath.Join(dir, "1.log"), "g\n") },
+			want:   []string{"g\n"},
+		},
+	}
+	for _, step := range steps {
+		step.change()
+		got, err := tailer.poll()
+		if err != nil {
+			t.Fatalf("%s: fileTailer.poll() error = %v", step.name, err)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: fileTailer.poll() = %q, want %q", step.name, got, step.want)
+		}
+	}
+	os.RemoveAll(dir)
+	if _, err := tailer.poll(); !os.IsNotExist(err) {
+		t.Errorf("fileTailer.poll() error = %v, want not exist after the directory is removed", err)
+	}
+}
+
+func Test_fileTailer_checkpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funk_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	current := func() (string, error) {
+		return path, nil
+	}
+	appendFile(t, path, "old\n")
+	checkpoints := LoadCheckpoints(filepath.Join(dir, "checkpoints", "files.json"))
+
+	tailer := newFileTailer(current)
+	tailer.checkpoints = checkpoints
+	tailer.startAtEnd = true
+	if got, _ := tailer.poll(); len(got) != 0 {
+		t.Errorf("startAtEnd want no lines got %q", got)
+	}
+	appendFile(t, path, "a\nb")
+	if got, _ := tailer.poll(); !reflect.DeepEqual(got, []string{"a\n"}) {
+		t.Errorf("fileTailer.poll() = %q, want [a]", got)
+	}
+	tailer.close()
+	if err := checkpoints.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, path, "\nc\n")
+	restarted := newFileTailer(current)
+	restarted.checkpoints = LoadCheckpoints(filepath.Join(dir, "checkpoints", "files.json"))
+	restarted.startAtEnd = true
+	want := []string{"b\n", "c\n"}
+	if got, _ := restarted.poll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after restart fileTailer.poll() = %q, want %q", got, want)
+	}
+}
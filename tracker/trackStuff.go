@@ -8,6 +8,7 @@ import (
 	"io"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -18,15 +19,22 @@ import (
 type DockerClient interface {
 	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
 	ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerInspectWithRaw(ctx context.Context, containerID string, getSize bool) (types.ContainerJSON, []byte, error)
+	ContainerTop(ctx context.Context, containerID string, arguments []string) (types.ContainerProcessList, error)
 }
 
 type TrackElement interface {
 	SearchIndex() string
 	GetStats() Stats
+	// GetCumulateStats returns the cumulated stats with the rates and min, avg and max of all samples since the last call
+	GetCumulateStats() CumulateStats
 	GetLogs() []TrackerLogs
 	GetContainer() types.Container
 	SetContainer(con types.Container)
 	GetStaticContent() string
+	GetFilterCounter() FilterCounter
+	GetInspect() *types.ContainerJSON
 }
 
 type Tracker struct {
@@ -34,7 +42,24 @@ type Tracker struct {
 	ctx       context.Context
 	client    DockerClient
 	stats     *Stats
+	window    statsWindow
 	logs      []TrackerLogs
+	processor *logProcessor
+	opts      Options
+	inspect   *types.ContainerJSON
+	files     *fileFollower
+	ended     chan struct{} // ended is closed when the container has ended, use getEnded
+	endOnce   sync.Once
+	mu        sync.Mutex
+}
+
+// Options are the agent wide settings for all trackers
+type Options struct {
+	MinLevel      string        // MinLevel is the default for label funk.log.minlevel
+	HostRoot      string        // HostRoot is the place of the host filesystem inside the agent to find the files of label funk.log.files and the cgroups
+	StatsSource   StatsSource   // StatsSource is the way the stats are read
+	StateInterval time.Duration // StateInterval is the intervall to inspect the container again for the health and restart information, 0 disables it
+	Checkpoints   *Checkpoints  // Checkpoints store the read positions of files
 }
 
 func (t *Tracker) GetContainer() types.Container {
@@ -46,7 +71,11 @@ func (t *Tracker) SetContainer(con types.Container) {
 }
 
 func (t *Tracker) SearchIndex() string {
-	index := t.container.Labels["funk.searchindex"]
+	return searchIndex(t.container)
+}
+
+func searchIndex(container types.Container) string {
+	index := container.Labels["funk.searchindex"]
 	if index == "" {
 		return "default"
 	}
@@ -58,29 +87,222 @@ type fallback struct {
 	Message string `json:"message,omitempty"`
 }
 
-func NewTracker(client DockerClient, container types.Container) *Tracker {
+func NewTracker(client DockerClient, container types.Container, opts Options) *Tracker {
 	res := &Tracker{
 		client:    client,
 		container: container,
 		stats:     new(Stats),
 		ctx:       context.Background(),
+		processor: newLogProcessor(container, opts),
+		opts:      opts,
 	}
 	res.runAsyncTasks()
 	return res
 }
 
+// logProcessor parse, normalise and filter the loglines of one container.
+// It is shared by all inputs so each logline takes the same way
+type logProcessor struct {
+	formatRegex    string
+	multilineStart *regexp.Regexp
+	filter         *LogFilter
+	minLevel       LogLevel
+	logs           *zap.SugaredLogger
+}
+
+// processorLabels are the labels used by newLogProcessor
+var processorLabels = []string{"funk.log.formatRegex", "funk.log.multiline", "funk.log.minlevel", "funk.log.keep", "funk.log.drop", "funk.log.sample"}
+
+// processorChanged returns true if one of the processorLabels of the containers differ, so a new logProcessor is needed
+func processorChanged(old, new types.Container) bool {
+	for _, one := range processorLabels {
+		if old.Labels[one] != new.Labels[one] {
+			return true
+		}
+	}
+	return false
+}
+
+func newLogProcessor(container types.Container, opts Options) *logProcessor {
+	logs := getLoggerWithContainerInformation(logger.Get(), &container)
+	filter, err := NewLogFilter(container.Labels)
+	if err != nil {
+		logs.Errorw("Error by create logfilter, send all logs: " + err.Error())
+		filter, _ = NewLogFilter(map[string]string{})
+	}
+	var multilineStart *regexp.Regexp
+	if multiline := container.Labels["funk.log.multiline"]; multiline != "" {
+		multilineStart, err = regexp.Compile(multiline)
+		if err != nil {
+			logs.Errorw("Error by parsing funk.log.multiline, send each line: " + err.Error())
+		}
+	}
+	minLevelValue := getFilledValue(container.Labels["funk.log.minlevel"], opts.MinLevel)
+	minLevel := ParseLogLevel(minLevelValue)
+	if minLevelValue != "" && minLevel == LogLevelUnknown {
+		logs.Errorw("Error by parsing funk.log.minlevel, send all levels: unknown level " + minLevelValue)
+	}
+	return &logProcessor{
+		formatRegex:    container.Labels["funk.log.formatRegex"],
+		multilineStart: multilineStart,
+		filter:         filter,
+		minLevel:       minLevel,
+		logs:           logs,
+	}
+}
+
+// newMultiline returns the multilineJoiner for one source of loglines (nil without label funk.log.multiline)
+func (p *logProcessor) newMultiline() *multilineJoiner {
+	return newMultilineJoiner(p.multilineStart)
+}
+
+// processAll process each logline and returns the not dropped ones
+func (p *logProcessor) processAll(lines []string) []TrackerLogs {
+	var res []TrackerLogs
+	for _, one := range lines {
+		if track, ok := p.process(one); ok {
+			res = append(res, track)
+		}
+	}
+	return res
+}
+
+// process turns a logline starting with its timestamp into TrackerLogs.
+// It returns false if the logline is dropped by level or filter
+func (p *logProcessor) process(te string) (TrackerLogs, bool) {
+	var track TrackerLogs
+	var err error
+	if p.formatRegex != "" {
+		track, err = getTrackerLogsByFormat(p.formatRegex, strings.Trim(strings.SplitN(te, " ", 2)[1], " "))
+		if err != nil {
+			p.logs.Errorw(err.Error())
+		}
+		te = string(track)
+	}
+	track, err = getTrackerLog(te)
+	if err != nil {
+
+		p.logs.Errorw("Use fallback" + err.Error())
+		fallbackMessage := fallback{
+			Message: te,
+		}
+		bfallBack, _ := json.Marshal(fallbackMessage)
+		track = TrackerLogs(bfallBack)
+
+	}
+	track, level := NormaliseLevel(track)
+	if level != LogLevelUnknown && level < p.minLevel {
+		p.filter.countLevel()
+		return track, false
+	}
+	return track, p.filter.Allow(track)
+}
+
 func (t *Tracker) GetStats() Stats {
 	return *t.stats
 }
+
+func (t *Tracker) GetCumulateStats() CumulateStats {
+	return t.window.take()
+}
+
+// GetFilterCounter returns the count of filtered logs since last call
+func (t *Tracker) GetFilterCounter() FilterCounter {
+	return t.processor.filter.Counter()
+}
+
 func (t *Tracker) GetLogs() []TrackerLogs {
 	res := t.logs
 	t.logs = make([]TrackerLogs, 0)
+	t.mu.Lock()
+	files := t.files
+	t.mu.Unlock()
+	if files != nil {
+		res = append(res, files.takeLogs()...)
+	}
 	return res
 }
 
+// GetInspect returns the result of container inspect or nil if it is not loaded yet
+func (t *Tracker) GetInspect() *types.ContainerJSON {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inspect
+}
+
+func (t *Tracker) inspectContainer() error {
+	inspect, err := t.client.ContainerInspect(t.ctx, t.container.ID)
+	if err != nil {
+		getLoggerWithContainerInformation(logger.Get(), &t.container).Errorw("Error by inspect container:" + err.Error())
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inspect = &inspect
+	return nil
+}
+
+// getEnded returns the channel which is closed when the container has ended
+func (t *Tracker) getEnded() chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ended == nil {
+		t.ended = make(chan struct{})
+	}
+	return t.ended
+}
+
+// end is called when the logs stream ends or the container is found stopped, it stops the followed files
+func (t *Tracker) end() {
+	t.endOnce.Do(func() {
+		close(t.getEnded())
+	})
+}
+
+// watchState inspects the container again each StateInterval to keep the health and restart information up to date.
+// It ends if the container is removed or has stopped
+func (t *Tracker) watchState(ticker <-chan time.Time) {
+	for range ticker {
+		if err := t.inspectContainer(); err != nil || isStopped(t.GetInspect()) {
+			t.end()
+			return
+		}
+	}
+}
+
+// followFiles follows the files of label funk.log.files inside the container until the container has ended
+func (t *Tracker) followFiles() {
+	if t.container.Labels["funk.log.files"] == "" {
+		return
+	}
+	files := newContainerFileFollower(t.container, t.GetInspect(), t.processor, t.opts)
+	if files == nil {
+		return
+	}
+	t.mu.Lock()
+	t.files = files
+	t.mu.Unlock()
+	files.run(time.Second, t.getEnded())
+}
+
 func (t *Tracker) runAsyncTasks() {
-	go t.streamStats()
+	go func() {
+		t.inspectContainer()
+		t.followFiles()
+	}()
+	if t.opts.StatsSource == StatsSourceCgroup {
+		go t.pollCgroupStats()
+	} else {
+		go t.streamStats()
+	}
 	go t.readLogs()
+	if t.opts.StateInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(t.opts.StateInterval)
+			defer ticker.Stop()
+			t.watchState(ticker.C)
+		}()
+	}
 }
 
 func IsJSON(s string) bool {
@@ -107,30 +329,29 @@ func (t *Tracker) readLogs() {
 	}
 	defer clogs.Close()
 
-	r := bufio.NewScanner(clogs)
-	for r.Scan() {
-		te := r.Text()
-		var track TrackerLogs
-		var err error
-		if t.container.Labels["funk.log.formatRegex"] != "" {
-			track, err = getTrackerLogsByFormat(t.container.Labels["funk.log.formatRegex"], strings.Trim(strings.SplitN(te, " ", 2)[1], " "))
-			if err != nil {
-				logs.Errorw(err.Error())
-			}
-			te = string(track)
+	lines := make(chan string)
+	go func() {
+		r := bufio.NewScanner(clogs)
+		for r.Scan() {
+			lines <- r.Text()
 		}
-		track, err = getTrackerLog(te)
-		if err != nil {
-
-			logs.Errorw("Use fallback" + err.Error())
-			fallbackMessage := fallback{
-				Message: te,
+		close(lines)
+	}()
+	multiline := t.processor.newMultiline()
+	ticker := time.NewTicker(multilineTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.logs = append(t.logs, t.processor.processAll(multiline.flush(time.Now(), true))...)
+				t.end()
+				return
 			}
-			bfallBack, _ := json.Marshal(fallbackMessage)
-			track = TrackerLogs(bfallBack)
-
+			t.logs = append(t.logs, t.processor.processAll(multiline.add(line, time.Now()))...)
+		case now := <-ticker.C:
+			t.logs = append(t.logs, t.processor.processAll(multiline.flush(now, false))...)
 		}
-		t.logs = append(t.logs, track)
 	}
 }
 
@@ -189,127 +410,69 @@ func (t *Tracker) streamStats() {
 	}
 	d := json.NewDecoder(cstats.Body)
 	defer cstats.Body.Close()
-	var data Stats
 	for d.More() {
+		// a new value each time, the networks map would keep removed interfaces
+		var data Stats
 		err := d.Decode(&data)
 		if err == nil {
 			t.stats = &data
+			t.window.add(data, time.Now())
 		}
 	}
 	t.stats = new(Stats)
+	t.window.reset()
 }
 
-func getLoggerWithContainerInformation(logs *zap.SugaredLogger, container *types.Container) *zap.SugaredLogger {
-	return logs.With(
-		"containername", container.Names[0],
-	)
-}
-
-func (v *Stats) calculateCPUPercentUnix() float64 {
-	var (
-		cpuPercent = 0.0
-		// calculate the change for the cpu usage of the container in between readings
-		cpuDelta = float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PrecpuStats.CPUUsage.TotalUsage)
-		// calculate the change for the entire system between readings
-		systemDelta = float64(v.CPUStats.SystemCPUUsage) - float64(v.PrecpuStats.SystemCPUUsage)
-	)
-
-	if systemDelta > 0.0 && cpuDelta > 0.0 {
-		cpuPercent = (cpuDelta / systemDelta) * float64(len(v.CPUStats.CPUUsage.PercpuUsage)) * 100.0
+// inspectPid returns the pid of the container, 0 if it is unknown
+func inspectPid(inspect *types.ContainerJSON) int {
+	if inspect != nil && inspect.ContainerJSONBase != nil && inspect.State != nil {
+		return inspect.State.Pid
 	}
-	return cpuPercent
+	return 0
 }
 
-func CumulateStatsInfo(stats Stats) CumulateStats {
-	return CumulateStats{
-		RamUsageMb:      float64(stats.MemoryStats.Usage) / 1000000,
-		RamUsagePercent: (float64(stats.MemoryStats.Usage) / float64(stats.MemoryStats.Limit)) * 100,
-		CPUUsagePercent: stats.calculateCPUPercentUnix(),
-		RamLimitMb:      float64(stats.MemoryStats.Limit) / 1000000,
-		NetIOReceiveMb:  float64(stats.Networks.Eth0.RxBytes) / 1000000,
-		NetIOTransmitMb: float64(stats.Networks.Eth0.TxBytes) / 1000000,
+// pollCgroupStats reads the stats from the cgroup filesystem each second instead of the docker stats stream.
+// It waits for the inspect of the container to know its pid, the pid is taken of the last inspect at each poll
+func (t *Tracker) pollCgroupStats() {
+	logs := getLoggerWithContainerInformation(logger.Get(), &t.container)
+	ticker := time.NewTicker(cgroupStatsInterval)
+	defer ticker.Stop()
+	var reader *cgroupStats
+	waited := 0
+	for now := range ticker.C {
+		if reader == nil {
+			inspect := t.GetInspect()
+			if inspect == nil && waited < 5 {
+				waited++
+				continue
+			}
+			var err error
+			reader, err = newCgroupStats(t.opts.HostRoot, t.container.ID, inspectPid(inspect))
+			if err != nil {
+				logs.Errorw("Error get cgroup stats:" + err.Error())
+				return
+			}
+		}
+		data, err := reader.read(now, inspectPid(t.GetInspect()))
+		if err != nil {
+			break
+		}
+		t.stats = &data
+		t.window.add(data, now)
 	}
+	t.stats = new(Stats)
+	t.window.reset()
 }
 
-type CumulateStats struct {
-	CPUUsagePercent float64 `json:"cpu_usage_percent"`
-	RamUsagePercent float64 `json:"ram_usage_percent"`
-	RamUsageMb      float64 `json:"ram_usage_mb"`
-	RamLimitMb      float64 `json:"ram_limit_mb"`
-	NetIOReceiveMb  float64 `json:"net_io_usage_mb"`
-	NetIOTransmitMb float64 `json:"net_io_transmit_mb"`
-}
-
-type Stats struct {
-	Read      string    `json:"read"`
-	Preread   string    `json:"preread"`
-	PidsStats PidsStats `json:"pids_stats"`
-	// BlkioStats   BlkioStats   `json:"blkio_stats"` // logs urgly not logable out of the box necessary ?
-	NumProcs     int64        `json:"num_procs"`
-	StorageStats StorageStats `json:"storage_stats"`
-	CPUStats     CPUStats     `json:"cpu_stats"`
-	PrecpuStats  CPUStats     `json:"precpu_stats"`
-	MemoryStats  MemoryStats  `json:"memory_stats"`
-	ID           string       `json:"id"`
-	Networks     Networks     `json:"networks"`
-}
-
-type BlkioStats struct {
-	IoServiceBytesRecursive []interface{} `json:"io_service_bytes_recursive"`
-	IoServicedRecursive     []interface{} `json:"io_serviced_recursive"`
-	IoQueueRecursive        []interface{} `json:"io_queue_recursive"`
-	IoServiceTimeRecursive  []interface{} `json:"io_service_time_recursive"`
-	IoWaitTimeRecursive     []interface{} `json:"io_wait_time_recursive"`
-	IoMergedRecursive       []interface{} `json:"io_merged_recursive"`
-	IoTimeRecursive         []interface{} `json:"io_time_recursive"`
-	SectorsRecursive        []interface{} `json:"sectors_recursive"`
-}
-
-type CPUStats struct {
-	CPUUsage       CPUUsage       `json:"cpu_usage"`
-	SystemCPUUsage int64          `json:"system_cpu_usage"`
-	OnlineCpus     int64          `json:"online_cpus"`
-	ThrottlingData ThrottlingData `json:"throttling_data"`
-}
-
-type CPUUsage struct {
-	TotalUsage        int64   `json:"total_usage"`
-	PercpuUsage       []int64 `json:"percpu_usage"`
-	UsageInKernelmode int64   `json:"usage_in_kernelmode"`
-	UsageInUsermode   int64   `json:"usage_in_usermode"`
-}
-
-type ThrottlingData struct {
-	Periods          int64 `json:"periods"`
-	ThrottledPeriods int64 `json:"throttled_periods"`
-	ThrottledTime    int64 `json:"throttled_time"`
-}
-
-type MemoryStats struct {
-	Usage    int64            `json:"usage"`
-	MaxUsage int64            `json:"max_usage"`
-	Stats    map[string]int64 `json:"stats"`
-	Limit    int64            `json:"limit"`
-}
-
-type Networks struct {
-	Eth0 Eth0 `json:"eth0"`
-}
-
-type Eth0 struct {
-	RxBytes   int64 `json:"rx_bytes"`
-	RxPackets int64 `json:"rx_packets"`
-	RxErrors  int64 `json:"rx_errors"`
-	RxDropped int64 `json:"rx_dropped"`
-	TxBytes   int64 `json:"tx_bytes"`
-	TxPackets int64 `json:"tx_packets"`
-	TxErrors  int64 `json:"tx_errors"`
-	TxDropped int64 `json:"tx_dropped"`
-}
-
-type PidsStats struct {
-	Current int64 `json:"current"`
+func getFilledValue(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
 }
 
-type StorageStats struct {
+func getLoggerWithContainerInformation(logs *zap.SugaredLogger, container *types.Container) *zap.SugaredLogger {
+	return logs.With(
+		"containername", container.Names[0],
+	)
 }
@@ -159,6 +159,8 @@ func TestIsJSON(t *testing.T) {
 type MockDockerClient struct {
 	ResultLog            string
 	ResultContainerStats string
+	ResultTop            types.ContainerProcessList
+	ResultSizeRw         *int64
 }
 
 func (m *MockDockerClient) ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
@@ -175,6 +177,29 @@ func (m *MockDockerClient) ContainerStats(ctx context.Context, containerID strin
 	}, nil
 }
 
+func (m *MockDockerClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: containerID,
+			State: &types.ContainerState{
+				StartedAt: "2019-08-12T12:52:07.123Z",
+			},
+		},
+	}, nil
+}
+
+func (m *MockDockerClient) ContainerInspectWithRaw(ctx context.Context, containerID string, getSize bool) (types.ContainerJSON, []byte, error) {
+	res, err := m.ContainerInspect(ctx, containerID)
+	if getSize {
+		res.SizeRw = m.ResultSizeRw
+	}
+	return res, nil, err
+}
+
+func (m *MockDockerClient) ContainerTop(ctx context.Context, containerID string, arguments []string) (types.ContainerProcessList, error) {
+	return m.ResultTop, nil
+}
+
 func TestNewTracker_Logs(t *testing.T) {
 
 	tests := []struct {
@@ -239,6 +264,30 @@ func TestNewTracker_Logs(t *testing.T) {
 			},
 			want: []TrackerLogs{`{"mock":true}`},
 		},
+		{
+			name:            "container have a minlevel so lower levels will be dropped but lines without level are send",
+			resultLogs:      "{\"lvl\":\"DEBUG\"}\n{\"lvl\":\"WARN\"}\nplain text",
+			resultContainer: `{"mock":true}`,
+			container: types.Container{
+				Labels: map[string]string{
+					"funk.log.minlevel": "info",
+				},
+				Names: []string{"mocktest0"},
+			},
+			want: []TrackerLogs{`{"level":"warn","lvl":"WARN"}`, `{"message":"plain text"}`},
+		},
+		{
+			name:            "container have a multiline regex so following lines are joined to one logline",
+			resultLogs:      "2019-08-12T12:52:07Z panic: boom\n2019-08-12T12:52:07Z \tat main.go:12\n2019-08-12T12:52:08Z next",
+			resultContainer: `{"mock":true}`,
+			container: types.Container{
+				Labels: map[string]string{
+					"funk.log.multiline": `^\S`,
+				},
+				Names: []string{"mocktest0"},
+			},
+			want: []TrackerLogs{`{"message":"2019-08-12T12:52:07Z panic: boom\n\tat main.go:12"}`, `{"message":"2019-08-12T12:52:08Z next"}`},
+		},
 	}
 
 	for _, tt := range tests {
@@ -247,7 +296,7 @@ func TestNewTracker_Logs(t *testing.T) {
 				ResultLog:            tt.resultLogs,
 				ResultContainerStats: tt.resultContainer,
 			}
-			tracker := NewTracker(&mockClient, tt.container)
+			tracker := NewTracker(&mockClient, tt.container, Options{})
 			time.Sleep(60 * time.Millisecond)
 			logs := tracker.GetLogs()
 			if !reflect.DeepEqual(logs, tt.want) {
@@ -259,8 +308,6 @@ func TestNewTracker_Logs(t *testing.T) {
 }
 
 func TestCumulateStatsInfo(t *testing.T) {
-	type args struct {
-	}
 	tests := []struct {
 		name       string
 		inputstats Stats
@@ -270,7 +317,7 @@ func TestCumulateStatsInfo(t *testing.T) {
 			name: "Test that inputvalue will be cumlate correctly",
 			inputstats: Stats{
 				Networks: Networks{
-					Eth0: Eth0{
+					"eth0": {
 						RxBytes: 12527088,
 						TxBytes: 9631887,
 					},
@@ -303,14 +350,91 @@ func TestCumulateStatsInfo(t *testing.T) {
 				},
 			},
 			want: CumulateStats{
-				RamUsageMb:      16.007584,
-				RamUsagePercent: 8.003792,
-				CPUUsagePercent: 0.20662566308243727,
-				RamLimitMb:      200,
-				NetIOReceiveMb:  12.527088,
-				NetIOTransmitMb: 9.631887,
+				RamUsageMb:           16.007584,
+				RamUsagePercent:      8.003792,
+				RamWorkingSetMb:      16.007584,
+				RamWorkingSetPercent: 8.003792,
+				CPUUsagePercent:      0.20662566308243727,
+				RamLimitMb:           200,
+				NetIOReceiveMb:       12.527088,
+				NetIOTransmitMb:      9.631887,
+				Networks: Networks{
+					"eth0": {
+						RxBytes: 12527088,
+						TxBytes: 9631887,
+					},
+				},
+			},
+		},
+		{
+			name: "all interfaces, block io, working set, pids and throttling",
+			inputstats: Stats{
+				Networks: Networks{
+					"eth0": {RxBytes: 1000000, RxPackets: 10, RxErrors: 1, TxBytes: 2000000, TxPackets: 20, TxDropped: 2},
+					"eth1": {RxBytes: 3000000, RxPackets: 30, TxBytes: 4000000, TxPackets: 40, TxErrors: 3, RxDropped: 4},
+				},
+				BlkioStats: BlkioStats{
+					IoServiceBytesRecursive: []BlkioStatEntry{
+						{Major: 8, Minor: 0, Op: "Read", Value: 1000000},
+						{Major: 8, Minor: 0, Op: "Write", Value: 2000000},
+						{Major: 8, Minor: 0, Op: "Total", Value: 3000000},
+						{Major: 253, Minor: 1, Op: "read", Value: 3000000},
+					},
+					IoServicedRecursive: []BlkioStatEntry{
+						{Major: 8, Minor: 0, Op: "Read", Value: 10},
+						{Major: 8, Minor: 0, Op: "Write", Value: 20},
+						{Major: 253, Minor: 1, Op: "write", Value: 5},
+					},
+				},
+				MemoryStats: MemoryStats{
+					Usage: 30000000,
+					Limit: 100000000,
+					Stats: map[string]int64{"total_inactive_file": 10000000, "cache": 20000000},
+				},
+				PidsStats: PidsStats{Current: 12, Limit: 100},
+				CPUStats: CPUStats{
+					ThrottlingData: ThrottlingData{Periods: 200, ThrottledPeriods: 60, ThrottledTime: 1500000000},
+				},
+				PrecpuStats: CPUStats{
+					ThrottlingData: ThrottlingData{Periods: 100, ThrottledPeriods: 40, ThrottledTime: 1000000000},
+				},
+			},
+			want: CumulateStats{
+				CPUThrottledPeriods:  60,
+				CPUThrottledTimeMs:   1500,
+				CPUThrottledPercent:  20,
+				RamUsageMb:           30,
+				RamUsagePercent:      30,
+				RamWorkingSetMb:      20,
+				RamWorkingSetPercent: 20,
+				RamLimitMb:           100,
+				NetIOReceiveMb:       4,
+				NetIOTransmitMb:      6,
+				NetIOReceivePackets:  40,
+				NetIOTransmitPacket:  60,
+				NetIOErrors:          4,
+				NetIODropped:         6,
+				Networks: Networks{
+					"eth0": {RxBytes: 1000000, RxPackets: 10, RxErrors: 1, TxBytes: 2000000, TxPackets: 20, TxDropped: 2},
+					"eth1": {RxBytes: 3000000, RxPackets: 30, TxBytes: 4000000, TxPackets: 40, TxErrors: 3, RxDropped: 4},
+				},
+				BlockIOReadMb:   4,
+				BlockIOWriteMb:  2,
+				BlockIOReadOps:  10,
+				BlockIOWriteOps: 25,
+				BlockIO: []BlockDevice{
+					{Device: "253:1", ReadBytes: 3000000, WriteOps: 5},
+					{Device: "8:0", ReadBytes: 1000000, WriteBytes: 2000000, ReadOps: 10, WriteOps: 20},
+				},
+				PidsCurrent: 12,
+				PidsLimit:   100,
 			},
 		},
+		{
+			name:       "no limit and no stats",
+			inputstats: Stats{},
+			want:       CumulateStats{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -321,6 +445,27 @@ func TestCumulateStatsInfo(t *testing.T) {
 	}
 }
 
+func TestMemoryStats_WorkingSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats MemoryStats
+		want  int64
+	}{
+		{name: "cgroup v1", stats: MemoryStats{Usage: 100, Stats: map[string]int64{"total_inactive_file": 30, "cache": 50}}, want: 70},
+		{name: "cgroup v2", stats: MemoryStats{Usage: 100, Stats: map[string]int64{"inactive_file": 40}}, want: 60},
+		{name: "old docker", stats: MemoryStats{Usage: 100, Stats: map[string]int64{"cache": 50}}, want: 50},
+		{name: "no stats", stats: MemoryStats{Usage: 100}, want: 100},
+		{name: "inactive bigger than usage", stats: MemoryStats{Usage: 100, Stats: map[string]int64{"inactive_file": 200}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.WorkingSet(); got != tt.want {
+				t.Errorf("MemoryStats.WorkingSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTracker_GetStaticContent(t *testing.T) {
 	type fields struct {
 	}
@@ -350,3 +495,12 @@ func TestTracker_GetStaticContent(t *testing.T) {
 		})
 	}
 }
+
+func TestNewTracker_Inspect(t *testing.T) {
+	tr := NewTracker(&MockDockerClient{}, types.Container{ID: "mockid", Names: []string{"mocktest0"}}, Options{})
+	time.Sleep(60 * time.Millisecond)
+	inspect := tr.GetInspect()
+	if inspect == nil || inspect.ID != "mockid" {
+		t.Errorf("Tracker.GetInspect() = %v, want inspect of mockid", inspect)
+	}
+}
@@ -10,25 +10,58 @@ const (
 	MessageTypeLog MessageType = "LOG"
 	//MessageTypeStats a statsmessage
 	MessageTypeStats MessageType = "STATS"
+	// MessageTypeAlert an alert rule has fired or resolved
+	MessageTypeAlert MessageType = "ALERT"
+)
+
+// MessageSubType is the kind of a STATS Message which is not a stats of the docker api
+type MessageSubType string
+
+const (
+	// MessageSubTypeTop the processes of a container (label funk.log.top)
+	MessageSubTypeTop MessageSubType = "TOP"
+	// MessageSubTypeSize the disk usage of a container (label funk.log.size)
+	MessageSubTypeSize MessageSubType = "SIZE"
+	// MessageSubTypeFilter the count of the loglines dropped by funk.log.drop, funk.log.keep, funk.log.sample and funk.log.minlevel
+	MessageSubTypeFilter MessageSubType = "FILTER"
+	// MessageSubTypeLogMetrics the metrics of the loglines of a container (label funk.log.metrics)
+	MessageSubTypeLogMetrics MessageSubType = "LOG_METRICS"
+	// MessageSubTypePatterns the count of the templates of the log messages of a container (label funk.log.patterns)
+	MessageSubTypePatterns MessageSubType = "PATTERNS"
 )
 
 // Message is the Lawobject between agent and server
 // Its the JSON which will be send to server
 type Message struct {
-	Time          time.Time   `json:"time,omitempty"`        // Time is the explizit time where this dataset is created
-	Type          MessageType `json:"type,omitempty"`        // Type is this a LOG or a STATS dataset
-	Data          []string    `json:"data,omitempty"`        // Data is an array of seralized JSON. Here are the Jsonobjects from logging Container
-	SearchIndex   string      `json:"searchindex,omitempty"` // SearchIndex is the Elasticsearch index to save the given dataset
-	Attributes    Attributes  `json:"attr,omitempty"`        // Attributes are Metainformation
-	StaticContent string      `json:"static_content,omitempty"`
+	Time          time.Time      `json:"time,omitempty"`        // Time is the explizit time where this dataset is created
+	Type          MessageType    `json:"type,omitempty"`        // Type is this a LOG or a STATS dataset
+	SubType       MessageSubType `json:"subtype,omitempty"`     // SubType is set for the snapshots of STATS like TOP or SIZE
+	Data          []string       `json:"data,omitempty"`        // Data is an array of seralized JSON. Here are the Jsonobjects from logging Container
+	SearchIndex   string         `json:"searchindex,omitempty"` // SearchIndex is the Elasticsearch index to save the given dataset
+	Attributes    Attributes     `json:"attr,omitempty"`        // Attributes are Metainformation
+	StaticContent string         `json:"static_content,omitempty"`
 }
 
 // Attributes are the Metainformation
 // like Hostname, the id of tracking container and so on
 type Attributes struct {
-	Host          string `json:"hostname,omitempty"`
-	Containername string `json:"container,omitempty"`
-	Servicename   string `json:"service,omitempty"`
-	Namespace     string `json:"namespace,omitempty"`
-	ContainerID   string `json:"container_id,omitempty"`
+	Host             string            `json:"hostname,omitempty"`
+	Containername    string            `json:"container,omitempty"`
+	Servicename      string            `json:"service,omitempty"`
+	Namespace        string            `json:"namespace,omitempty"`
+	Pod              string            `json:"pod,omitempty"`
+	PodUID           string            `json:"pod_uid,omitempty"`
+	ContainerID      string            `json:"container_id,omitempty"`       // ContainerID is the full id of the container
+	ContainerIDShort string            `json:"container_id_short,omitempty"` // ContainerIDShort is the id like docker ps shows it
+	Image            string            `json:"image,omitempty"`              // Image is the image reference the container is started with
+	ImageName        string            `json:"image_name,omitempty"`
+	ImageTag         string            `json:"image_tag,omitempty"`
+	ImageDigest      string            `json:"image_digest,omitempty"` // ImageDigest is the id of the image (sha256:...)
+	ComposeProject   string            `json:"compose_project,omitempty"`
+	ComposeService   string            `json:"compose_service,omitempty"`
+	StartedAt        string            `json:"started_at,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`   // Labels are the container labels allowed by FORWARD_LABELS
+	Networks         map[string]string `json:"networks,omitempty"` // Networks maps the networkname to the ip address of the container
+	Sender           string            `json:"sender,omitempty"`   // Sender is the ip address of the system which pushed the logs (fluentd forward, syslog, gelf)
+	SenderHost       string            `json:"sender_host,omitempty"`
 }
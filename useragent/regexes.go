@@ -0,0 +1,43 @@
+package useragent
+
+// DefaultRegexes is the embedded regex database. It can be replaced by a file with the same format.
+// Each list is checked in order and the first match wins.
+// family can use $1 for the first submatch, without family the first submatch is the family.
+// The version is the submatch behind the family (underscores are replaced by dots).
+// versions maps a parsed version to a better known one (like Windows NT 6.1 to 7)
+const DefaultRegexes = `{
+	"bots": [
+		{"regex": "(?i)(Googlebot|bingbot|Slurp|DuckDuckBot|Baiduspider|YandexBot|facebookexternalhit|Twitterbot|LinkedInBot|Applebot|AhrefsBot|SemrushBot|MJ12bot|PetalBot|GPTBot)/?(\\d+(?:\\.\\d+)*)?"},
+		{"regex": "(HeadlessChrome)/(\\d+(?:\\.\\d+)*)"},
+		{"regex": "(?i)([a-z0-9\\-_]*(?:bot|crawler|spider))[/ ]?(\\d+(?:\\.\\d+)*)?"},
+		{"regex": "(?i)(monitoring|uptime|pingdom|statuscake)"}
+	],
+	"browsers": [
+		{"regex": "(?:Edg|Edge|EdgA|EdgiOS)/(\\d+(?:\\.\\d+)*)", "family": "Edge"},
+		{"regex": "(?:OPR|Opera)/(\\d+(?:\\.\\d+)*)", "family": "Opera"},
+		{"regex": "SamsungBrowser/(\\d+(?:\\.\\d+)*)", "family": "Samsung Internet"},
+		{"regex": "(?:Firefox|FxiOS)/(\\d+(?:\\.\\d+)*)", "family": "Firefox"},
+		{"regex": "(?:Chrome|CriOS|Chromium)/(\\d+(?:\\.\\d+)*)", "family": "Chrome"},
+		{"regex": "Version/(\\d+(?:\\.\\d+)*).*Safari/", "family": "Safari"},
+		{"regex": "MSIE (\\d+(?:\\.\\d+)*)", "family": "IE"},
+		{"regex": "Trident/.*rv:(\\d+(?:\\.\\d+)*)", "family": "IE"},
+		{"regex": "(curl|Wget|python-requests|Go-http-client|okhttp|Apache-HttpClient|PostmanRuntime|axios|node-fetch)/(\\d+(?:\\.\\d+)*)"}
+	],
+	"os": [
+		{"regex": "Windows Phone (?:OS )?(\\d+(?:\\.\\d+)*)", "family": "Windows Phone"},
+		{"regex": "Windows NT (\\d+\\.\\d+)", "family": "Windows", "versions": {"10.0": "10", "6.3": "8.1", "6.2": "8", "6.1": "7", "6.0": "Vista", "5.1": "XP"}},
+		{"regex": "(?:iPhone|CPU) OS (\\d+(?:_\\d+)*)", "family": "iOS"},
+		{"regex": "Mac OS X (\\d+(?:[_.]\\d+)*)", "family": "Mac OS X"},
+		{"regex": "Android (\\d+(?:\\.\\d+)*)", "family": "Android"},
+		{"regex": "CrOS \\S+ (\\d+(?:\\.\\d+)*)", "family": "Chrome OS"},
+		{"regex": "(Ubuntu|Fedora|Debian)(?:/(\\d+(?:\\.\\d+)*))?"},
+		{"regex": "Linux", "family": "Linux"}
+	],
+	"devices": [
+		{"regex": "iPad|Tablet|Nexus (?:7|9|10)|SM-T\\d+", "type": "tablet"},
+		{"regex": "Mobi|iPhone|iPod|Android.*Mobile|Windows Phone|BlackBerry", "type": "mobile"},
+		{"regex": "Android", "type": "tablet"},
+		{"regex": "SmartTV|SMART-TV|AppleTV|CrKey|Tizen.*TV|Web0S", "type": "tv"},
+		{"regex": "PlayStation|Xbox|Nintendo", "type": "console"}
+	]
+}`
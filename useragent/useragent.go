@@ -0,0 +1,193 @@
+package useragent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasibio/funk_agent/logger"
+)
+
+// Device types of a Result
+const (
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// Result is the parsed information of a user agent
+type Result struct {
+	BrowserFamily  string `json:"browser_family,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OSFamily       string `json:"os_family,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	DeviceType     string `json:"device_type,omitempty"`
+	IsBot          bool   `json:"is_bot"`
+}
+
+type regexEntry struct {
+	Regex    string            `json:"regex"`
+	Family   string            `json:"family"`
+	Type     string            `json:"type"`
+	Versions map[string]string `json:"versions"`
+	pattern  *regexp.Regexp
+}
+
+type regexDatabase struct {
+	Bots     []*regexEntry `json:"bots"`
+	Browsers []*regexEntry `json:"browsers"`
+	OS       []*regexEntry `json:"os"`
+	Devices  []*regexEntry `json:"devices"`
+}
+
+// Parser parse user agents by a regex database
+type Parser struct {
+	db regexDatabase
+}
+
+// NewParser creates a Parser by a regex database in the format of DefaultRegexes
+func NewParser(data []byte) (*Parser, error) {
+	var db regexDatabase
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, err
+	}
+	for _, list := range [][]*regexEntry{db.Bots, db.Browsers, db.OS, db.Devices} {
+		for _, one := range list {
+			pattern, err := regexp.Compile(one.Regex)
+			if err != nil {
+				return nil, err
+			}
+			one.pattern = pattern
+		}
+	}
+	return &Parser{db: db}, nil
+}
+
+// NewDefaultParser creates a Parser with the embedded DefaultRegexes
+func NewDefaultParser() *Parser {
+	p, err := NewParser([]byte(DefaultRegexes))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (e *regexEntry) match(ua string) (string, string, bool) {
+	sub := e.pattern.FindStringSubmatch(ua)
+	if sub == nil {
+		return "", "", false
+	}
+	family, versionIndex := e.Family, 1
+	switch {
+	case family == "" && len(sub) > 1:
+		family, versionIndex = sub[1], 2
+	case family == "":
+		family = sub[0]
+	case strings.Contains(family, "$1") && len(sub) > 1:
+		family, versionIndex = strings.Replace(family, "$1", sub[1], -1), 2
+	}
+	version := ""
+	if len(sub) > versionIndex {
+		version = strings.Replace(sub[versionIndex], "_", ".", -1)
+	}
+	if mapped, exist := e.Versions[version]; exist {
+		version = mapped
+	}
+	return family, version, true
+}
+
+func firstMatch(entries []*regexEntry, ua string) (*regexEntry, string, string) {
+	for _, one := range entries {
+		if family, version, ok := one.match(ua); ok {
+			return one, family, version
+		}
+	}
+	return nil, "", ""
+}
+
+// Parse returns the browser, os and device information of ua
+func (p *Parser) Parse(ua string) Result {
+	res := Result{}
+	if _, family, version := firstMatch(p.db.Browsers, ua); family != "" {
+		res.BrowserFamily, res.BrowserVersion = family, version
+	}
+	if _, family, version := firstMatch(p.db.OS, ua); family != "" {
+		res.OSFamily, res.OSVersion = family, version
+	}
+	if bot, family, version := firstMatch(p.db.Bots, ua); bot != nil {
+		res.IsBot = true
+		res.DeviceType = DeviceBot
+		res.BrowserFamily, res.BrowserVersion = family, version
+		return res
+	}
+	if device, _, _ := firstMatch(p.db.Devices, ua); device != nil {
+		res.DeviceType = device.Type
+	} else if res.BrowserFamily != "" || res.OSFamily != "" {
+		res.DeviceType = DeviceDesktop
+	} else {
+		res.DeviceType = DeviceOther
+	}
+	return res
+}
+
+// FileParser is a Parser loaded from a file which is reloaded if the file changes.
+// Until the file could be loaded the embedded DefaultRegexes are used
+type FileParser struct {
+	mu      sync.RWMutex
+	parser  *Parser
+	path    string
+	modTime time.Time
+}
+
+// NewFileParser loads the regex database at path and looks each interval for changes
+func NewFileParser(path string, interval time.Duration) *FileParser {
+	res := &FileParser{
+		parser: NewDefaultParser(),
+		path:   path,
+	}
+	res.reload()
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			res.reload()
+		}
+	}()
+	return res
+}
+
+func (f *FileParser) reload() {
+	stats, err := os.Stat(f.path)
+	if err != nil {
+		logger.Get().Errorw("Can not read user agent regexes: "+err.Error(), "file", f.path)
+		return
+	}
+	if stats.ModTime().Equal(f.modTime) {
+		return
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		logger.Get().Errorw("Can not read user agent regexes: "+err.Error(), "file", f.path)
+		return
+	}
+	parser, err := NewParser(data)
+	if err != nil {
+		logger.Get().Errorw("Can not parse user agent regexes: "+err.Error(), "file", f.path)
+		return
+	}
+	f.mu.Lock()
+	f.parser = parser
+	f.modTime = stats.ModTime()
+	f.mu.Unlock()
+	logger.Get().Infow("Loaded user agent regexes", "file", f.path)
+}
+
+// Parse returns the browser, os and device information of ua
+func (f *FileParser) Parse(ua string) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.parser.Parse(ua)
+}
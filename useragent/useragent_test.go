@@ -0,0 +1,95 @@
+package useragent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParser_Parse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Result
+	}{
+		{
+			name: "Chrome on Windows 10",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.88 Safari/537.36",
+			want: Result{BrowserFamily: "Chrome", BrowserVersion: "79.0.3945.88", OSFamily: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Edge is not Chrome",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.87 Safari/537.36 Edg/80.0.361.48",
+			want: Result{BrowserFamily: "Edge", BrowserVersion: "80.0.361.48", OSFamily: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Safari on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 13_3 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.4 Mobile/15E148 Safari/604.1",
+			want: Result{BrowserFamily: "Safari", BrowserVersion: "13.0.4", OSFamily: "iOS", OSVersion: "13.3", DeviceType: "mobile"},
+		},
+		{
+			name: "Safari on iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 12_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1 Mobile/15E148 Safari/604.1",
+			want: Result{BrowserFamily: "Safari", BrowserVersion: "12.1", OSFamily: "iOS", OSVersion: "12.2", DeviceType: "tablet"},
+		},
+		{
+			name: "Firefox on Linux",
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:72.0) Gecko/20100101 Firefox/72.0",
+			want: Result{BrowserFamily: "Firefox", BrowserVersion: "72.0", OSFamily: "Ubuntu", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Chrome on Android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 10; SM-G973F) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.116 Mobile Safari/537.36",
+			want: Result{BrowserFamily: "Chrome", BrowserVersion: "79.0.3945.116", OSFamily: "Android", OSVersion: "10", DeviceType: "mobile"},
+		},
+		{
+			name: "Googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Result{BrowserFamily: "Googlebot", BrowserVersion: "2.1", DeviceType: DeviceBot, IsBot: true},
+		},
+		{
+			name: "curl",
+			ua:   "curl/7.64.1",
+			want: Result{BrowserFamily: "curl", BrowserVersion: "7.64.1", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "unknown",
+			ua:   "something",
+			want: Result{DeviceType: DeviceOther},
+		},
+	}
+	p := NewDefaultParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Parse(tt.ua); got != tt.want {
+				t.Errorf("Parser.Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFileParser(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "useragent")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "regexes.json")
+
+	p := NewFileParser(file, 10*time.Millisecond)
+	if got := p.Parse("MockBrowser/1.0"); got.BrowserFamily != "" {
+		t.Errorf("Missing file have to use the default regexes got %+v", got)
+	}
+
+	ioutil.WriteFile(file, []byte(`{"browsers": [{"regex": "MockBrowser/(\\d+(?:\\.\\d+)*)", "family": "Mock"}]}`), 0644)
+	time.Sleep(50 * time.Millisecond)
+	want := Result{BrowserFamily: "Mock", BrowserVersion: "1.0", DeviceType: DeviceDesktop}
+	if got := p.Parse("MockBrowser/1.0"); got != want {
+		t.Errorf("FileParser.Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewParser_InvalidRegex(t *testing.T) {
+	if _, err := NewParser([]byte(`{"os": [{"regex": "(("}]}`)); err == nil {
+		t.Errorf("NewParser() want error for invalid regex")
+	}
+}
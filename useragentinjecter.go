@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fasibio/funk_agent/jsonpath"
+	"github.com/fasibio/funk_agent/useragent"
+)
+
+// DefaultUserAgentTarget is the prefix for the injected user agent information if no target is given
+const DefaultUserAgentTarget = "useragent"
+
+// UserAgentParser returns the browser, os and device information of a user agent
+type UserAgentParser interface {
+	Parse(ua string) useragent.Result
+}
+
+// UserAgentField is the label funk.log.useragentfrom.
+// Path is the path inside the logline to the user agent, Target the prefix for the injected fields
+type UserAgentField struct {
+	Path   string
+	Target string
+}
+
+// ParseUserAgentField parse the label funk.log.useragentfrom like .request.headers.user-agent:ua
+// It returns nil if the label is not set
+func ParseUserAgentField(value string) *UserAgentField {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	res := UserAgentField{Path: value, Target: DefaultUserAgentTarget}
+	if parts := strings.SplitN(value, ":", 2); len(parts) == 2 {
+		res.Path = strings.TrimSpace(parts[0])
+		res.Target = getFilledValue(strings.TrimSpace(parts[1]), DefaultUserAgentTarget)
+	}
+	return &res
+}
+
+func (w *Holder) injectUserAgentInformation(value string, field *UserAgentField) (string, error) {
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil || values == nil {
+		return value, errors.New("Logline is not a json object")
+	}
+	uaValue, found := jsonpath.Get(values, field.Path)
+	if !found {
+		return value, fmt.Errorf("Field %s not found", field.Path)
+	}
+	ua, ok := uaValue.(string)
+	if !ok {
+		return value, fmt.Errorf("Field %s is not a string", field.Path)
+	}
+	var parsed map[string]interface{}
+	b, _ := json.Marshal(w.UserAgentParser.Parse(ua))
+	json.Unmarshal(b, &parsed)
+	for key, one := range parsed {
+		values[field.Target+"."+key] = one
+	}
+	res, err := json.Marshal(values)
+	if err != nil {
+		return value, err
+	}
+	return string(res), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fasibio/funk_agent/useragent"
+)
+
+func TestHolder_injectUserAgentInformation(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "nested user agent with default target",
+			label: ".request.headers.user-agent",
+			value: `{"request":{"headers":{"user-agent":"curl/7.64.1"}}}`,
+			want:  `{"request":{"headers":{"user-agent":"curl/7.64.1"}},"useragent.browser_family":"curl","useragent.browser_version":"7.64.1","useragent.device_type":"desktop","useragent.is_bot":false}`,
+		},
+		{
+			name:  "bot with own target",
+			label: ".ua:client",
+			value: `{"ua":"Googlebot/2.1"}`,
+			want:  `{"client.browser_family":"Googlebot","client.browser_version":"2.1","client.device_type":"bot","client.is_bot":true,"ua":"Googlebot/2.1"}`,
+		},
+		{
+			name:  "big integers are not rounded",
+			label: ".ua",
+			value: `{"ua":"curl/7.64.1","id":9007199254740993}`,
+			want:  `{"id":9007199254740993,"ua":"curl/7.64.1","useragent.browser_family":"curl","useragent.browser_version":"7.64.1","useragent.device_type":"desktop","useragent.is_bot":false}`,
+		},
+		{
+			name:    "field not found",
+			label:   ".ua",
+			value:   `{"other":"curl/7.64.1"}`,
+			want:    `{"other":"curl/7.64.1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "field is no string",
+			label:   ".ua",
+			value:   `{"ua":12}`,
+			want:    `{"ua":12}`,
+			wantErr: true,
+		},
+		{
+			name:    "no json",
+			label:   ".ua",
+			value:   `plain`,
+			want:    `plain`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Holder{UserAgentParser: useragent.NewDefaultParser()}
+			got, err := w.injectUserAgentInformation(tt.value, ParseUserAgentField(tt.label))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("injectUserAgentInformation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("injectUserAgentInformation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}